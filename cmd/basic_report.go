@@ -21,6 +21,7 @@ type basicReportCmd struct {
 	hiddenResultsTable  bool
 	outputPath          string
 	reportCfg           reports.ReportConfig
+	selector            string
 	customLabels        string
 }
 
@@ -36,6 +37,7 @@ func basicReportCommand() subcommands.Command {
 
 func (cmd *basicReportCmd) SetFlags(f *flag.FlagSet) {
 	f.StringVar(&cmd.outputPath, "output", "report.html", "Output report (HTML)")
+	f.StringVar(&cmd.selector, "select", "", "Also include succeeded jobs matching this label selector (e.g. \"campaign=gc,!nightly\")")
 	f.StringVar(&cmd.reportCfg.Title, "title", "", "Title of the report (auto-generated if empty)")
 	f.BoolVar(&cmd.skipTimeOp, "no_timeop", false, "Do not include time/op graph and table")
 	f.BoolVar(&cmd.skipSpeed, "no_speed", false, "Do not include speed graph and table")
@@ -50,8 +52,8 @@ func (cmd *basicReportCmd) Execute(_ context.Context, f *flag.FlagSet, _ ...inte
 	}
 
 	jobIds := f.Args()
-	if len(jobIds) < 1 {
-		fmt.Fprintf(os.Stderr, "Pass at least one job Id argument\n")
+	if len(jobIds) < 1 && cmd.selector == "" {
+		fmt.Fprintf(os.Stderr, "Pass at least one job Id argument or a label selector\n")
 		return subcommands.ExitUsageError
 	}
 
@@ -70,6 +72,12 @@ func (cmd *basicReportCmd) Execute(_ context.Context, f *flag.FlagSet, _ ...inte
 	}
 	defer c.Close()
 
+	jobIds, err = selectReportJobs(c, jobIds, cmd.selector)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		return subcommands.ExitFailure
+	}
+
 	dataTable, err := reports.CreateDataTable(c, jobIds...)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "%v\n", err)
@@ -20,6 +20,7 @@ type comparativeReportCmd struct {
 	hiddenResultsTable  bool
 	outputPath          string
 	reportCfg           reports.ReportConfig
+	selector            string
 	beforeLabel         string
 	afterLabel          string
 }
@@ -36,6 +37,7 @@ func comparativeReportCommand() subcommands.Command {
 
 func (cmd *comparativeReportCmd) SetFlags(f *flag.FlagSet) {
 	f.StringVar(&cmd.outputPath, "output", "report.html", "Output report (HTML)")
+	f.StringVar(&cmd.selector, "select", "", "Also include succeeded jobs matching this label selector (e.g. \"campaign=gc,!nightly\")")
 	f.StringVar(&cmd.reportCfg.Title, "title", "", "Title of the report (auto-generated if empty)")
 	f.BoolVar(&cmd.skipTimeOp, "no_timeop", false, "Do not include time/op graph and table")
 	f.BoolVar(&cmd.skipSpeed, "no_speed", false, "Do not include speed graph and table")
@@ -51,7 +53,7 @@ func (cmd *comparativeReportCmd) Execute(_ context.Context, f *flag.FlagSet, _ .
 	}
 
 	jobIds := f.Args()
-	if len(jobIds) != 2 {
+	if len(jobIds) != 2 && cmd.selector == "" {
 		fmt.Fprintf(os.Stderr, "Pass two job Id argument\n")
 		return subcommands.ExitUsageError
 	}
@@ -71,6 +73,15 @@ func (cmd *comparativeReportCmd) Execute(_ context.Context, f *flag.FlagSet, _ .
 	}
 	defer c.Close()
 
+	jobIds, err = selectReportJobs(c, jobIds, cmd.selector)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		return subcommands.ExitFailure
+	} else if len(jobIds) != 2 {
+		fmt.Fprintf(os.Stderr, "Need exactly two jobs, selected: %v\n", jobIds)
+		return subcommands.ExitUsageError
+	}
+
 	dataTable, err := reports.CreateDataTable(c, jobIds...)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "%v\n", err)
@@ -17,6 +17,7 @@ type customReportCmd struct {
 	baseCommand
 	outputPath   string
 	reportCfg    reports.ReportConfig
+	selector     string
 	specPath     string
 	customLabels string
 }
@@ -33,6 +34,7 @@ func customReportCommand() subcommands.Command {
 
 func (cmd *customReportCmd) SetFlags(f *flag.FlagSet) {
 	f.StringVar(&cmd.outputPath, "output", "report.html", "Output report (HTML)")
+	f.StringVar(&cmd.selector, "select", "", "Also include succeeded jobs matching this label selector (e.g. \"campaign=gc,!nightly\")")
 	f.StringVar(&cmd.specPath, "spec", "spec.json", "Report configuration (JSON)")
 	f.StringVar(&cmd.customLabels, "labels", "", "Use custom labels (comma separated, no spaces, e.g.: \"a,b,c\")")
 }
@@ -42,7 +44,7 @@ func (cmd *customReportCmd) Execute(_ context.Context, f *flag.FlagSet, _ ...int
 		fmt.Printf("%s args: %v\n", cmd.name, f.Args())
 	}
 
-	if len(f.Args()) < 1 {
+	if len(f.Args()) < 1 && cmd.selector == "" {
 		fmt.Fprintf(os.Stderr, "Must specify at least one job id\n")
 		return subcommands.ExitUsageError
 	}
@@ -69,7 +71,13 @@ func (cmd *customReportCmd) Execute(_ context.Context, f *flag.FlagSet, _ ...int
 	}
 	defer c.Close()
 
-	dataTable, err := reports.CreateDataTable(c, f.Args()...)
+	jobIds, err := selectReportJobs(c, f.Args(), cmd.selector)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		return subcommands.ExitFailure
+	}
+
+	dataTable, err := reports.CreateDataTable(c, jobIds...)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "%v\n", err)
 		return subcommands.ExitFailure
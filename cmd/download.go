@@ -82,38 +82,20 @@ func (cmd *downloadCmd) Execute(_ context.Context, f *flag.FlagSet, _ ...interfa
 			return subcommands.ExitFailure
 		}
 
-		if job.Log == "" {
-			fmt.Printf("No log artifact for job %s\n", job.Id)
-		} else {
-			fileName := fmt.Sprintf("%s_log.txt", jobId)
-			filePath := filepath.Join(cmd.outputDirPath, fileName)
-			err := c.DownloadLogArtifact(job, filePath)
-			if err != nil {
-				fmt.Fprintf(os.Stderr, "Download failed: %v\n", err)
-				return subcommands.ExitFailure
-			}
-			fmt.Printf("Downloaded %s\n", filePath)
+		artifacts, err := c.ListArtifacts(job.Id)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%v\n", err)
+			return subcommands.ExitFailure
 		}
 
-		if job.Results == "" {
-			fmt.Printf("No results artifact for job %s\n", job.Id)
-		} else {
-			fileName := fmt.Sprintf("%s_results.txt", jobId)
-			filePath := filepath.Join(cmd.outputDirPath, fileName)
-			err := c.DownloadResultsArtifact(job, filePath)
-			if err != nil {
-				fmt.Fprintf(os.Stderr, "Download failed: %v\n", err)
-				return subcommands.ExitFailure
-			}
-			fmt.Printf("Downloaded %s\n", filePath)
+		if len(artifacts) == 0 {
+			fmt.Printf("No artifacts for job %s\n", job.Id)
 		}
 
-		if job.Script == "" {
-			fmt.Printf("No script artifact for job %s\n", job.Id)
-		} else {
-			fileName := fmt.Sprintf("%s_run.sh", jobId)
+		for _, artifact := range artifacts {
+			fileName := fmt.Sprintf("%s_%s", job.Id, artifact.Name)
 			filePath := filepath.Join(cmd.outputDirPath, fileName)
-			err := c.DownloadScriptArtifact(job, filePath)
+			err := c.DownloadArtifact(job.Id, artifact.Name, filePath)
 			if err != nil {
 				fmt.Fprintf(os.Stderr, "Download failed: %v\n", err)
 				return subcommands.ExitFailure
@@ -0,0 +1,78 @@
+package cmd
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/synadia-labs/go-bench-away/v1/client"
+
+	"github.com/google/subcommands"
+)
+
+type drainCmd struct {
+	baseCommand
+}
+
+func drainCommand() subcommands.Command {
+	return &drainCmd{
+		baseCommand: baseCommand{
+			name:     "drain",
+			synopsis: "tells workers to finish their current job and exit",
+			usage:    "drain workerIdOrHostname [workerIdOrHostname [...]]\n",
+		},
+	}
+}
+
+func (cmd *drainCmd) SetFlags(f *flag.FlagSet) {
+}
+
+func (cmd *drainCmd) Execute(_ context.Context, f *flag.FlagSet, _ ...interface{}) subcommands.ExitStatus {
+	if rootOptions.verbose {
+		fmt.Printf("%s args: %v\n", cmd.name, f.Args())
+	}
+
+	c, err := client.NewClient(
+		rootOptions.natsServerUrl,
+		rootOptions.credentials,
+		rootOptions.namespace,
+		client.InitWorkersRegistry(),
+		client.Verbose(rootOptions.verbose),
+	)
+
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		return subcommands.ExitFailure
+	}
+	defer c.Close()
+
+	workers, err := c.LoadWorkers()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		return subcommands.ExitFailure
+	}
+
+	for _, name := range f.Args() {
+		// Drain the worker with this ID, or all workers running on this host
+		drained := 0
+		for _, worker := range workers {
+			if worker.Id != name && worker.WorkerInfo.Hostname != name {
+				continue
+			}
+			err = c.DrainWorker(worker.Id)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "%v\n", err)
+				return subcommands.ExitFailure
+			}
+			fmt.Printf("Draining worker: %s %s\n", worker.WorkerInfo.Hostname, worker.Id)
+			drained++
+		}
+		if drained == 0 {
+			fmt.Fprintf(os.Stderr, "No live worker with ID or hostname: %s\n", name)
+			return subcommands.ExitFailure
+		}
+	}
+
+	return subcommands.ExitSuccess
+}
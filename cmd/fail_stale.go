@@ -5,6 +5,7 @@ import (
 	"flag"
 	"fmt"
 	"os"
+	"time"
 
 	"github.com/google/subcommands"
 	"github.com/synadia-labs/go-bench-away/v1/client"
@@ -12,19 +13,22 @@ import (
 
 type failStaleCmd struct {
 	baseCommand
+	heartbeatTimeout time.Duration
 }
 
 func failStaleCommand() subcommands.Command {
 	return &failStaleCmd{
 		baseCommand: baseCommand{
 			name:     "fail-stale",
-			synopsis: "Mark all stale Submitted/Running jobs as Failed",
+			synopsis: "Mark Running jobs past their timeout as TimedOut, and jobs of lost workers as Failed",
 			usage:    "fail-stale [options]\n",
 		},
 	}
 }
 
 func (cmd *failStaleCmd) SetFlags(f *flag.FlagSet) {
+	f.DurationVar(&cmd.heartbeatTimeout, "heartbeat_timeout", client.StaleHeartbeatThreshold,
+		"Max time since the last heartbeat of a running job")
 }
 
 func (cmd *failStaleCmd) Execute(_ context.Context, f *flag.FlagSet, _ ...interface{}) subcommands.ExitStatus {
@@ -47,14 +51,14 @@ func (cmd *failStaleCmd) Execute(_ context.Context, f *flag.FlagSet, _ ...interf
 	}
 	defer c.Close()
 
-	fmt.Println("Scanning for stale Submitted/Running jobs...")
+	fmt.Println("Scanning for stale Running jobs...")
 
-	updated, err := c.FailStaleJobs()
+	updated, err := c.FailStaleJobs(cmd.heartbeatTimeout)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
 		return subcommands.ExitFailure
 	}
 
-	fmt.Printf("Marked %d stale jobs as Failed\n", updated)
+	fmt.Printf("Updated %d stale jobs\n", updated)
 	return subcommands.ExitSuccess
 }
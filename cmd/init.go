@@ -56,18 +56,28 @@ func (cmd *initCmd) Execute(_ context.Context, f *flag.FlagSet, _ ...interface{}
 	}
 	defer c.Close()
 
+	if err := initSchema(c); err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		return subcommands.ExitFailure
+	}
+
+	return subcommands.ExitSuccess
+}
+
+// Create (or upgrade) streams, KV stores and object store, shared by the init and local commands
+func initSchema(c *client.Client) error {
 	initFuncs := []func() error{
 		c.CreateJobsQueue,
 		c.CreateJobsRepository,
 		c.CreateArtifactsStore,
+		c.CreateWorkersRegistry,
+		c.CreateLogsStream,
 	}
 
 	for _, fun := range initFuncs {
 		if err := fun(); err != nil {
-			fmt.Fprintf(os.Stderr, "%v\n", err)
-			return subcommands.ExitFailure
+			return err
 		}
 	}
-
-	return subcommands.ExitSuccess
+	return nil
 }
@@ -5,6 +5,7 @@ import (
 	"flag"
 	"fmt"
 	"os"
+	"strings"
 	"time"
 
 	"github.com/synadia-labs/go-bench-away/v1/client"
@@ -17,6 +18,7 @@ type listCmd struct {
 	baseCommand
 	limit    int
 	altQueue string
+	selector string
 }
 
 func listCommand() subcommands.Command {
@@ -31,6 +33,7 @@ func listCommand() subcommands.Command {
 
 func (cmd *listCmd) SetFlags(f *flag.FlagSet) {
 	f.IntVar(&cmd.limit, "n", 10, "Maximum number of recent jobs to show (0 for unlimited)")
+	f.StringVar(&cmd.selector, "select", "", "Only show jobs matching this label selector (e.g. \"pr=1234,!nightly\")")
 	f.StringVar(&cmd.altQueue, "queue", "", "Read jobs from a non-default queue with the specified name")
 }
 
@@ -62,7 +65,18 @@ func (cmd *listCmd) Execute(_ context.Context, f *flag.FlagSet, _ ...interface{}
 	}
 	defer c.Close()
 
-	jobs, err := c.LoadRecentJobs(cmd.limit, 0)
+	selector, err := core.ParseLabelSelector(cmd.selector)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		return subcommands.ExitUsageError
+	}
+
+	var jobs []*core.JobRecord
+	if selector.IsEmpty() {
+		jobs, err = c.LoadRecentJobs(cmd.limit, 0)
+	} else {
+		jobs, _, err = c.LoadJobsByKV(cmd.limit, 0, nil, selector)
+	}
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "%v\n", err)
 		return subcommands.ExitFailure
@@ -79,6 +93,7 @@ func (cmd *listCmd) Execute(_ context.Context, f *flag.FlagSet, _ ...interface{}
 		fmt.Printf(
 			" %s %s [%v]\n"+
 				"     - Submitted: %v (%v ago) by %s\n"+
+				"     - Priority: %s\n"+
 				"     - Remote: %s Ref: %s\n"+
 				"     - Filter: '%s'\n"+
 				"     - Repetitions: %d x %v\n"+
@@ -89,6 +104,7 @@ func (cmd *listCmd) Execute(_ context.Context, f *flag.FlagSet, _ ...interface{}
 			job.Created,
 			time.Since(job.Created).Truncate(time.Minute),
 			job.Parameters.Username,
+			job.Parameters.Priority,
 			job.Parameters.GitRemote,
 			job.Parameters.GitRef,
 			job.Parameters.TestsFilterExpr,
@@ -96,9 +112,36 @@ func (cmd *listCmd) Execute(_ context.Context, f *flag.FlagSet, _ ...interface{}
 			job.Parameters.TestMinRuntime,
 		)
 
+		if len(job.Parameters.Labels) > 0 {
+			fmt.Printf("     - Labels: %s\n", job.Parameters.Labels)
+		}
+
+		if len(job.DependsOn) > 0 {
+			fmt.Printf(
+				"     - Depends on: %s (on failure: %s)\n",
+				strings.Join(job.DependsOn, ", "),
+				job.DependencyPolicy,
+			)
+		}
+
+		if job.FailureReason != nil {
+			fmt.Printf("     - Failure: %s\n", job.FailureReason)
+		}
+
+		for _, attempt := range job.PreviousAttempts {
+			fmt.Printf(
+				"     - Attempt %d failed: %s (log: %s)\n",
+				attempt.Attempt,
+				attempt.FailureReason,
+				attempt.Log,
+			)
+		}
+
 		switch job.Status {
 		case core.Failed:
 			fallthrough
+		case core.TimedOut:
+			fallthrough
 		case core.Succeeded:
 			fmt.Printf(
 				"     - Run time: %v\n"+
@@ -117,9 +160,11 @@ func (cmd *listCmd) Execute(_ context.Context, f *flag.FlagSet, _ ...interface{}
 		case core.Running:
 			fmt.Printf(
 				"     - Run time: %v (max: %v)\n"+
+					"     - Last heartbeat: %v ago\n"+
 					"",
 				job.RunTime(),
 				job.Parameters.Timeout,
+				time.Since(job.Heartbeat).Round(time.Second),
 			)
 
 		case core.Submitted:
@@ -0,0 +1,172 @@
+package cmd
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/synadia-labs/go-bench-away/internal/web"
+	"github.com/synadia-labs/go-bench-away/internal/worker"
+	"github.com/synadia-labs/go-bench-away/v1/client"
+
+	"github.com/google/subcommands"
+	"github.com/nats-io/nats-server/v2/server"
+)
+
+type localCmd struct {
+	baseCommand
+	workerFlags
+	storeDir string
+	natsHost string
+	natsPort int
+	webPort  int
+}
+
+func localCommand() subcommands.Command {
+	return &localCmd{
+		baseCommand: baseCommand{
+			name:     "local",
+			synopsis: "starts an embedded NATS server, a worker and the web interface in a single process",
+			usage:    "local [options]\n",
+		},
+	}
+}
+
+func (cmd *localCmd) SetFlags(f *flag.FlagSet) {
+	f.StringVar(&cmd.storeDir, "store_dir", "./go-bench-away-data", "Directory where the embedded server persists JetStream data")
+	f.StringVar(&cmd.natsHost, "nats_host", "127.0.0.1", "Interface the embedded NATS server listens on")
+	f.IntVar(&cmd.natsPort, "nats_port", 4222, "Port the embedded NATS server listens on")
+	f.IntVar(&cmd.webPort, "port", 8888, "Web interface port number")
+	cmd.workerFlags.setFlags(f)
+}
+
+func (cmd *localCmd) Execute(ctx context.Context, f *flag.FlagSet, _ ...interface{}) subcommands.ExitStatus {
+	if rootOptions.verbose {
+		fmt.Printf("%s args: %v\n", cmd.name, f.Args())
+	}
+
+	err := os.MkdirAll(cmd.storeDir, 0750)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error creating store directory: %v\n", err)
+		return subcommands.ExitFailure
+	}
+
+	ns, err := server.NewServer(&server.Options{
+		ServerName: "go-bench-away-local",
+		Host:       cmd.natsHost,
+		Port:       cmd.natsPort,
+		JetStream:  true,
+		StoreDir:   cmd.storeDir,
+		NoSigs:     true,
+	})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error creating embedded server: %v\n", err)
+		return subcommands.ExitFailure
+	}
+
+	if rootOptions.verbose {
+		ns.ConfigureLogger()
+	}
+
+	go ns.Start()
+	defer ns.Shutdown()
+
+	if !ns.ReadyForConnections(10 * time.Second) {
+		fmt.Fprintf(os.Stderr, "Embedded server not ready for connections\n")
+		return subcommands.ExitFailure
+	}
+
+	serverUrl := ns.ClientURL()
+	fmt.Printf("Embedded NATS server listening on: %s (store: %s)\n", serverUrl, cmd.storeDir)
+
+	err = cmd.initSchema(serverUrl)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		return subcommands.ExitFailure
+	}
+
+	c, err := client.NewClient(
+		serverUrl,
+		"",
+		rootOptions.namespace,
+		client.Verbose(rootOptions.verbose),
+		client.InitJobsQueue(),
+		client.InitJobsRepository(),
+		client.InitArtifactsStore(),
+		client.InitWorkersRegistry(),
+		client.WithClientName("go-bench-away Local"),
+	)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		return subcommands.ExitFailure
+	}
+	defer c.Close()
+
+	cfg, err := cmd.workerFlags.config()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		return subcommands.ExitFailure
+	}
+
+	w, err := worker.NewWorker(c, cfg)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		return subcommands.ExitFailure
+	}
+
+	s := &http.Server{
+		Addr:         fmt.Sprintf(":%d", cmd.webPort),
+		Handler:      web.NewHandler(c),
+		ReadTimeout:  10 * time.Second,
+		WriteTimeout: 10 * time.Second,
+	}
+
+	ctx, cancel := handleShutdownSignals(ctx, w, cmd.shutdownTimeout)
+	defer cancel()
+
+	webErrCh := make(chan error, 1)
+	go func() {
+		fmt.Printf("Listening on: %s\n", s.Addr)
+		webErrCh <- s.ListenAndServe()
+		// Web server stopped, stop the worker too
+		cancel()
+	}()
+	defer s.Close()
+
+	workerErr := w.Run(ctx)
+
+	select {
+	case webErr := <-webErrCh:
+		if webErr != nil && webErr != http.ErrServerClosed {
+			fmt.Fprintf(os.Stderr, "%v\n", webErr)
+			return subcommands.ExitFailure
+		}
+	default:
+	}
+
+	if workerErr != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", workerErr)
+		return subcommands.ExitFailure
+	}
+
+	return subcommands.ExitSuccess
+}
+
+// Create (or upgrade) stream, KV store and object store
+func (cmd *localCmd) initSchema(serverUrl string) error {
+	c, err := client.NewClient(
+		serverUrl,
+		"",
+		rootOptions.namespace,
+		client.Verbose(rootOptions.verbose),
+	)
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+
+	return initSchema(c)
+}
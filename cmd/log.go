@@ -2,9 +2,11 @@ package cmd
 
 import (
 	"context"
+	"errors"
 	"flag"
 	"fmt"
 	"os"
+	"os/signal"
 
 	"github.com/synadia-labs/go-bench-away/v1/client"
 
@@ -13,19 +15,24 @@ import (
 
 type logCmd struct {
 	baseCommand
+	attempt uint
+	follow  bool
 }
 
 func logCommand() subcommands.Command {
 	return &logCmd{
 		baseCommand: baseCommand{
 			name:     "log",
-			synopsis: "Shows the log file of a completed job",
-			usage:    "log <jobId>\n",
+			synopsis: "Shows the log file of a job, or follows it while the job runs",
+			usage:    "log [options] <jobId>\n",
 		},
 	}
 }
 
 func (cmd *logCmd) SetFlags(f *flag.FlagSet) {
+	f.UintVar(&cmd.attempt, "attempt", 0, "Show the log of the given attempt, for jobs that were retried (default: last)")
+	f.BoolVar(&cmd.follow, "follow", false, "Stream the log of a running (or queued) job as it is written")
+	f.BoolVar(&cmd.follow, "f", false, "Shorthand for -follow")
 }
 
 func (cmd *logCmd) Execute(_ context.Context, f *flag.FlagSet, _ ...interface{}) subcommands.ExitStatus {
@@ -61,10 +68,30 @@ func (cmd *logCmd) Execute(_ context.Context, f *flag.FlagSet, _ ...interface{})
 		return subcommands.ExitFailure
 	}
 
-	if job.Log == "" {
-		fmt.Printf("No log artifact for job %s\n", job.Id)
+	attempt := job.CurrentAttempt()
+	if cmd.attempt > 0 {
+		attempt = cmd.attempt
+	}
+
+	if cmd.follow && !job.IsCompleted() && attempt == job.CurrentAttempt() {
+		// Stop following on interrupt
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+		defer stop()
+		err := c.FollowJobLog(ctx, job.Id, attempt, os.Stdout)
+		if err != nil && !errors.Is(err, context.Canceled) {
+			fmt.Fprintf(os.Stderr, "Failed to follow log: %v\n", err)
+			return subcommands.ExitFailure
+		}
+		return subcommands.ExitSuccess
+	}
+
+	if logKey, err := job.AttemptLog(attempt); err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		return subcommands.ExitFailure
+	} else if logKey == "" {
+		fmt.Printf("No log artifact for job %s (attempt %d)\n", job.Id, attempt)
 	} else {
-		err := c.LoadLogArtifact(job, os.Stdout)
+		err := c.LoadAttemptLogArtifact(job, attempt, os.Stdout)
 		if err != nil {
 			fmt.Fprintf(os.Stderr, "Download failed: %v\n", err)
 			return subcommands.ExitFailure
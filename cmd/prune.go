@@ -0,0 +1,108 @@
+package cmd
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/synadia-labs/go-bench-away/v1/client"
+	"github.com/synadia-labs/go-bench-away/v1/core"
+
+	"github.com/google/subcommands"
+)
+
+type pruneCmd struct {
+	baseCommand
+	retentionFlags
+	dryRun   bool
+	altQueue string
+}
+
+func pruneCommand() subcommands.Command {
+	return &pruneCmd{
+		baseCommand: baseCommand{
+			name:     "prune",
+			synopsis: "Delete old completed jobs and their artifacts, or just their logs, according to a retention policy",
+			usage:    "prune -keep_days N [-keep_logs_days N] [-keep_label selector] [-keep_per_ref N] [-dry_run]\n",
+		},
+	}
+}
+
+func (cmd *pruneCmd) SetFlags(f *flag.FlagSet) {
+	cmd.retentionFlags.setFlags(f)
+	f.BoolVar(&cmd.dryRun, "dry_run", false, "List the jobs that would be pruned, without deleting anything")
+	f.StringVar(&cmd.altQueue, "queue", "", "Prune jobs of a non-default queue with the specified name")
+}
+
+func (cmd *pruneCmd) Execute(_ context.Context, f *flag.FlagSet, _ ...interface{}) subcommands.ExitStatus {
+	if rootOptions.verbose {
+		fmt.Printf("%s args: %v\n", cmd.name, f.Args())
+	}
+
+	policy, err := cmd.policy()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		return subcommands.ExitUsageError
+	} else if policy.IsEmpty() {
+		fmt.Fprintf(os.Stderr, "Pass -keep_days or -keep_logs_days\n")
+		return subcommands.ExitUsageError
+	}
+
+	clientOpts := []client.Option{
+		client.Verbose(rootOptions.verbose),
+		client.InitJobsQueue(),
+		client.InitJobsRepository(),
+		client.InitArtifactsStore(),
+	}
+
+	if cmd.altQueue != "" {
+		clientOpts = append(clientOpts, client.WithAltQueue(cmd.altQueue))
+	}
+
+	c, err := client.NewClient(
+		rootOptions.natsServerUrl,
+		rootOptions.credentials,
+		rootOptions.namespace,
+		clientOpts...,
+	)
+
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		return subcommands.ExitFailure
+	}
+	defer c.Close()
+
+	fmt.Printf("Pruning jobs (%s)...\n", policy)
+
+	decisions, err := c.PruneJobs(policy, cmd.dryRun)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return subcommands.ExitFailure
+	}
+
+	deleted, logsDeleted := 0, 0
+	for _, decision := range decisions {
+		fmt.Printf(
+			" %s %s (%s %s): %s, %s\n",
+			decision.Job.Status.Icon(),
+			decision.Job.Id,
+			decision.Job.Parameters.GitRemote,
+			decision.Job.Parameters.GitRef,
+			decision.Action,
+			decision.Reason,
+		)
+		if decision.Action == core.PruneJob {
+			deleted++
+		} else {
+			logsDeleted++
+		}
+	}
+
+	if cmd.dryRun {
+		fmt.Printf("Would delete %d jobs, and the logs of %d jobs (dry run)\n", deleted, logsDeleted)
+	} else {
+		fmt.Printf("Deleted %d jobs, and the logs of %d jobs\n", deleted, logsDeleted)
+	}
+	return subcommands.ExitSuccess
+}
@@ -0,0 +1,39 @@
+package cmd
+
+import (
+	"flag"
+	"time"
+
+	"github.com/synadia-labs/go-bench-away/v1/core"
+)
+
+const day = 24 * time.Hour
+
+// Retention policy flags, shared by the prune command and the web server periodic prune
+type retentionFlags struct {
+	keepDays     int
+	keepLogsDays int
+	keepLabels   string
+	keepPerRef   int
+}
+
+func (rf *retentionFlags) setFlags(f *flag.FlagSet) {
+	f.IntVar(&rf.keepDays, "keep_days", 0, "Delete completed jobs older than this many days (0 to keep all)")
+	f.IntVar(&rf.keepLogsDays, "keep_logs_days", 0,
+		"Delete logs and artifacts other than results of completed jobs older than this many days (0 to keep all)")
+	f.StringVar(&rf.keepLabels, "keep_label", "", "Always keep jobs matching this label selector (e.g. \"release\")")
+	f.IntVar(&rf.keepPerRef, "keep_per_ref", 0, "Always keep this many most recent jobs of each ref")
+}
+
+func (rf *retentionFlags) policy() (core.RetentionPolicy, error) {
+	keepLabels, err := core.ParseLabelSelector(rf.keepLabels)
+	if err != nil {
+		return core.RetentionPolicy{}, err
+	}
+	return core.RetentionPolicy{
+		MaxAge:     time.Duration(rf.keepDays) * day,
+		KeepLabels: keepLabels,
+		KeepPerRef: rf.keepPerRef,
+		LogsMaxAge: time.Duration(rf.keepLogsDays) * day,
+	}, nil
+}
@@ -78,6 +78,7 @@ func Run(args []string) int {
 			initCommand(),
 			wipeCommand(),
 			failStaleCommand(),
+			pruneCommand(),
 		},
 		"submit, monitor, cancel": {
 			submitCommand(),
@@ -97,6 +98,9 @@ func Run(args []string) int {
 		},
 		"worker": {
 			workerCommand(),
+			localCommand(),
+			workersCommand(),
+			drainCommand(),
 		},
 		"explore job status": {
 			listCommand(),
@@ -14,11 +14,13 @@ func TestRun(t *testing.T) {
 		{[]string{}, 2},
 		{[]string{"blergh"}, 2},
 		{[]string{"help", "foo"}, 2},
+		{[]string{"prune"}, 2},
 		// Valid
 		{[]string{"commands"}, 0},
 		{[]string{"flags"}, 0},
 		{[]string{"help"}, 0},
 		{[]string{"help", "version"}, 0},
+		{[]string{"help", "prune"}, 0},
 		{[]string{"-v", "version"}, 0},
 	}
 
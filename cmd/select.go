@@ -0,0 +1,41 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/synadia-labs/go-bench-away/v1/client"
+	"github.com/synadia-labs/go-bench-away/v1/core"
+)
+
+// Resolve the jobs to include in a report: the job IDs passed explicitly, followed by all the
+// succeeded jobs matching the label selector (oldest first).
+func selectReportJobs(c *client.Client, jobIds []string, selectorExpr string) ([]string, error) {
+	if selectorExpr == "" {
+		return jobIds, nil
+	}
+
+	selector, err := core.ParseLabelSelector(selectorExpr)
+	if err != nil {
+		return nil, err
+	}
+
+	jobs, _, err := c.LoadJobsByKV(0, 0, []core.JobStatus{core.Succeeded}, selector)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(jobs) == 0 {
+		return nil, fmt.Errorf("No succeeded jobs match selector: '%s'", selector)
+	}
+
+	selectedJobIds := append([]string{}, jobIds...)
+	for i := len(jobs) - 1; i >= 0; i-- {
+		selectedJobIds = append(selectedJobIds, jobs[i].Id)
+	}
+
+	if rootOptions.verbose {
+		fmt.Printf("Selected jobs: %v\n", selectedJobIds)
+	}
+
+	return selectedJobIds, nil
+}
@@ -20,6 +20,7 @@ type singleReportCmd struct {
 	hiddenResultsTable  bool
 	outputPath          string
 	reportCfg           reports.ReportConfig
+	selector            string
 }
 
 func singleReportCommand() subcommands.Command {
@@ -34,6 +35,7 @@ func singleReportCommand() subcommands.Command {
 
 func (cmd *singleReportCmd) SetFlags(f *flag.FlagSet) {
 	f.StringVar(&cmd.outputPath, "output", "report.html", "Output report (HTML)")
+	f.StringVar(&cmd.selector, "select", "", "Also include succeeded jobs matching this label selector (e.g. \"campaign=gc,!nightly\")")
 	f.StringVar(&cmd.reportCfg.Title, "title", "", "Title of the report (auto-generated if empty)")
 	f.BoolVar(&cmd.skipTimeOp, "no_timeop", false, "Do not include time/op graph and table")
 	f.BoolVar(&cmd.skipSpeed, "no_speed", false, "Do not include speed graph and table")
@@ -46,13 +48,11 @@ func (cmd *singleReportCmd) Execute(_ context.Context, f *flag.FlagSet, _ ...int
 		fmt.Printf("%s args: %v\n", cmd.name, f.Args())
 	}
 
-	if len(f.Args()) != 1 {
+	if len(f.Args()) != 1 && cmd.selector == "" {
 		fmt.Fprintf(os.Stderr, "Pass one job Id argument\n")
 		return subcommands.ExitUsageError
 	}
 
-	jobId := f.Args()[0]
-
 	c, err := client.NewClient(
 		rootOptions.natsServerUrl,
 		rootOptions.credentials,
@@ -68,6 +68,17 @@ func (cmd *singleReportCmd) Execute(_ context.Context, f *flag.FlagSet, _ ...int
 	}
 	defer c.Close()
 
+	jobIds, err := selectReportJobs(c, f.Args(), cmd.selector)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		return subcommands.ExitFailure
+	} else if len(jobIds) != 1 {
+		fmt.Fprintf(os.Stderr, "Need exactly one job, selected: %v\n", jobIds)
+		return subcommands.ExitUsageError
+	}
+
+	jobId := jobIds[0]
+
 	dataTable, err := reports.CreateDataTable(c, jobId)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "%v\n", err)
@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"os"
 	"os/user"
+	"strings"
 	"time"
 
 	"github.com/synadia-labs/go-bench-away/v1/client"
@@ -16,8 +17,10 @@ import (
 
 type submitCmd struct {
 	baseCommand
-	params   core.JobParameters
-	altQueue string
+	params           core.JobParameters
+	altQueue         string
+	after            string
+	dependencyPolicy core.DependencyPolicy
 }
 
 func submitCommand() subcommands.Command {
@@ -42,6 +45,22 @@ func (cmd *submitCmd) SetFlags(f *flag.FlagSet) {
 	f.StringVar(&cmd.params.GoPath, "go_path", "", "Run using a custom Go (default looks for `go` in $PATH)")
 	f.StringVar(&cmd.params.GoExperiment, "go_experiment", "", "Run using a custom Go experimentflag (optional)")
 	f.StringVar(&cmd.params.CleanupCmd, "cleanup_command", "", "Command to execute after tests have run")
+	f.StringVar(&cmd.params.TestCPUs, "cpu", "", "Comma-separated list of GOMAXPROCS values to run benchmarks with (optional)")
+	f.BoolVar(&cmd.params.BenchMem, "benchmem", false, "Report memory allocation statistics")
+	f.StringVar(&cmd.params.BuildTags, "tags", "", "Comma-separated list of build tags (optional)")
+	f.StringVar(&cmd.params.GcFlags, "gcflags", "", "Arguments to pass to the compiler, e.g. '-N -l' (optional)")
+	f.StringVar(&cmd.params.LdFlags, "ldflags", "", "Arguments to pass to the linker (optional)")
+	f.StringVar(&cmd.params.GoFlags, "goflags", "", "Flags applied to all go commands, as GOFLAGS (optional)")
+	f.BoolVar(&cmd.params.CleanBuildCache, "clean_build_cache", false, "Build with an empty Go build cache")
+	f.Var(&cmd.params.Profiles, "profile", fmt.Sprintf("Comma-separated list of profiles to collect (%s)", core.ProfileKindsAll))
+	f.Var(&cmd.params.Env, "env", "Set an environment variable for the benchmarks run, e.g. GOGC=200 (repeatable)")
+	f.Var(&cmd.params.Labels, "label", "Attach a key=value label to the job (repeatable)")
+	f.Var(&cmd.params.Priority, "priority", "Job priority (low, normal, high, urgent)")
+	f.UintVar(&cmd.params.Retry.MaxAttempts, "max_attempts", 1, "Max number of attempts if the job fails for a -retry_on reason")
+	f.Var(&cmd.params.Retry.Categories, "retry_on",
+		fmt.Sprintf("Failure categories retried (default: %s)", core.InfrastructureFailures))
+	f.StringVar(&cmd.after, "after", "", "Run only after the given jobs completed (comma separated job IDs)")
+	f.Var(&cmd.dependencyPolicy, "on_dependency_failure", "What to do if a job passed to -after fails (cancel, fail, run)")
 	f.StringVar(&cmd.altQueue, "queue", "", "Publish job to a non-default queue with the specified name")
 }
 
@@ -81,7 +100,14 @@ func (cmd *submitCmd) Execute(_ context.Context, f *flag.FlagSet, _ ...interface
 
 	cmd.params.Username = u.Username
 
-	job, err := c.SubmitJob(cmd.params)
+	var dependsOn []string
+	for _, id := range strings.Split(cmd.after, ",") {
+		if id = strings.TrimSpace(id); id != "" {
+			dependsOn = append(dependsOn, id)
+		}
+	}
+
+	job, err := c.SubmitJobAfter(cmd.params, dependsOn, cmd.dependencyPolicy)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "%v\n", err)
 		return subcommands.ExitFailure
@@ -21,6 +21,7 @@ type trendReportCmd struct {
 	hiddenResultsTable  bool
 	outputPath          string
 	reportCfg           reports.ReportConfig
+	selector            string
 	customLabels        string
 }
 
@@ -36,6 +37,7 @@ func trendReportCommand() subcommands.Command {
 
 func (cmd *trendReportCmd) SetFlags(f *flag.FlagSet) {
 	f.StringVar(&cmd.outputPath, "output", "report.html", "Output report (HTML)")
+	f.StringVar(&cmd.selector, "select", "", "Also include succeeded jobs matching this label selector (e.g. \"campaign=gc,!nightly\")")
 	f.StringVar(&cmd.reportCfg.Title, "title", "", "Title of the report (auto-generated if empty)")
 	f.BoolVar(&cmd.skipTimeOp, "no_timeop", false, "Do not include time/op graph and table")
 	f.BoolVar(&cmd.skipSpeed, "no_speed", false, "Do not include speed graph and table")
@@ -50,8 +52,8 @@ func (cmd *trendReportCmd) Execute(_ context.Context, f *flag.FlagSet, _ ...inte
 	}
 
 	jobIds := f.Args()
-	if len(jobIds) < 2 {
-		fmt.Fprintf(os.Stderr, "Need at least two job Id arguments\n")
+	if len(jobIds) < 2 && cmd.selector == "" {
+		fmt.Fprintf(os.Stderr, "Need at least two job Id arguments or a label selector\n")
 		return subcommands.ExitUsageError
 	}
 
@@ -70,6 +72,15 @@ func (cmd *trendReportCmd) Execute(_ context.Context, f *flag.FlagSet, _ ...inte
 	}
 	defer c.Close()
 
+	jobIds, err = selectReportJobs(c, jobIds, cmd.selector)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		return subcommands.ExitFailure
+	} else if len(jobIds) < 2 {
+		fmt.Fprintf(os.Stderr, "Need at least two jobs, selected: %v\n", jobIds)
+		return subcommands.ExitUsageError
+	}
+
 	dataTable, err := reports.CreateDataTable(c, jobIds...)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "%v\n", err)
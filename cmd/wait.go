@@ -9,7 +9,6 @@ import (
 	"time"
 
 	"github.com/synadia-labs/go-bench-away/v1/client"
-	"github.com/synadia-labs/go-bench-away/v1/core"
 
 	"github.com/google/subcommands"
 )
@@ -79,7 +78,7 @@ func (cmd *waitCmd) Execute(_ context.Context, f *flag.FlagSet, _ ...interface{}
 				fmt.Printf("%s: %s\n", jobId, job.Status)
 			}
 
-			if job.Status == core.Failed || job.Status == core.Succeeded {
+			if job.IsCompleted() {
 				return
 			}
 
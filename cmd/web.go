@@ -10,14 +10,17 @@ import (
 
 	"github.com/synadia-labs/go-bench-away/internal/web"
 	"github.com/synadia-labs/go-bench-away/v1/client"
+	"github.com/synadia-labs/go-bench-away/v1/core"
 
 	"github.com/google/subcommands"
 )
 
 type webCmd struct {
 	baseCommand
-	port     int
-	altQueue string
+	retentionFlags
+	port          int
+	altQueue      string
+	pruneInterval time.Duration
 }
 
 func webCommand() subcommands.Command {
@@ -33,7 +36,9 @@ func webCommand() subcommands.Command {
 func (cmd *webCmd) SetFlags(f *flag.FlagSet) {
 	f.IntVar(&cmd.port, "port", 8888, "Port number")
 	f.StringVar(&cmd.altQueue, "queue", "", "Load jobs from a non-default queue with the specified name")
-
+	f.DurationVar(&cmd.pruneInterval, "prune_interval", 0,
+		"Periodically prune jobs according to the retention policy flags (0 to disable)")
+	cmd.retentionFlags.setFlags(f)
 }
 
 func (cmd *webCmd) Execute(_ context.Context, f *flag.FlagSet, _ ...interface{}) subcommands.ExitStatus {
@@ -46,6 +51,16 @@ func (cmd *webCmd) Execute(_ context.Context, f *flag.FlagSet, _ ...interface{})
 		client.InitJobsQueue(),
 		client.InitJobsRepository(),
 		client.InitArtifactsStore(),
+		client.InitWorkersRegistryIfExists(),
+	}
+
+	policy, err := cmd.policy()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		return subcommands.ExitUsageError
+	} else if cmd.pruneInterval > 0 && policy.IsEmpty() {
+		fmt.Fprintf(os.Stderr, "Pass -keep_days or -keep_logs_days with -prune_interval\n")
+		return subcommands.ExitUsageError
 	}
 
 	if cmd.altQueue != "" {
@@ -65,6 +80,10 @@ func (cmd *webCmd) Execute(_ context.Context, f *flag.FlagSet, _ ...interface{})
 	}
 	defer c.Close()
 
+	if cmd.pruneInterval > 0 {
+		go pruneJobsPeriodically(c, policy, cmd.pruneInterval)
+	}
+
 	handler := web.NewHandler(c)
 
 	s := &http.Server{
@@ -84,3 +103,19 @@ func (cmd *webCmd) Execute(_ context.Context, f *flag.FlagSet, _ ...interface{})
 
 	return subcommands.ExitSuccess
 }
+
+// Apply the retention policy at the given interval, starting immediately
+func pruneJobsPeriodically(c *client.Client, policy core.RetentionPolicy, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		fmt.Printf("Pruning jobs (%s)...\n", policy)
+		if decisions, err := c.PruneJobs(policy, false); err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to prune jobs: %v\n", err)
+		} else {
+			fmt.Printf("Pruned %d jobs\n", len(decisions))
+		}
+		<-ticker.C
+	}
+}
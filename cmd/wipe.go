@@ -60,6 +60,8 @@ func (cmd *wipeCmd) Execute(_ context.Context, f *flag.FlagSet, _ ...interface{}
 		c.DeleteJobsQueue,
 		c.DeleteJobsRepository,
 		c.DeleteArtifactsStore,
+		c.DeleteWorkersRegistry,
+		c.DeleteLogsStream,
 	}
 
 	for _, fun := range initFuncs {
@@ -5,6 +5,9 @@ import (
 	"flag"
 	"fmt"
 	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
 	"github.com/synadia-labs/go-bench-away/internal/worker"
 	"github.com/synadia-labs/go-bench-away/v1/client"
@@ -14,9 +17,8 @@ import (
 
 type workerCmd struct {
 	baseCommand
-	jobsDir             string
-	altQueue            string
-	gitRemoteFilterExpr string
+	workerFlags
+	altQueue string
 }
 
 func workerCommand() subcommands.Command {
@@ -30,9 +32,8 @@ func workerCommand() subcommands.Command {
 }
 
 func (cmd *workerCmd) SetFlags(f *flag.FlagSet) {
-	f.StringVar(&cmd.jobsDir, "jobs_dir", "", "Directory where jobs are staged (defaults to os.MkdirTemp)")
 	f.StringVar(&cmd.altQueue, "queue", "", "Consume job from a non-default queue with the specified name")
-	f.StringVar(&cmd.gitRemoteFilterExpr, "gitRemoteFilterExpr", "", "Regex to restrict which git remotes can be targeted")
+	cmd.workerFlags.setFlags(f)
 }
 
 func (cmd *workerCmd) Execute(ctx context.Context, f *flag.FlagSet, _ ...interface{}) subcommands.ExitStatus {
@@ -45,9 +46,14 @@ func (cmd *workerCmd) Execute(ctx context.Context, f *flag.FlagSet, _ ...interfa
 		client.InitJobsQueue(),
 		client.InitJobsRepository(),
 		client.InitArtifactsStore(),
+		client.InitWorkersRegistryIfExists(),
 		client.WithClientName("go-bench-away Worker"),
 	}
 
+	if hostname, err := os.Hostname(); err == nil {
+		clientOpts = append(clientOpts, client.WithActor(hostname))
+	}
+
 	if cmd.altQueue != "" {
 		clientOpts = append(
 			clientOpts,
@@ -68,27 +74,21 @@ func (cmd *workerCmd) Execute(ctx context.Context, f *flag.FlagSet, _ ...interfa
 	}
 	defer c.Close()
 
-	if cmd.jobsDir != "" {
-		err := os.MkdirAll(cmd.jobsDir, 0750)
-		if err != nil {
-			fmt.Fprintf(os.Stderr, "Error creating jobs directory: %v\n", err)
-			return subcommands.ExitFailure
-		}
-	}
-
-	var allowedGitRemoteExpr []string
-	if cmd.gitRemoteFilterExpr != "" {
-		allowedGitRemoteExpr = []string{
-			cmd.gitRemoteFilterExpr,
-		}
+	cfg, err := cmd.workerFlags.config()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		return subcommands.ExitFailure
 	}
 
-	w, err := worker.NewWorker(c, cmd.jobsDir, allowedGitRemoteExpr)
+	w, err := worker.NewWorker(c, cfg)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "%v\n", err)
 		return subcommands.ExitFailure
 	}
 
+	ctx, interrupt := handleShutdownSignals(ctx, w, cmd.shutdownTimeout)
+	defer interrupt()
+
 	err = w.Run(ctx)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "%v\n", err)
@@ -97,3 +97,106 @@ func (cmd *workerCmd) Execute(ctx context.Context, f *flag.FlagSet, _ ...interfa
 
 	return subcommands.ExitSuccess
 }
+
+// On the first SIGTERM or SIGINT, drain the worker so it exits after the current job.
+// The returned context is closed (interrupting the current job) after the timeout, or on a second signal.
+func handleShutdownSignals(ctx context.Context, w worker.Worker, timeout time.Duration) (context.Context, context.CancelFunc) {
+	ctx, interrupt := context.WithCancel(ctx)
+	signals := make(chan os.Signal, 2)
+	signal.Notify(signals, syscall.SIGTERM, syscall.SIGINT)
+	go func() {
+		defer signal.Stop(signals)
+		select {
+		case sig := <-signals:
+			w.Drain(fmt.Sprintf("received %v", sig))
+		case <-ctx.Done():
+			return
+		}
+		select {
+		case sig := <-signals:
+			fmt.Printf("Received %v, interrupting current job\n", sig)
+		case <-time.After(timeout):
+			fmt.Printf("Current job did not complete within %v, interrupting it\n", timeout)
+		case <-ctx.Done():
+			return
+		}
+		interrupt()
+	}()
+	return ctx, interrupt
+}
+
+// Worker flags, shared by the worker and local commands
+type workerFlags struct {
+	jobsDir             string
+	gitRemoteFilterExpr string
+	shutdownTimeout     time.Duration
+	slots               int
+	cpusPerSlot         int
+	environmentPolicy   worker.EnvironmentPolicy
+	scriptTemplatePath  string
+	gitCacheDir         string
+	gitCacheMaxSizeMB   int64
+	goModCacheDir       string
+	goBuildCacheDir     string
+	resourceLimits      worker.ResourceLimits
+	memoryMaxMB         int64
+	diskMaxMB           int64
+}
+
+func (wf *workerFlags) setFlags(f *flag.FlagSet) {
+	f.StringVar(&wf.jobsDir, "jobs_dir", "", "Directory where jobs are staged (defaults to os.MkdirTemp)")
+	f.StringVar(&wf.gitRemoteFilterExpr, "gitRemoteFilterExpr", "", "Regex to restrict which git remotes can be targeted")
+	f.DurationVar(&wf.shutdownTimeout, "shutdown_timeout", 5*time.Minute,
+		"On SIGTERM or SIGINT, time to let the current job complete before interrupting and requeueing it")
+	f.StringVar(&wf.scriptTemplatePath, "script_template", "", "Path of a custom benchmark script template (see README)")
+	f.StringVar(&wf.gitCacheDir, "git_cache_dir", "", "Directory where git mirrors of remotes are cached (optional)")
+	f.Int64Var(&wf.gitCacheMaxSizeMB, "git_cache_max_mb", 0, "Evict least recently used git mirrors above this size (0: no limit)")
+	f.StringVar(&wf.goModCacheDir, "gomodcache", "", "Go module cache shared by jobs (default: the worker user one)")
+	f.StringVar(&wf.goBuildCacheDir, "gocache", "", "Go build cache shared by jobs (default: the worker user one)")
+	f.Int64Var(&wf.memoryMaxMB, "job_memory_max_mb", 0, "Max memory of each job, in MiB (0: no limit)")
+	f.Float64Var(&wf.resourceLimits.CPUMax, "job_cpu_max", 0, "Max CPU bandwidth of each job, in CPUs (0: no limit)")
+	f.Int64Var(&wf.resourceLimits.PidsMax, "job_pids_max", 0, "Max number of processes and threads of each job (0: no limit)")
+	f.Int64Var(&wf.diskMaxMB, "job_disk_max_mb", 0, "Max size of each job directory, in MiB (0: no limit)")
+	f.StringVar(&wf.resourceLimits.CgroupRoot, "cgroup_root", "", "Cgroup (v2) under which jobs run (default: the worker's own)")
+	f.IntVar(&wf.slots, "slots", 1, "Number of jobs to run concurrently")
+	f.IntVar(&wf.cpusPerSlot, "cpus-per-slot", 0, "Pin each job slot to its own set of this many CPUs (0: no pinning)")
+	f.Float64Var(&wf.environmentPolicy.MaxLoadAverage, "env_max_load", 0, "Max load average to run a job (0: no limit)")
+	f.StringVar(&wf.environmentPolicy.Governor, "env_governor", "", "CPU governor required to run a job (e.g. performance)")
+	f.BoolVar(&wf.environmentPolicy.NoTurboBoost, "env_no_turbo", false, "Require turbo boost to be disabled to run a job")
+	f.BoolVar(&wf.environmentPolicy.NoSMT, "env_no_smt", false, "Require SMT (hyperthreading) to be disabled to run a job")
+	f.BoolVar(&wf.environmentPolicy.Enforce, "env_enforce", false, "Fail jobs violating the environment policy (default: warn)")
+}
+
+// Worker configuration from the flags, creating the jobs directory if needed
+func (wf *workerFlags) config() (worker.Config, error) {
+	if wf.jobsDir != "" {
+		if err := os.MkdirAll(wf.jobsDir, 0750); err != nil {
+			return worker.Config{}, fmt.Errorf("Error creating jobs directory: %v", err)
+		}
+	}
+
+	var allowedGitRemoteExpr []string
+	if wf.gitRemoteFilterExpr != "" {
+		allowedGitRemoteExpr = []string{
+			wf.gitRemoteFilterExpr,
+		}
+	}
+
+	resourceLimits := wf.resourceLimits
+	resourceLimits.MemoryMax = wf.memoryMaxMB << 20
+	resourceLimits.DiskMax = wf.diskMaxMB << 20
+
+	return worker.Config{
+		JobsDir:              wf.jobsDir,
+		AllowedGitRemoteExpr: allowedGitRemoteExpr,
+		Slots:                wf.slots,
+		CPUsPerSlot:          wf.cpusPerSlot,
+		EnvironmentPolicy:    wf.environmentPolicy,
+		ScriptTemplatePath:   wf.scriptTemplatePath,
+		GitCacheDir:          wf.gitCacheDir,
+		GitCacheMaxSize:      wf.gitCacheMaxSizeMB << 20,
+		GoModCacheDir:        wf.goModCacheDir,
+		GoBuildCacheDir:      wf.goBuildCacheDir,
+		ResourceLimits:       resourceLimits,
+	}, nil
+}
@@ -0,0 +1,94 @@
+package cmd
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/synadia-labs/go-bench-away/v1/client"
+
+	"github.com/google/subcommands"
+)
+
+type workersCmd struct {
+	baseCommand
+}
+
+func workersCommand() subcommands.Command {
+	return &workersCmd{
+		baseCommand: baseCommand{
+			name:     "workers",
+			synopsis: "lists live workers",
+			usage:    "workers\n",
+		},
+	}
+}
+
+func (cmd *workersCmd) SetFlags(f *flag.FlagSet) {
+}
+
+func (cmd *workersCmd) Execute(_ context.Context, f *flag.FlagSet, _ ...interface{}) subcommands.ExitStatus {
+	if rootOptions.verbose {
+		fmt.Printf("%s args: %v\n", cmd.name, f.Args())
+	}
+
+	c, err := client.NewClient(
+		rootOptions.natsServerUrl,
+		rootOptions.credentials,
+		rootOptions.namespace,
+		client.InitWorkersRegistry(),
+		client.Verbose(rootOptions.verbose),
+	)
+
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		return subcommands.ExitFailure
+	}
+	defer c.Close()
+
+	workers, err := c.LoadWorkers()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		return subcommands.ExitFailure
+	}
+
+	if len(workers) == 0 {
+		fmt.Printf("No live workers\n")
+		return subcommands.ExitSuccess
+	}
+
+	for _, worker := range workers {
+		currentJobs := "idle"
+		if len(worker.CurrentJobs) > 0 {
+			currentJobs = strings.Join(worker.CurrentJobs, ", ")
+		}
+		if worker.Draining {
+			currentJobs += " (draining)"
+		}
+		fmt.Printf(
+			"%s %s\n"+
+				"     - Queue: %s\n"+
+				"     - Slots: %d\n"+
+				"     - Current jobs: %s\n"+
+				"     - Uname: %s\n"+
+				"     - Version: %s\n"+
+				"     - Uptime: %s\n"+
+				"     - Last heartbeat: %v ago\n"+
+				"",
+			worker.WorkerInfo.Hostname,
+			worker.Id,
+			worker.Queue,
+			worker.Slots,
+			currentJobs,
+			worker.WorkerInfo.Uname,
+			worker.WorkerInfo.Version,
+			worker.Uptime(),
+			time.Since(worker.Heartbeat).Round(time.Second),
+		)
+	}
+
+	return subcommands.ExitSuccess
+}
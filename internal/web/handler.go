@@ -1,14 +1,20 @@
 package web
 
 import (
+	"context"
 	_ "embed"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"html/template"
+	"io"
 	"net/http"
+	"net/url"
+	"path"
 	"regexp"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/synadia-labs/go-bench-away/v1/core"
 	"github.com/synadia-labs/go-bench-away/v1/reports"
@@ -20,12 +26,18 @@ var indexTmpl string
 //go:embed html/queue.html.tmpl
 var queueTmpl string
 
-var jobResourceRegexp = regexp.MustCompile(`^/job/([[:xdigit:]]{8}-[[:xdigit:]]{4}-[[:xdigit:]]{4}-[[:xdigit:]]{4}-[[:xdigit:]]{12})/(log|script|results|record|plot|cancel)/?$`) //nolint:lll
+//go:embed html/workers.html.tmpl
+var workersTmpl string
+
+var jobResourceRegexp = regexp.MustCompile(`^/job/([[:xdigit:]]{8}-[[:xdigit:]]{4}-[[:xdigit:]]{4}-[[:xdigit:]]{4}-[[:xdigit:]]{12})/(log|live|script|results|record|artifacts|plot|cancel)/?$`) //nolint:lll
+
+var jobArtifactRegexp = regexp.MustCompile(`^/job/([[:xdigit:]]{8}-[[:xdigit:]]{4}-[[:xdigit:]]{4}-[[:xdigit:]]{4}-[[:xdigit:]]{12})/artifact/([A-Za-z0-9_.\-]+)$`) //nolint:lll
 
 type handler struct {
-	client        WebClient
-	indexTemplate *template.Template
-	queueTemplate *template.Template
+	client          WebClient
+	indexTemplate   *template.Template
+	queueTemplate   *template.Template
+	workersTemplate *template.Template
 }
 
 func NewHandler(c WebClient) http.Handler {
@@ -49,9 +61,10 @@ func NewHandler(c WebClient) http.Handler {
 		},
 	}
 	return &handler{
-		client:        c,
-		indexTemplate: template.Must(template.New("index").Parse(indexTmpl)),
-		queueTemplate: template.Must(template.New("queue").Funcs(funcMap).Parse(queueTmpl)),
+		client:          c,
+		indexTemplate:   template.Must(template.New("index").Parse(indexTmpl)),
+		queueTemplate:   template.Must(template.New("queue").Funcs(funcMap).Parse(queueTmpl)),
+		workersTemplate: template.Must(template.New("workers").Parse(workersTmpl)),
 	}
 }
 
@@ -71,6 +84,10 @@ func (h *handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		err = h.serveIndex(w)
 	} else if path == "/queue" || path == "/queue/" {
 		err = h.serveQueue(w, r)
+	} else if path == "/workers" || path == "/workers/" {
+		err = h.serveWorkers(w)
+	} else if groupMatches := jobArtifactRegexp.FindStringSubmatch(path); groupMatches != nil {
+		err = h.serveJobArtifact(w, r, groupMatches[1], groupMatches[2])
 	} else if strings.HasPrefix(path, "/job/") {
 		groupMatches := jobResourceRegexp.FindStringSubmatch(path)
 		if groupMatches == nil || len(groupMatches) != 3 {
@@ -79,7 +96,11 @@ func (h *handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		}
 		jobId, resource := groupMatches[1], groupMatches[2]
 
-		err = h.serveJobResource(w, jobId, resource)
+		if resource == "live" {
+			err = h.serveJobLiveLog(w, r, jobId)
+		} else {
+			err = h.serveJobResource(w, r, jobId, resource)
+		}
 	} else {
 		http.Error(w, "Bad request", http.StatusBadRequest)
 	}
@@ -99,7 +120,15 @@ func (h *handler) serveIndex(w http.ResponseWriter) error {
 		return err
 	}
 
-	return h.indexTemplate.Execute(w, qs)
+	tv := struct {
+		*core.QueueStatus
+		HasWorkersRegistry bool
+	}{
+		QueueStatus:        qs,
+		HasWorkersRegistry: h.client.HasWorkersRegistry(),
+	}
+
+	return h.indexTemplate.Execute(w, tv)
 }
 
 func (h *handler) serveQueue(w http.ResponseWriter, r *http.Request) error {
@@ -130,6 +159,13 @@ func (h *handler) serveQueue(w http.ResponseWriter, r *http.Request) error {
 		statuses = parseStatusFilter(statusParam)
 	}
 
+	labelsParam := r.URL.Query().Get("labels")
+	selector, err := core.ParseLabelSelector(labelsParam)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return nil
+	}
+
 	searchQuery := strings.TrimSpace(r.URL.Query().Get("search"))
 	if searchQuery != "" {
 		foundOffset, err := h.client.FindJobOffset(searchQuery)
@@ -141,14 +177,14 @@ func (h *handler) serveQueue(w http.ResponseWriter, r *http.Request) error {
 				limit = 10
 			}
 			newOffset := (foundOffset / limit) * limit
-			redirectUrl := fmt.Sprintf("/queue?offset=%d&limit=%d&highlight=%s&status=%s",
-				newOffset, limit, searchQuery, statusParam)
+			redirectUrl := fmt.Sprintf("/queue?offset=%d&limit=%d&highlight=%s&status=%s&labels=%s",
+				newOffset, limit, searchQuery, statusParam, url.QueryEscape(selector.String()))
 			http.Redirect(w, r, redirectUrl, http.StatusFound)
 			return nil
 		}
 	}
 
-	jobRecords, statusCounts, err := h.client.LoadJobsByKV(limit, offset, statuses)
+	jobRecords, statusCounts, err := h.client.LoadJobsByKV(limit, offset, statuses, selector)
 	if err != nil {
 		return err
 	}
@@ -181,6 +217,7 @@ func (h *handler) serveQueue(w http.ResponseWriter, r *http.Request) error {
 		TotalPages       int
 		PaginationTokens []interface{}
 		StatusFilter     string
+		LabelSelector    string
 	}{
 		QueueName:        h.client.QueueName(),
 		Jobs:             jobRecords,
@@ -191,10 +228,26 @@ func (h *handler) serveQueue(w http.ResponseWriter, r *http.Request) error {
 		TotalPages:       totalPages,
 		PaginationTokens: paginationTokens,
 		StatusFilter:     statusParam,
+		LabelSelector:    selector.String(),
 	}
 	return h.queueTemplate.Execute(w, tv)
 }
 
+func (h *handler) serveWorkers(w http.ResponseWriter) error {
+
+	if !h.client.HasWorkersRegistry() {
+		http.Error(w, "Workers registry not found (need to run init-schema?)", http.StatusNotFound)
+		return nil
+	}
+
+	workers, err := h.client.LoadWorkers()
+	if err != nil {
+		return err
+	}
+
+	return h.workersTemplate.Execute(w, workers)
+}
+
 func parseStatusFilter(param string) []core.JobStatus {
 	statusMap := map[string]core.JobStatus{
 		"submitted": core.Submitted,
@@ -202,6 +255,7 @@ func parseStatusFilter(param string) []core.JobStatus {
 		"failed":    core.Failed,
 		"succeeded": core.Succeeded,
 		"cancelled": core.Cancelled,
+		"timedout":  core.TimedOut,
 	}
 	var statuses []core.JobStatus
 	for _, s := range strings.Split(param, ",") {
@@ -248,7 +302,7 @@ func calculatePagination(current, total, window int) []interface{} {
 	return tokens
 }
 
-func (h *handler) serveJobResource(w http.ResponseWriter, jobId, resourceType string) error {
+func (h *handler) serveJobResource(w http.ResponseWriter, r *http.Request, jobId, resourceType string) error {
 
 	jobRecord, _, err := h.client.LoadJob(jobId)
 	if err != nil {
@@ -257,15 +311,23 @@ func (h *handler) serveJobResource(w http.ResponseWriter, jobId, resourceType st
 
 	switch resourceType {
 	case "log":
-		err = h.client.LoadLogArtifact(jobRecord, w)
+		err = h.serveRecordArtifact(w, r, jobRecord, jobRecord.Log)
 	case "script":
-		err = h.client.LoadScriptArtifact(jobRecord, w)
+		err = h.serveRecordArtifact(w, r, jobRecord, jobRecord.Script)
 	case "results":
-		err = h.client.LoadResultsArtifact(jobRecord, w)
+		err = h.serveRecordArtifact(w, r, jobRecord, jobRecord.Results)
 	case "record":
 		e := json.NewEncoder(w)
 		e.SetIndent("", "  ")
 		err = e.Encode(jobRecord)
+	case "artifacts":
+		var artifacts []core.ArtifactInfo
+		artifacts, err = h.client.ListArtifacts(jobId)
+		if err == nil {
+			e := json.NewEncoder(w)
+			e.SetIndent("", "  ")
+			err = e.Encode(artifacts)
+		}
 	case "plot":
 		err = h.serveJobResultsPlot(jobId, w)
 	case "cancel":
@@ -282,6 +344,111 @@ func (h *handler) serveJobResource(w http.ResponseWriter, jobId, resourceType st
 	return nil
 }
 
+// Stream the log of a running (or queued) job as it is written, until the job attempt ends.
+// Serves the log artifact once the job is completed.
+func (h *handler) serveJobLiveLog(w http.ResponseWriter, r *http.Request, jobId string) error {
+
+	jobRecord, _, err := h.client.LoadJob(jobId)
+	if err != nil {
+		return fmt.Errorf("Failed to load job '%s': %v", jobId, err)
+	}
+
+	if jobRecord.IsCompleted() {
+		return h.serveRecordArtifact(w, r, jobRecord, jobRecord.Log)
+	}
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	// Browsers buffer the start of responses to sniff their content type, which would hold back the first lines
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	rc := http.NewResponseController(w)
+	// The log is streamed for as long as the job runs, past the server write timeout
+	_ = rc.SetWriteDeadline(time.Time{})
+
+	lw := &flushingWriter{w: w, rc: rc}
+	err = h.client.FollowJobLog(r.Context(), jobId, jobRecord.CurrentAttempt(), lw)
+	if err != nil && !lw.written {
+		return fmt.Errorf("failed to follow log: %v", err)
+	} else if err != nil && !errors.Is(err, context.Canceled) {
+		// Headers are sent, errors can no longer be reported to the client
+		fmt.Printf("Error: failed to follow log of job %s: %v\n", jobId, err)
+	}
+
+	return nil
+}
+
+// Writer sending each write to the client immediately
+type flushingWriter struct {
+	w       io.Writer
+	rc      *http.ResponseController
+	written bool
+}
+
+func (fw *flushingWriter) Write(data []byte) (int, error) {
+	fw.written = true
+	n, err := fw.w.Write(data)
+	if err == nil {
+		err = fw.rc.Flush()
+	}
+	return n, err
+}
+
+// Serve the job artifact referenced by the job record with the given key
+func (h *handler) serveRecordArtifact(w http.ResponseWriter, r *http.Request, job *core.JobRecord, key string) error {
+	if key == "" {
+		return fmt.Errorf("missing artifact")
+	}
+	// Artifact keys are "jobs/<jobId>/<name>"
+	return h.serveJobArtifact(w, r, job.Id, path.Base(key))
+}
+
+// Serve a named job artifact, text is displayed and other content types (e.g. profiles) are downloaded.
+// Compressed artifacts are sent as stored to clients accepting their encoding, decompressed otherwise.
+func (h *handler) serveJobArtifact(w http.ResponseWriter, r *http.Request, jobId, name string) error {
+
+	reader, info, err := h.client.OpenStoredArtifact(jobId, name)
+	if err != nil {
+		return fmt.Errorf("failed to load artifact '%s': %v", name, err)
+	}
+	size := info.StoredSize
+	if info.Encoding != "" && !acceptsEncoding(r, info.Encoding) {
+		reader.Close()
+		if reader, info, err = h.client.OpenArtifact(jobId, name); err != nil {
+			return fmt.Errorf("failed to load artifact '%s': %v", name, err)
+		}
+		size = info.Size
+	} else if info.Encoding != "" {
+		w.Header().Set("Content-Encoding", info.Encoding)
+	}
+	defer reader.Close()
+
+	// The response depends on the request encodings, caches must not serve it to other clients
+	w.Header().Set("Vary", "Accept-Encoding")
+	if strings.HasPrefix(info.ContentType, "text/") {
+		// Browsers download text types they don't display (e.g. shell scripts), show them as plain text
+		w.Header().Set("Content-Type", core.TextContentType)
+	} else {
+		w.Header().Set("Content-Type", info.ContentType)
+		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"%s_%s\"", jobId, name))
+	}
+	w.Header().Set("Content-Length", strconv.FormatUint(size, 10))
+	// Headers are sent, errors can no longer be reported to the client
+	if _, err := io.Copy(w, reader); err != nil {
+		fmt.Printf("Error: failed to send artifact '%s': %v\n", name, err)
+	}
+
+	return nil
+}
+
+// Whether the request Accept-Encoding header lists the given encoding (ignoring quality values)
+func acceptsEncoding(r *http.Request, encoding string) bool {
+	for _, accepted := range strings.Split(r.Header.Get("Accept-Encoding"), ",") {
+		if name, _, _ := strings.Cut(accepted, ";"); strings.TrimSpace(name) == encoding {
+			return true
+		}
+	}
+	return false
+}
+
 func (h *handler) serveJobResultsPlot(jobId string, w http.ResponseWriter) error {
 
 	dataTable, err := reports.CreateDataTable(h.client, jobId)
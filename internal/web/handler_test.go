@@ -1,11 +1,16 @@
 package web
 
 import (
+	"bytes"
+	"compress/gzip"
+	"context"
 	"errors"
+	"fmt"
 	"io"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
+	"strconv"
 	"strings"
 	"testing"
 
@@ -15,14 +20,24 @@ import (
 type mockWebClient struct {
 	CapturedLimit      int
 	CapturedOffset     int
+	CapturedSelector   string
 	ReturnLoadJobsErr  error
 	ReturnQueueStatus  *core.QueueStatus
 	ReturnQueueStatErr error
 	ReturnJobs         []*core.JobRecord
 	ReturnStatusCounts map[core.JobStatus]int
+	ReturnWorkers      []*core.WorkerRecord
+	NoWorkersRegistry  bool
+	ReturnJob          *core.JobRecord
+	ReturnLiveLog      string
+	CapturedAttempt    uint
+	ReturnArtifact     string
+	ReturnArtifactInfo *core.ArtifactInfo
 }
 
-func (m *mockWebClient) LoadJob(jobId string) (*core.JobRecord, uint64, error) { return nil, 0, nil }
+func (m *mockWebClient) LoadJob(jobId string) (*core.JobRecord, uint64, error) {
+	return m.ReturnJob, 0, nil
+}
 func (m *mockWebClient) GetQueueStatus() (*core.QueueStatus, error) {
 	return m.ReturnQueueStatus, m.ReturnQueueStatErr
 }
@@ -32,8 +47,6 @@ func (m *mockWebClient) LoadRecentJobs(limit, offset int) ([]*core.JobRecord, er
 	return m.ReturnJobs, m.ReturnLoadJobsErr
 }
 func (m *mockWebClient) LoadResultsArtifact(job *core.JobRecord, w io.Writer) error { return nil }
-func (m *mockWebClient) LoadLogArtifact(job *core.JobRecord, w io.Writer) error     { return nil }
-func (m *mockWebClient) LoadScriptArtifact(job *core.JobRecord, w io.Writer) error  { return nil }
 func (m *mockWebClient) CancelJob(id string) error                                  { return nil }
 func (m *mockWebClient) QueueName() string                                          { return "test-queue" }
 func (m *mockWebClient) FindJobOffset(query string) (int, error)                    { return -1, nil }
@@ -45,14 +58,50 @@ func (m *mockWebClient) LoadJobs(limit, offset int, asc bool) ([]*core.JobRecord
 func (m *mockWebClient) LoadJobsFiltered(limit, offset int, asc bool, statuses []core.JobStatus) ([]*core.JobRecord, int, error) {
 	return m.ReturnJobs, 0, m.ReturnLoadJobsErr
 }
+func (m *mockWebClient) ListArtifacts(jobId string) ([]core.ArtifactInfo, error) {
+	return nil, nil
+}
+func (m *mockWebClient) OpenArtifact(jobId, name string) (io.ReadCloser, *core.ArtifactInfo, error) {
+	if m.ReturnArtifactInfo == nil || m.ReturnArtifactInfo.Name != name {
+		return nil, nil, fmt.Errorf("not found")
+	}
+	info := *m.ReturnArtifactInfo
+	info.Encoding = ""
+	return io.NopCloser(strings.NewReader(m.ReturnArtifact)), &info, nil
+}
+func (m *mockWebClient) OpenStoredArtifact(jobId, name string) (io.ReadCloser, *core.ArtifactInfo, error) {
+	reader, info, err := m.OpenArtifact(jobId, name)
+	if err != nil || m.ReturnArtifactInfo.Encoding != core.GzipEncoding {
+		return reader, info, err
+	}
+	var buf bytes.Buffer
+	gw := gzip.NewWriter(&buf)
+	_, _ = io.WriteString(gw, m.ReturnArtifact)
+	_ = gw.Close()
+	info.Encoding = core.GzipEncoding
+	info.StoredSize = uint64(buf.Len())
+	return io.NopCloser(&buf), info, nil
+}
+func (m *mockWebClient) FollowJobLog(ctx context.Context, jobId string, attempt uint, w io.Writer) error {
+	m.CapturedAttempt = attempt
+	_, err := io.WriteString(w, m.ReturnLiveLog)
+	return err
+}
+func (m *mockWebClient) HasWorkersRegistry() bool {
+	return !m.NoWorkersRegistry
+}
+func (m *mockWebClient) LoadWorkers() ([]*core.WorkerRecord, error) {
+	return m.ReturnWorkers, nil
+}
 func (m *mockWebClient) CountJobsByStatus() (map[core.JobStatus]int, error) {
 	return nil, nil
 }
 func (m *mockWebClient) LoadJobsByKV( //nolint:lll
-	limit, offset int, statuses []core.JobStatus,
+	limit, offset int, statuses []core.JobStatus, selector core.LabelSelector,
 ) ([]*core.JobRecord, map[core.JobStatus]int, error) {
 	m.CapturedLimit = limit
 	m.CapturedOffset = offset
+	m.CapturedSelector = selector.String()
 	counts := m.ReturnStatusCounts
 	if counts == nil {
 		counts = map[core.JobStatus]int{}
@@ -129,6 +178,21 @@ func TestServeQueuePagination(t *testing.T) {
 			mockLoadErr:    errors.New("db error"),
 			expectedStatus: http.StatusInternalServerError,
 		},
+		{
+			name:           "Label selector",
+			queryParams:    map[string]string{"labels": "pr=1234,!nightly", "status": "all"},
+			mockTotalObj:   &core.QueueStatus{SubmittedCount: 20},
+			expectedStatus: http.StatusOK,
+			expectedLimit:  10,
+			expectedSubstr: []string{
+				"labels=pr%3d1234%2c%21nightly",
+			},
+		},
+		{
+			name:           "Invalid label selector",
+			queryParams:    map[string]string{"labels": "pr=1234,=foo"},
+			expectedStatus: http.StatusBadRequest,
+		},
 		{
 			name:           "Custom limit parsing",
 			queryParams:    map[string]string{"limit": "20"},
@@ -238,6 +302,11 @@ func TestJobResourcesRegexp(t *testing.T) {
 			expectedJobId:    "2fb41f25-7e17-4383-9e08-8ab115152db2",
 			expectedResource: "script",
 		},
+		{
+			input:            "/job/2fb41f25-7e17-4383-9e08-8ab115152db2/live",
+			expectedJobId:    "2fb41f25-7e17-4383-9e08-8ab115152db2",
+			expectedResource: "live",
+		},
 	}
 
 	for _, tc := range expectMatchCases {
@@ -247,6 +316,126 @@ func TestJobResourcesRegexp(t *testing.T) {
 	}
 }
 
+func TestJobArtifactRegexp(t *testing.T) {
+	expectNoMatchCases := []string{
+		"/job/2fb41f25-7e17-4383-9e08-8ab115152db2/artifact",
+		"/job/2fb41f25-7e17-4383-9e08-8ab115152db2/artifact/",
+		"/job/2fb41f25-7e17-4383-9e08-8ab115152db2/artifact/../log", // Path traversal
+		"/job/2fb41f25-7e17-4383-9e08-8ab115152db2/artifact/a/b",    // Extra path component
+		"/job/2fb41f25-7e17-4383-9e08/artifact/cpu.pprof",           // Invalid job ID
+	}
+	for _, s := range expectNoMatchCases {
+		if jobArtifactRegexp.MatchString(s) {
+			t.Errorf("Should not have matched, but did: '%s'", s)
+		}
+	}
+
+	matches := jobArtifactRegexp.FindStringSubmatch("/job/2fb41f25-7e17-4383-9e08-8ab115152db2/artifact/cpu.pprof")
+	if len(matches) != 3 || matches[1] != "2fb41f25-7e17-4383-9e08-8ab115152db2" || matches[2] != "cpu.pprof" {
+		t.Errorf("Unexpected matches: %v", matches)
+	}
+}
+
+func TestJobLiveLog(t *testing.T) {
+	job := core.NewJob(core.JobParameters{})
+	job.Status = core.Running
+	job.Attempt = 2
+	mock := &mockWebClient{
+		ReturnJob:     job,
+		ReturnLiveLog: "Running benchmarks\n",
+	}
+	h := NewHandler(mock)
+
+	req := httptest.NewRequest("GET", fmt.Sprintf("/job/%s/live", job.Id), nil)
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+
+	if w.Result().StatusCode != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d", http.StatusOK, w.Result().StatusCode)
+	} else if w.Body.String() != mock.ReturnLiveLog {
+		t.Fatalf("Unexpected body: %q", w.Body.String())
+	} else if mock.CapturedAttempt != 2 {
+		t.Fatalf("Expected log of attempt 2, got: %d", mock.CapturedAttempt)
+	} else if w.Header().Get("X-Content-Type-Options") != "nosniff" {
+		t.Fatalf("Unexpected headers: %v", w.Header())
+	}
+
+	// Completed jobs have their log artifact served instead
+	mock.CapturedAttempt = 0
+	mock.ReturnArtifact = "Complete log\n"
+	mock.ReturnArtifactInfo = &core.ArtifactInfo{Name: "log.attempt-2.txt", ContentType: core.TextContentType, Size: 13}
+	job.Log = fmt.Sprintf("jobs/%s/log.attempt-2.txt", job.Id)
+	job.SetFinalStatus(core.Succeeded)
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	if w.Result().StatusCode != http.StatusOK || mock.CapturedAttempt != 0 {
+		t.Fatalf("Unexpected live log of completed job (status: %d)", w.Result().StatusCode)
+	} else if w.Body.String() != mock.ReturnArtifact {
+		t.Fatalf("Unexpected body: %q", w.Body.String())
+	}
+}
+
+func TestJobArtifactEncoding(t *testing.T) {
+	jobId := "2fb41f25-7e17-4383-9e08-8ab115152db2"
+	log := strings.Repeat("Running benchmarks\n", 100)
+	mock := &mockWebClient{
+		ReturnJob: &core.JobRecord{Id: jobId, Log: fmt.Sprintf("jobs/%s/log.txt", jobId)},
+		ReturnArtifactInfo: &core.ArtifactInfo{
+			Name:        "log.txt",
+			ContentType: core.TextContentType,
+			Size:        uint64(len(log)),
+			Encoding:    core.GzipEncoding,
+		},
+		ReturnArtifact: log,
+	}
+	h := NewHandler(mock)
+
+	// Sent compressed to clients accepting gzip
+	req := httptest.NewRequest("GET", fmt.Sprintf("/job/%s/log", jobId), nil)
+	req.Header.Set("Accept-Encoding", "br, gzip;q=0.8")
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	if w.Result().StatusCode != http.StatusOK || w.Header().Get("Content-Encoding") != core.GzipEncoding {
+		t.Fatalf("Expected gzip-encoded response, got status %d, headers: %v", w.Result().StatusCode, w.Header())
+	} else if w.Header().Get("Vary") != "Accept-Encoding" {
+		t.Fatalf("Unexpected Vary header: %v", w.Header())
+	}
+	gr, err := gzip.NewReader(w.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if body, err := io.ReadAll(gr); err != nil || string(body) != log {
+		t.Fatalf("Unexpected body (%v): %q", err, body)
+	} else if w.Header().Get("Content-Length") == strconv.Itoa(len(log)) {
+		t.Fatalf("Unexpected content length: %s", w.Header().Get("Content-Length"))
+	}
+
+	// Decompressed for other clients
+	req = httptest.NewRequest("GET", fmt.Sprintf("/job/%s/artifact/log.txt", jobId), nil)
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	if w.Result().StatusCode != http.StatusOK || w.Header().Get("Content-Encoding") != "" {
+		t.Fatalf("Expected decompressed response, got status %d, headers: %v", w.Result().StatusCode, w.Header())
+	} else if w.Body.String() != log || w.Header().Get("Content-Length") != strconv.Itoa(len(log)) {
+		t.Fatalf("Unexpected body (length: %s): %q", w.Header().Get("Content-Length"), w.Body.String())
+	} else if w.Header().Get("Vary") != "Accept-Encoding" {
+		t.Fatalf("Unexpected Vary header: %v", w.Header())
+	}
+
+	// Binary artifacts are downloaded
+	mock.ReturnArtifactInfo = &core.ArtifactInfo{Name: "cpu.pprof", ContentType: core.BinaryContentType, Size: 4}
+	mock.ReturnArtifact = "prof"
+	req = httptest.NewRequest("GET", fmt.Sprintf("/job/%s/artifact/cpu.pprof", jobId), nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	if w.Header().Get("Content-Encoding") != "" || !strings.HasPrefix(w.Header().Get("Content-Disposition"), "attachment") {
+		t.Fatalf("Unexpected headers: %v", w.Header())
+	} else if w.Header().Get("Vary") != "Accept-Encoding" {
+		t.Fatalf("Unexpected Vary header: %v", w.Header())
+	}
+}
+
 func TestCalculatePagination(t *testing.T) {
 	tests := []struct {
 		desc     string
@@ -314,3 +503,70 @@ func TestCalculatePagination(t *testing.T) {
 		})
 	}
 }
+
+func TestServeWorkers(t *testing.T) {
+	mockClient := &mockWebClient{}
+	h := NewHandler(mockClient)
+
+	req := httptest.NewRequest("GET", "/workers", nil)
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Unexpected status code: %d", w.Code)
+	} else if !strings.Contains(w.Body.String(), "No live workers") {
+		t.Fatalf("Unexpected body: %s", w.Body.String())
+	}
+
+	mockClient.ReturnWorkers = []*core.WorkerRecord{
+		{
+			Id:          "w1",
+			WorkerInfo:  core.WorkerInfo{Hostname: "bench-1"},
+			Queue:       "default",
+			Slots:       1,
+			CurrentJobs: []string{"2fb41f25-7e17-4383-9e08-8ab115152db2"},
+		},
+	}
+
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+
+	body := w.Body.String()
+	if w.Code != http.StatusOK {
+		t.Fatalf("Unexpected status code: %d", w.Code)
+	}
+	for _, s := range []string{"bench-1", "/job/2fb41f25-7e17-4383-9e08-8ab115152db2/record", "Live workers (1)"} {
+		if !strings.Contains(body, s) {
+			t.Errorf("Response body missing expected string: %q", s)
+		}
+	}
+}
+
+func TestServeWorkersWithoutRegistry(t *testing.T) {
+	mockClient := &mockWebClient{
+		NoWorkersRegistry: true,
+		ReturnQueueStatus: &core.QueueStatus{},
+	}
+	h := NewHandler(mockClient)
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("GET", "/workers", nil))
+	if w.Code != http.StatusNotFound {
+		t.Fatalf("Unexpected status code: %d", w.Code)
+	}
+
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("Unexpected status code: %d", w.Code)
+	} else if strings.Contains(w.Body.String(), "./workers") {
+		t.Fatalf("Unexpected link to workers in index: %s", w.Body.String())
+	}
+
+	mockClient.NoWorkersRegistry = false
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+	if !strings.Contains(w.Body.String(), "./workers") {
+		t.Fatalf("Missing link to workers in index: %s", w.Body.String())
+	}
+}
@@ -1,6 +1,7 @@
 package web
 
 import (
+	"context"
 	"io"
 
 	"github.com/synadia-labs/go-bench-away/v1/core"
@@ -14,10 +15,18 @@ type WebClient interface {
 	LoadJobs(limit, offset int, asc bool) ([]*core.JobRecord, error)
 	LoadJobsFiltered(limit, offset int, asc bool, statuses []core.JobStatus) ([]*core.JobRecord, int, error)
 	LoadResultsArtifact(job *core.JobRecord, w io.Writer) error
-	LoadLogArtifact(job *core.JobRecord, w io.Writer) error
-	LoadScriptArtifact(job *core.JobRecord, w io.Writer) error
+	ListArtifacts(jobId string) ([]core.ArtifactInfo, error)
+	OpenArtifact(jobId, name string) (io.ReadCloser, *core.ArtifactInfo, error)
+	OpenStoredArtifact(jobId, name string) (io.ReadCloser, *core.ArtifactInfo, error)
+	FollowJobLog(ctx context.Context, jobId string, attempt uint, w io.Writer) error
 	CancelJob(id string) error
 	CountJobsByStatus() (map[core.JobStatus]int, error)
-	LoadJobsByKV(limit, offset int, statuses []core.JobStatus) ([]*core.JobRecord, map[core.JobStatus]int, error)
+	LoadJobsByKV(
+		limit, offset int,
+		statuses []core.JobStatus,
+		selector core.LabelSelector,
+	) ([]*core.JobRecord, map[core.JobStatus]int, error)
 	QueueName() string
+	HasWorkersRegistry() bool
+	LoadWorkers() ([]*core.WorkerRecord, error)
 }
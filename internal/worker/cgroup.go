@@ -0,0 +1,240 @@
+package worker
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/synadia-labs/go-bench-away/v1/core"
+)
+
+// Period of the cpu.max bandwidth limit, in microseconds (the kernel default)
+const kCPUMaxPeriod = 100000
+
+// ResourceLimits caps the resources each job can use, the zero value does not limit anything.
+// Memory, CPU and processes limits are enforced by running each job in its own cgroup (v2).
+type ResourceLimits struct {
+	MemoryMax  int64   // Max memory in bytes, processes are killed when exceeded (0: no limit)
+	CPUMax     float64 // Max CPU bandwidth, in number of CPUs (0: no limit)
+	PidsMax    int64   // Max number of processes and threads (0: no limit)
+	DiskMax    int64   // Max size of the job directory in bytes, checked periodically (0: no limit)
+	CgroupRoot string  // Cgroup under which job cgroups are created (default: the worker's own cgroup)
+}
+
+// Jobs run in a cgroup if any of the limits it enforces is set, or if a cgroup root is given (statistics only)
+func (l ResourceLimits) usesCgroup() bool {
+	return l.MemoryMax > 0 || l.CPUMax > 0 || l.PidsMax > 0 || l.CgroupRoot != ""
+}
+
+func (l ResourceLimits) String() string {
+	limits := []string{}
+	if l.MemoryMax > 0 {
+		limits = append(limits, fmt.Sprintf("memory: %d MiB", l.MemoryMax>>20))
+	}
+	if l.CPUMax > 0 {
+		limits = append(limits, fmt.Sprintf("cpu: %g", l.CPUMax))
+	}
+	if l.PidsMax > 0 {
+		limits = append(limits, fmt.Sprintf("pids: %d", l.PidsMax))
+	}
+	if l.DiskMax > 0 {
+		limits = append(limits, fmt.Sprintf("disk: %d MiB", l.DiskMax>>20))
+	}
+	return strings.Join(limits, ", ")
+}
+
+// Creates a transient cgroup for each job, under a root cgroup delegated to the worker
+type cgroupManager struct {
+	root   string
+	limits ResourceLimits
+}
+
+func newCgroupManager(limits ResourceLimits) (*cgroupManager, error) {
+	root := limits.CgroupRoot
+	if root == "" {
+		ownCgroup, err := readOwnCgroup()
+		if err != nil {
+			return nil, err
+		}
+		root = ownCgroup
+		// Controllers cannot be enabled for child cgroups of a cgroup that has processes, move the worker to a leaf
+		workerCgroup := filepath.Join(root, "worker")
+		if err := os.MkdirAll(workerCgroup, 0755); err != nil {
+			return nil, fmt.Errorf("failed to create worker cgroup: %w", err)
+		}
+		if err := writeCgroupFile(workerCgroup, "cgroup.procs", strconv.Itoa(os.Getpid())); err != nil {
+			return nil, fmt.Errorf("failed to move worker to its own cgroup: %w", err)
+		}
+	}
+
+	controllers, err := os.ReadFile(filepath.Join(root, "cgroup.controllers"))
+	if err != nil {
+		return nil, fmt.Errorf("cgroup v2 not available at %s: %w", root, err)
+	}
+	available := strings.Fields(string(controllers))
+	for _, controller := range []string{"memory", "cpu", "pids"} {
+		if !contains(available, controller) {
+			return nil, fmt.Errorf("cgroup controller '%s' not available at %s", controller, root)
+		}
+		if err := writeCgroupFile(root, "cgroup.subtree_control", "+"+controller); err != nil {
+			return nil, fmt.Errorf("failed to enable cgroup controller '%s': %w", controller, err)
+		}
+	}
+
+	return &cgroupManager{
+		root:   root,
+		limits: limits,
+	}, nil
+}
+
+// Path of the cgroup of the worker process, from /proc/self/cgroup (cgroup v2 entry is "0::<path>")
+func readOwnCgroup() (string, error) {
+	for _, line := range strings.Split(readHostFile("proc/self/cgroup"), "\n") {
+		if path, found := strings.CutPrefix(line, "0::"); found {
+			return filepath.Join(hostRoot, "sys/fs/cgroup", path), nil
+		}
+	}
+	return "", fmt.Errorf("worker is not in a cgroup v2 hierarchy")
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// Create the cgroup of a job, with the limits applied
+func (m *cgroupManager) create(name string) (*jobCgroup, error) {
+	path := filepath.Join(m.root, name)
+	if err := os.Mkdir(path, 0755); err != nil {
+		return nil, err
+	}
+	cg := &jobCgroup{
+		path: path,
+	}
+
+	limits := map[string]string{}
+	if m.limits.MemoryMax > 0 {
+		limits["memory.max"] = strconv.FormatInt(m.limits.MemoryMax, 10)
+		// Kill the whole job rather than whichever process the OOM killer picks
+		limits["memory.oom.group"] = "1"
+	}
+	if m.limits.CPUMax > 0 {
+		limits["cpu.max"] = fmt.Sprintf("%d %d", int64(m.limits.CPUMax*kCPUMaxPeriod), kCPUMaxPeriod)
+	}
+	if m.limits.PidsMax > 0 {
+		limits["pids.max"] = strconv.FormatInt(m.limits.PidsMax, 10)
+	}
+	for file, value := range limits {
+		if err := writeCgroupFile(path, file, value); err != nil {
+			cg.remove()
+			return nil, fmt.Errorf("failed to set %s: %w", file, err)
+		}
+	}
+	if m.limits.MemoryMax > 0 {
+		// Swapping would let the job go past its memory limit (best effort, swap accounting may be disabled)
+		_ = writeCgroupFile(path, "memory.swap.max", "0")
+	}
+
+	dir, err := os.Open(path)
+	if err != nil {
+		cg.remove()
+		return nil, err
+	}
+	cg.dir = dir
+	return cg, nil
+}
+
+// Transient cgroup a job script and all its children run in
+type jobCgroup struct {
+	path string
+	dir  *os.File // Open cgroup directory, passed to the kernel to start the script directly in the cgroup
+}
+
+func (cg *jobCgroup) fd() int {
+	return int(cg.dir.Fd())
+}
+
+// Peak memory usage (0 if unknown, memory.peak requires Linux 5.19) and CPU time of the processes in the cgroup
+func (cg *jobCgroup) stats() (uint64, time.Duration) {
+	peakMemory, _ := strconv.ParseUint(readCgroupFile(cg.path, "memory.peak"), 10, 64)
+	usageUsec, _ := strconv.ParseUint(readCgroupKey(cg.path, "cpu.stat", "usage_usec"), 10, 64)
+	return peakMemory, time.Duration(usageUsec) * time.Microsecond
+}
+
+// Returns a failure if the kernel enforced one of the limits (processes killed, or failed to fork), nil otherwise
+func (cg *jobCgroup) limitExceeded(limits ResourceLimits) error {
+	if oomKills, _ := strconv.Atoi(readCgroupKey(cg.path, "memory.events", "oom_kill")); oomKills > 0 {
+		return newJobFailure(
+			core.ResourceLimitFailure,
+			"Memory limit exceeded (%d MiB), %d process(es) killed",
+			limits.MemoryMax>>20,
+			oomKills,
+		)
+	}
+	if forkFailures, _ := strconv.Atoi(readCgroupKey(cg.path, "pids.events", "max")); forkFailures > 0 {
+		return newJobFailure(
+			core.ResourceLimitFailure,
+			"Process limit exceeded (%d), %d fork(s) failed",
+			limits.PidsMax,
+			forkFailures,
+		)
+	}
+	return nil
+}
+
+// Kill any process left in the cgroup, and delete it
+func (cg *jobCgroup) remove() {
+	if cg.dir != nil {
+		cg.dir.Close()
+	}
+	// cgroup.kill requires Linux 5.14, processes are also killed along with the script process group
+	_ = writeCgroupFile(cg.path, "cgroup.kill", "1")
+	// Removal fails until killed processes are gone
+	for i := 0; i < 10; i++ {
+		err := os.Remove(cg.path)
+		if err == nil || errors.Is(err, os.ErrNotExist) {
+			return
+		} else if i == 9 {
+			fmt.Fprintf(os.Stderr, "Failed to remove cgroup %s: %v\n", cg.path, err)
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+}
+
+func writeCgroupFile(cgroupPath, file, value string) error {
+	return os.WriteFile(filepath.Join(cgroupPath, file), []byte(value), 0644)
+}
+
+func readCgroupFile(cgroupPath, file string) string {
+	data, err := os.ReadFile(filepath.Join(cgroupPath, file))
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(data))
+}
+
+// Value of a key in a flat keyed cgroup file (e.g. memory.events), empty if not found
+func readCgroupKey(cgroupPath, file, key string) string {
+	f, err := os.Open(filepath.Join(cgroupPath, file))
+	if err != nil {
+		return ""
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if fields := strings.Fields(scanner.Text()); len(fields) == 2 && fields[0] == key {
+			return fields[1]
+		}
+	}
+	return ""
+}
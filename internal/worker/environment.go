@@ -0,0 +1,161 @@
+package worker
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/synadia-labs/go-bench-away/v1/core"
+)
+
+// Root of the /sys and /proc paths read, overridden in tests
+var hostRoot = "/"
+
+// EnvironmentPolicy is the set of host conditions required for stable benchmark results.
+// The zero value does not check anything.
+type EnvironmentPolicy struct {
+	MaxLoadAverage float64 // Max 1-minute load average (0: no limit)
+	Governor       string  // Required CPU frequency scaling governor, e.g. "performance" (empty: any)
+	NoTurboBoost   bool    // Require turbo boost to be disabled
+	NoSMT          bool    // Require simultaneous multithreading to be disabled
+	Enforce        bool    // Refuse to run jobs when the policy is violated (otherwise, only warn)
+}
+
+// Check the environment against the policy, returns the list of violations
+func (p EnvironmentPolicy) check(env *core.HostEnvironment) []string {
+	violations := []string{}
+	if p.MaxLoadAverage > 0 && env.LoadAverage > p.MaxLoadAverage {
+		violations = append(violations, fmt.Sprintf("load average %.2f > %.2f", env.LoadAverage, p.MaxLoadAverage))
+	}
+	if p.Governor != "" && env.Governor != p.Governor {
+		violations = append(violations, fmt.Sprintf("CPU governor '%s' is not '%s'", env.Governor, p.Governor))
+	}
+	if p.NoTurboBoost && env.TurboBoost != "disabled" {
+		violations = append(violations, fmt.Sprintf("turbo boost is not disabled (%s)", valueOrUnknown(env.TurboBoost)))
+	}
+	if p.NoSMT && env.SMT != "off" && env.SMT != "forceoff" && env.SMT != "notsupported" {
+		violations = append(violations, fmt.Sprintf("SMT is not disabled (%s)", valueOrUnknown(env.SMT)))
+	}
+	return violations
+}
+
+func valueOrUnknown(value string) string {
+	if value == "" {
+		return "unknown"
+	}
+	return value
+}
+
+// Collect the state of the host, for the given CPUs (all online CPUs if none given).
+// Facts that cannot be read are left empty.
+func collectEnvironment(cpus []int) *core.HostEnvironment {
+	env := &core.HostEnvironment{
+		Kernel: readHostFile("proc/sys/kernel/osrelease"),
+	}
+
+	onlineCPUs := parseCPUList(readHostFile("sys/devices/system/cpu/online"))
+	env.CPUCores = len(onlineCPUs)
+	if len(cpus) == 0 {
+		cpus = onlineCPUs
+	}
+
+	if cpuInfo, err := os.Open(filepath.Join(hostRoot, "proc/cpuinfo")); err == nil {
+		scanner := bufio.NewScanner(cpuInfo)
+		for scanner.Scan() && env.CPUModel == "" {
+			if key, value, found := strings.Cut(scanner.Text(), ":"); found && strings.TrimSpace(key) == "model name" {
+				env.CPUModel = strings.TrimSpace(value)
+			}
+		}
+		cpuInfo.Close()
+	}
+
+	if memInfo, err := os.Open(filepath.Join(hostRoot, "proc/meminfo")); err == nil {
+		scanner := bufio.NewScanner(memInfo)
+		for scanner.Scan() {
+			fields := strings.Fields(scanner.Text())
+			if len(fields) >= 2 && fields[0] == "MemTotal:" {
+				kb, _ := strconv.ParseUint(fields[1], 10, 64)
+				env.MemoryTotal = kb * 1024
+				break
+			}
+		}
+		memInfo.Close()
+	}
+
+	// Load average file format: "0.44 0.40 0.35 1/72 11211"
+	if loadFields := strings.Fields(readHostFile("proc/loadavg")); len(loadFields) >= 4 {
+		env.LoadAverage, _ = strconv.ParseFloat(loadFields[0], 64)
+		if running, _, found := strings.Cut(loadFields[3], "/"); found {
+			env.RunningProcesses, _ = strconv.Atoi(running)
+		}
+	}
+
+	governors := map[string]bool{}
+	for _, cpu := range cpus {
+		cpuDir := fmt.Sprintf("sys/devices/system/cpu/cpu%d", cpu)
+		if governor := readHostFile(filepath.Join(cpuDir, "cpufreq/scaling_governor")); governor != "" {
+			governors[governor] = true
+		}
+		throttleCount, _ := strconv.ParseUint(readHostFile(filepath.Join(cpuDir, "thermal_throttle/core_throttle_count")), 10, 64)
+		env.ThrottleCount += throttleCount
+	}
+	governorsList := make([]string, 0, len(governors))
+	for governor := range governors {
+		governorsList = append(governorsList, governor)
+	}
+	sort.Strings(governorsList)
+	env.Governor = strings.Join(governorsList, ",")
+
+	// Intel P-state driver has its own knob, other drivers use the generic one
+	if noTurbo := readHostFile("sys/devices/system/cpu/intel_pstate/no_turbo"); noTurbo != "" {
+		env.TurboBoost = onOff(noTurbo == "0")
+	} else if boost := readHostFile("sys/devices/system/cpu/cpufreq/boost"); boost != "" {
+		env.TurboBoost = onOff(boost == "1")
+	}
+
+	env.SMT = readHostFile("sys/devices/system/cpu/smt/control")
+
+	return env
+}
+
+func onOff(enabled bool) string {
+	if enabled {
+		return "enabled"
+	}
+	return "disabled"
+}
+
+// Read a small file under the host root, returns its trimmed content (empty on error)
+func readHostFile(path string) string {
+	data, err := os.ReadFile(filepath.Join(hostRoot, path))
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(data))
+}
+
+// Parse a list in the kernel list format, e.g. "0-3,8,10-11"
+func parseCPUList(cpuList string) []int {
+	cpus := []int{}
+	for _, part := range strings.Split(cpuList, ",") {
+		first, last, isRange := strings.Cut(part, "-")
+		start, err := strconv.Atoi(first)
+		if err != nil {
+			continue
+		}
+		end := start
+		if isRange {
+			if end, err = strconv.Atoi(last); err != nil {
+				continue
+			}
+		}
+		for cpu := start; cpu <= end; cpu++ {
+			cpus = append(cpus, cpu)
+		}
+	}
+	return cpus
+}
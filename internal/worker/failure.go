@@ -0,0 +1,127 @@
+package worker
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/synadia-labs/go-bench-away/v1/core"
+)
+
+const kMaxFailureMessageLength = 200
+
+// Error that carries the classification of a job failure
+type jobFailure struct {
+	category core.FailureCategory
+	message  string
+}
+
+func (f *jobFailure) Error() string {
+	return f.message
+}
+
+func newJobFailure(category core.FailureCategory, format string, args ...interface{}) error {
+	return &jobFailure{
+		category: category,
+		message:  fmt.Sprintf(format, args...),
+	}
+}
+
+// Error returned when a running job is stopped because someone cancelled it
+type jobCancellation struct {
+	requester string
+}
+
+func (c *jobCancellation) Error() string {
+	return fmt.Sprintf("Cancelled by %s", c.requester)
+}
+
+// Error returned when a running job is stopped because it ran past its deadline
+type jobTimeout struct {
+	deadline time.Duration
+}
+
+func (t *jobTimeout) Error() string {
+	return fmt.Sprintf("Killed after running for %s, past the job deadline", t.deadline)
+}
+
+// Error returned when a running job is stopped because the worker is shutting down
+type jobInterruption struct{}
+
+func (i *jobInterruption) Error() string {
+	return "Interrupted by worker shutdown"
+}
+
+// Why the job context is done (nil if not): someone cancelled the job (cancelled is true), or the worker is shutting
+// down
+func jobStopReason(jobCtx context.Context) (stopReason error, cancelled bool) {
+	if jobCtx.Err() == nil {
+		return nil, false
+	}
+	var cancellation *jobCancellation
+	if errors.As(context.Cause(jobCtx), &cancellation) {
+		return cancellation, true
+	}
+	return &jobInterruption{}, false
+}
+
+// Category of a job run error, errors that are not classified are blamed on the worker
+func failureCategory(err error) core.FailureCategory {
+	var f *jobFailure
+	if errors.As(err, &f) {
+		return f.category
+	}
+	return core.WorkerFailure
+}
+
+// Last stage recorded by the script (empty if none)
+func readScriptStage(stagePath string) string {
+	stageBytes, err := os.ReadFile(stagePath)
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(stageBytes))
+}
+
+// Map the last stage recorded by the script to a failure category
+func scriptStageFailureCategory(stagePath string) core.FailureCategory {
+	switch readScriptStage(stagePath) {
+	case "", "setup":
+		return core.SetupFailure
+	case "checkout":
+		return core.CheckoutFailure
+	case "build":
+		return core.BuildFailure
+	case "timeout":
+		return core.TimeoutFailure
+	default:
+		return core.BenchmarkFailure
+	}
+}
+
+// Last non-empty line of the job log, usually the most relevant error message
+func lastLogLine(logPath string) string {
+	file, err := os.Open(logPath)
+	if err != nil {
+		return ""
+	}
+	defer file.Close()
+
+	lastLine := ""
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		if line := strings.TrimSpace(scanner.Text()); line != "" {
+			lastLine = line
+		}
+	}
+
+	if len(lastLine) > kMaxFailureMessageLength {
+		lastLine = strings.ToValidUTF8(lastLine[:kMaxFailureMessageLength], "") + "..."
+	}
+	return lastLine
+}
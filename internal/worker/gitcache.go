@@ -0,0 +1,240 @@
+package worker
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+const (
+	kMirrorLockSuffix          = ".lock"
+	kMirrorUpdateLockSuffix    = ".update.lock"
+	kMirrorMaintainedSuffix    = ".maintained" // Modification time is the last maintenance
+	kMirrorMaintenanceInterval = 24 * time.Hour
+)
+
+// Cache of bare git mirrors, one per remote, shared by job slots (and workers using the same directory).
+// Each mirror has a lock file, shared by the jobs using the mirror, and held exclusively while the mirror is created,
+// maintained (garbage-collected) or evicted. Fetching is safe while jobs use the mirror (as long as objects are not
+// garbage-collected), so updates have their own lock, to avoid concurrent fetches.
+type gitCache struct {
+	dir     string
+	maxSize int64 // Size above which least recently used mirrors are evicted (0: no limit)
+}
+
+func newGitCache(dir string, maxSize int64) (*gitCache, error) {
+	if err := os.MkdirAll(dir, 0750); err != nil {
+		return nil, fmt.Errorf("failed to create git cache directory: %w", err)
+	}
+	return &gitCache{
+		dir:     dir,
+		maxSize: maxSize,
+	}, nil
+}
+
+// Path of the mirror of the given remote, named after its hash so credentials in URLs do not leak into paths
+func (gc *gitCache) mirrorPath(remote string) string {
+	return filepath.Join(gc.dir, fmt.Sprintf("%x", sha256.Sum256([]byte(remote)))[:16]+".git")
+}
+
+// Create or update the mirror of the given remote, and lock it for use by a job.
+// Returns the mirror path (empty if no mirror is available, the job should clone from the remote) and a function to
+// release the lock, once the job is done with the mirror.
+func (gc *gitCache) acquire(ctx context.Context, remote string) (string, func()) {
+	mirrorPath := gc.mirrorPath(remote)
+
+	lockFile, err := os.OpenFile(mirrorPath+kMirrorLockSuffix, os.O_CREATE|os.O_RDWR, 0640)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to open git mirror lock: %v\n", err)
+		return "", func() {}
+	}
+	release := func() { lockFile.Close() }
+	fd := int(lockFile.Fd())
+
+	if err := unix.Flock(fd, unix.LOCK_SH); err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to lock git mirror: %v\n", err)
+		release()
+		return "", func() {}
+	}
+
+	if !isMirror(mirrorPath) {
+		// Create it with the lock held exclusively (checking again, another slot may have created it meanwhile)
+		if err := unix.Flock(fd, unix.LOCK_EX); err == nil && !isMirror(mirrorPath) {
+			fmt.Printf("⚙️  Creating git mirror of %s\n", remote)
+			if err := gc.create(ctx, remote, mirrorPath); err != nil {
+				fmt.Fprintf(os.Stderr, "Failed to create git mirror of %s: %v\n", remote, err)
+			}
+		}
+		if err := unix.Flock(fd, unix.LOCK_SH); err != nil {
+			release()
+			return "", func() {}
+		}
+	} else {
+		if err := gc.update(ctx, mirrorPath); err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to update git mirror of %s: %v\n", remote, err)
+		}
+		// Fetches do not garbage-collect, do it from time to time, if no other job is using the mirror
+		if gc.maintenanceDue(mirrorPath) {
+			if err := unix.Flock(fd, unix.LOCK_EX|unix.LOCK_NB); err == nil && isMirror(mirrorPath) {
+				gc.maintain(ctx, mirrorPath)
+			}
+			if err := unix.Flock(fd, unix.LOCK_SH); err != nil {
+				release()
+				return "", func() {}
+			}
+		}
+	}
+
+	if !isMirror(mirrorPath) {
+		release()
+		return "", func() {}
+	}
+
+	// Mark as recently used, and make room for it
+	now := time.Now()
+	_ = os.Chtimes(lockFile.Name(), now, now)
+	gc.evict(mirrorPath)
+
+	return mirrorPath, release
+}
+
+func isMirror(path string) bool {
+	_, err := os.Stat(filepath.Join(path, "HEAD"))
+	return err == nil
+}
+
+// Clone the mirror, starting over in case a previous attempt left a partial mirror behind
+func (gc *gitCache) create(ctx context.Context, remote, mirrorPath string) error {
+	if err := os.RemoveAll(mirrorPath); err != nil {
+		return err
+	}
+	if err := runGit(ctx, "clone", "--quiet", "--mirror", "--", remote, mirrorPath); err != nil {
+		return err
+	}
+	gc.markMaintained(mirrorPath)
+	return nil
+}
+
+// Fetch from the remote into the mirror, unless another slot is already doing it
+func (gc *gitCache) update(ctx context.Context, mirrorPath string) error {
+	updateLockFile, err := os.OpenFile(mirrorPath+kMirrorUpdateLockSuffix, os.O_CREATE|os.O_RDWR, 0640)
+	if err != nil {
+		return err
+	}
+	defer updateLockFile.Close()
+
+	if unix.Flock(int(updateLockFile.Fd()), unix.LOCK_EX|unix.LOCK_NB) != nil {
+		return nil
+	}
+	// Automatic garbage collection could remove objects jobs are using, disable it
+	return runGit(ctx, "-C", mirrorPath, "-c", "gc.auto=0", "fetch", "--quiet", "--prune", "origin")
+}
+
+func (gc *gitCache) maintenanceDue(mirrorPath string) bool {
+	info, err := os.Stat(mirrorPath + kMirrorMaintainedSuffix)
+	return err != nil || time.Since(info.ModTime()) > kMirrorMaintenanceInterval
+}
+
+func (gc *gitCache) markMaintained(mirrorPath string) {
+	now := time.Now()
+	if err := os.Chtimes(mirrorPath+kMirrorMaintainedSuffix, now, now); err != nil {
+		_ = os.WriteFile(mirrorPath+kMirrorMaintainedSuffix, nil, 0640)
+	}
+}
+
+// Repack the mirror and remove unreachable objects, must be called with the lock held exclusively
+func (gc *gitCache) maintain(ctx context.Context, mirrorPath string) {
+	fmt.Printf("⚙️  Garbage-collecting git mirror %s\n", mirrorPath)
+	if err := runGit(ctx, "-C", mirrorPath, "gc", "--quiet", "--prune=now"); err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to garbage-collect git mirror %s: %v\n", mirrorPath, err)
+		return
+	}
+	gc.markMaintained(mirrorPath)
+}
+
+func runGit(ctx context.Context, args ...string) error {
+	output, err := exec.CommandContext(ctx, "git", args...).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("%v: %s", err, strings.TrimSpace(string(output)))
+	}
+	return nil
+}
+
+// Remove least recently used mirrors (other than the given one, and mirrors in use) until the cache fits in its size
+func (gc *gitCache) evict(keepPath string) {
+	if gc.maxSize == 0 {
+		return
+	}
+
+	type mirror struct {
+		path     string
+		size     int64
+		lastUsed time.Time
+	}
+
+	lockPaths, _ := filepath.Glob(filepath.Join(gc.dir, "*.git"+kMirrorLockSuffix))
+	mirrors := make([]mirror, 0, len(lockPaths))
+	var totalSize int64
+	for _, lockPath := range lockPaths {
+		lockInfo, err := os.Stat(lockPath)
+		if err != nil {
+			continue
+		}
+		m := mirror{
+			path:     strings.TrimSuffix(lockPath, kMirrorLockSuffix),
+			size:     dirSize(strings.TrimSuffix(lockPath, kMirrorLockSuffix)),
+			lastUsed: lockInfo.ModTime(),
+		}
+		totalSize += m.size
+		mirrors = append(mirrors, m)
+	}
+
+	sort.Slice(mirrors, func(i, j int) bool {
+		return mirrors[i].lastUsed.Before(mirrors[j].lastUsed)
+	})
+
+	for _, m := range mirrors {
+		if totalSize <= gc.maxSize {
+			return
+		} else if m.path == keepPath || m.size == 0 {
+			continue
+		}
+
+		lockFile, err := os.OpenFile(m.path+kMirrorLockSuffix, os.O_RDWR, 0640)
+		if err != nil {
+			continue
+		}
+		if unix.Flock(int(lockFile.Fd()), unix.LOCK_EX|unix.LOCK_NB) == nil {
+			fmt.Printf("⚙️  Evicting git mirror %s (%d MiB)\n", m.path, m.size>>20)
+			if err := os.RemoveAll(m.path); err != nil {
+				fmt.Fprintf(os.Stderr, "Failed to evict git mirror: %v\n", err)
+			} else {
+				totalSize -= m.size
+			}
+		}
+		lockFile.Close()
+	}
+}
+
+// Total size of the files under the given directory
+func dirSize(path string) int64 {
+	var size int64
+	_ = filepath.WalkDir(path, func(_ string, d fs.DirEntry, err error) error {
+		if err == nil && d.Type().IsRegular() {
+			if info, err := d.Info(); err == nil {
+				size += info.Size()
+			}
+		}
+		return nil
+	})
+	return size
+}
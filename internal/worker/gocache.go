@@ -0,0 +1,48 @@
+package worker
+
+import (
+	"bufio"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/synadia-labs/go-bench-away/v1/core"
+)
+
+// Read the Go caches information written by the script, as KEY=VALUE lines. Returns nil if the file does not exist
+// (e.g. the script failed before the build stage, or a custom script does not report it).
+func readGoCacheInfo(path string) *core.GoCacheInfo {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil
+	}
+	defer file.Close()
+
+	info := &core.GoCacheInfo{}
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		key, value, found := strings.Cut(strings.TrimSpace(scanner.Text()), "=")
+		if !found {
+			continue
+		}
+		switch key {
+		case "GOMODCACHE":
+			info.ModCacheDir = value
+		case "GOMODCACHE_KB":
+			kb, _ := strconv.ParseUint(value, 10, 64)
+			info.ModCacheSize = kb * 1024
+		case "GOCACHE":
+			info.BuildCacheDir = value
+		case "GOCACHE_KB":
+			kb, _ := strconv.ParseUint(value, 10, 64)
+			info.BuildCacheSize = kb * 1024
+		case "CLEAN_BUILD_CACHE":
+			info.CleanBuildCache = value == "true"
+		case "PACKAGES_CACHED":
+			info.PackagesCached, _ = strconv.Atoi(value)
+		case "PACKAGES_TOTAL":
+			info.PackagesTotal, _ = strconv.Atoi(value)
+		}
+	}
+	return info
+}
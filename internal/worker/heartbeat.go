@@ -0,0 +1,70 @@
+package worker
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/synadia-labs/go-bench-away/v1/core"
+)
+
+// How often the worker updates the heartbeat of the job it is running
+const kHeartbeatInterval = 30 * time.Second
+
+// Periodically updates the heartbeat in the record of a running job, until stopped.
+// It works on a deep copy of the record, so the job can be modified while the heartbeat runs.
+type heartbeat struct {
+	c        JobUpdaterClient
+	job      *core.JobRecord
+	revision uint64
+	stopCh   chan struct{}
+	doneCh   chan struct{}
+}
+
+func startHeartbeat(c JobUpdaterClient, job *core.JobRecord, revision uint64, interval time.Duration) *heartbeat {
+	h := &heartbeat{
+		c:        c,
+		job:      job.Clone(),
+		revision: revision,
+		stopCh:   make(chan struct{}),
+		doneCh:   make(chan struct{}),
+	}
+	go h.run(interval)
+	return h
+}
+
+func (h *heartbeat) run(interval time.Duration) {
+	defer close(h.doneCh)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-h.stopCh:
+			return
+		case <-ticker.C:
+			h.job.Heartbeat = time.Now().UTC()
+			// The job is running since the previous update, no need to look up the stored status
+			revision, err := h.c.UpdateJobFromStatus(h.job, h.revision, core.Running, "")
+			if errors.Is(err, core.ErrRevisionConflict) {
+				// The record was updated by someone else (e.g. marked stale), no point in retrying
+				fmt.Fprintf(os.Stderr, "Stopping job %s heartbeat: %v\n", h.job.Id, err)
+				return
+			} else if err != nil {
+				// Transient (e.g. timeout or reconnection), try again at the next interval
+				fmt.Fprintf(os.Stderr, "Failed to update job %s heartbeat: %v\n", h.job.Id, err)
+				continue
+			}
+			h.revision = revision
+		}
+	}
+}
+
+// Stop the heartbeat, and return the latest heartbeat time and job record revision
+func (h *heartbeat) stop() (time.Time, uint64) {
+	close(h.stopCh)
+	<-h.doneCh
+	return h.job.Heartbeat, h.revision
+}
@@ -2,6 +2,7 @@ package worker
 
 import (
 	"context"
+	"io"
 
 	"github.com/synadia-labs/go-bench-away/v1/core"
 )
@@ -14,12 +15,31 @@ type DispatcherClient interface {
 
 type JobUpdaterClient interface {
 	UpdateJob(*core.JobRecord, uint64) (uint64, error)
-	UploadLogArtifact(string, string) (string, error)
-	UploadResultsArtifact(string, string) (string, error)
-	UploadScriptArtifact(string, string) (string, error)
+	UpdateJobWithNote(*core.JobRecord, uint64, string) (uint64, error)
+	UpdateJobFromStatus(*core.JobRecord, uint64, core.JobStatus, string) (uint64, error)
+	UploadArtifact(jobId, name, filePath, contentType string) (string, error)
+}
+
+type LogPublisherClient interface {
+	PublishJobLog(jobId string, attempt uint) io.WriteCloser
+}
+
+type ControlClient interface {
+	OnCancelRequest(string, func(string)) (func(), error)
+	OnDrainRequest(string, func(string)) (func(), error)
+}
+
+type RegistryClient interface {
+	QueueName() string
+	HasWorkersRegistry() bool
+	RegisterWorker(*core.WorkerRecord) error
+	UnregisterWorker(string) error
 }
 
 type WorkerClient interface {
 	DispatcherClient
 	JobUpdaterClient
+	LogPublisherClient
+	ControlClient
+	RegistryClient
 }
@@ -0,0 +1,80 @@
+package worker
+
+import (
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+// Process group of a running job script, the script and all its children are stopped together
+type processGroup struct {
+	sync.Mutex
+	pid        int
+	done       bool
+	doneCh     chan struct{}
+	stopReason error
+}
+
+func newProcessGroup(pid int) *processGroup {
+	return &processGroup{
+		pid:    pid,
+		doneCh: make(chan struct{}),
+	}
+}
+
+// Stop all processes in the group, for the given reason.
+// Processes are sent SIGTERM, and SIGKILL if the script is still running after the grace period (0: SIGKILL right away).
+// Blocks until the script exits or the grace period expires.
+// Does nothing if the script already exited (its process group ID may have been reused), or is already being stopped.
+func (g *processGroup) stop(reason error, gracePeriod time.Duration) {
+	g.Lock()
+	if g.done || g.stopReason != nil {
+		g.Unlock()
+		return
+	}
+	g.stopReason = reason
+	if gracePeriod == 0 {
+		g.signal(unix.SIGKILL)
+		g.Unlock()
+		return
+	}
+	g.signal(unix.SIGTERM)
+	g.Unlock()
+
+	select {
+	case <-g.doneCh:
+		return
+	case <-time.After(gracePeriod):
+	}
+
+	g.Lock()
+	defer g.Unlock()
+	if !g.done {
+		fmt.Fprintf(os.Stderr, "Process group %d still running after %s, killing it\n", g.pid, gracePeriod)
+		g.signal(unix.SIGKILL)
+	}
+}
+
+func (g *processGroup) signal(sig unix.Signal) {
+	if err := unix.Kill(-g.pid, sig); err != nil && err != unix.ESRCH {
+		fmt.Fprintf(os.Stderr, "Failed to signal process group %d: %v\n", g.pid, err)
+	}
+}
+
+// Mark the script as exited, and kill any leftover process it started (e.g. in background).
+// Returns why the group was stopped (nil if the script exited on its own).
+func (g *processGroup) exited() error {
+	g.Lock()
+	defer g.Unlock()
+
+	if !g.done {
+		g.done = true
+		close(g.doneCh)
+		// The group ID cannot be reused as long as any process in the group is alive
+		g.signal(unix.SIGKILL)
+	}
+	return g.stopReason
+}
@@ -0,0 +1,68 @@
+package worker
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+)
+
+// Register the worker (or refresh its registration)
+func (w *workerImpl) register() {
+	w.registrationLock.Lock()
+	defer w.registrationLock.Unlock()
+
+	w.registration.CurrentJobs = []string{}
+	for _, jobId := range w.slotJobs {
+		if jobId != "" {
+			w.registration.CurrentJobs = append(w.registration.CurrentJobs, jobId)
+		}
+	}
+	w.registration.Heartbeat = time.Now().UTC()
+	if !w.c.HasWorkersRegistry() {
+		return
+	}
+	if err := w.c.RegisterWorker(&w.registration); err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to register worker: %v\n", err)
+	}
+}
+
+// Update the registration with the job currently running in the given slot (empty if idle)
+func (w *workerImpl) registerJob(s *slot, jobId string) {
+	w.registrationLock.Lock()
+	w.slotJobs[s.index] = jobId
+	w.registrationLock.Unlock()
+	w.register()
+}
+
+// Refresh the worker registration periodically, so it does not expire, until the context is done
+func (w *workerImpl) keepRegistered(ctx context.Context) {
+	ticker := time.NewTicker(w.heartbeatInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			w.register()
+		}
+	}
+}
+
+// Flag the worker registration as draining
+func (w *workerImpl) registerDraining() {
+	w.registrationLock.Lock()
+	w.registration.Draining = true
+	w.registrationLock.Unlock()
+	w.register()
+}
+
+func (w *workerImpl) unregister() {
+	if !w.c.HasWorkersRegistry() {
+		return
+	}
+	if err := w.c.UnregisterWorker(w.registration.Id); err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to unregister worker: %v\n", err)
+	}
+}
@@ -0,0 +1,123 @@
+package worker
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"text/template"
+	"time"
+
+	"github.com/synadia-labs/go-bench-away/v1/core"
+)
+
+// Values available to the benchmark script template.
+// All paths are absolute, all values are strings (empty if not set) unless noted otherwise.
+type scriptValues struct {
+	JobDirPath      string   // Existing temporary directory under which all work is done
+	ResultsPath     string   // File where the script writes benchmark results
+	ShaPath         string   // File where the script writes the commit hash GitRef resolves to
+	GoVersionPath   string   // File where the script writes the go version used
+	StagePath       string   // File where the script writes the current stage (setup, checkout, build, benchmark, done)
+	GoCacheInfoPath string   // File where the script writes the Go caches information, as KEY=VALUE lines
+	ProfilesPath    string   // Directory where the script writes profiles (go test -outputdir)
+	GitRemote       string   // Git remote URL to clone code from
+	GitRef          string   // Git reference to checkout (branch, tag, SHA, ...)
+	GitMirrorPath   string   // Local bare mirror of GitRemote to clone from, if the worker git cache is enabled
+	TestsSubDir     string   // Sub-directory of the project where to run tests from
+	TestsFilterExpr string   // Expression filtering benchmarks to run (go test -bench)
+	Reps            string   // Number of times each benchmark is repeated (go test -count)
+	MinRuntime      string   // Minimum runtime of each benchmark (go test -benchtime)
+	Timeout         string   // Maximum time for all benchmarks to run (go test -timeout)
+	GoPath          string   // Go executable path
+	GoExperiment    string   // GOEXPERIMENT value
+	CleanupCommand  string   // Command to run on exit
+	TestCPUs        string   // Comma-separated list of GOMAXPROCS values (go test -cpu)
+	BenchMem        string   // "true" to print memory allocation statistics (go test -benchmem)
+	BuildTags       string   // Comma-separated list of build tags (go test -tags)
+	GcFlags         string   // Compiler flags (go test -gcflags)
+	LdFlags         string   // Linker flags (go test -ldflags)
+	Env             []string // Extra environment variables for go test, as KEY=VALUE
+	GoFlags         string   // GOFLAGS value
+	CleanBuildCache string   // "true" to build with an empty build cache private to the job
+	Profiles        []string // Profiles to collect (cpu, mem, mutex, block, trace), by running the benchmarks once more
+	GoModCache      string   // Module cache shared by the worker jobs (GOMODCACHE), if set
+	GoBuildCache    string   // Build cache shared by the worker jobs (GOCACHE), if set
+}
+
+func newScriptValues(jobDirPath string, params *core.JobParameters) scriptValues {
+	profiles := make([]string, len(params.Profiles))
+	for i, kind := range params.Profiles {
+		profiles[i] = string(kind)
+	}
+	return scriptValues{
+		JobDirPath:      jobDirPath,
+		ResultsPath:     filepath.Join(jobDirPath, kResultsFilename),
+		ShaPath:         filepath.Join(jobDirPath, kShaFilename),
+		GoVersionPath:   filepath.Join(jobDirPath, kGoversionFilename),
+		StagePath:       filepath.Join(jobDirPath, kStageFilename),
+		GoCacheInfoPath: filepath.Join(jobDirPath, kGoCacheInfoFilename),
+		ProfilesPath:    filepath.Join(jobDirPath, kProfilesDirname),
+		GitRemote:       params.GitRemote,
+		GitRef:          params.GitRef,
+		TestsSubDir:     params.TestsSubDir,
+		TestsFilterExpr: params.TestsFilterExpr,
+		Reps:            fmt.Sprintf("%d", params.Reps),
+		MinRuntime:      fmt.Sprintf("%v", params.TestMinRuntime),
+		Timeout:         fmt.Sprintf("%v", params.Timeout),
+		GoPath:          params.GoPath,
+		GoExperiment:    params.GoExperiment,
+		CleanupCommand:  params.CleanupCmd,
+		TestCPUs:        params.TestCPUs,
+		BenchMem:        strconv.FormatBool(params.BenchMem),
+		BuildTags:       params.BuildTags,
+		GcFlags:         params.GcFlags,
+		LdFlags:         params.LdFlags,
+		Env:             params.Env,
+		GoFlags:         params.GoFlags,
+		CleanBuildCache: strconv.FormatBool(params.CleanBuildCache),
+		Profiles:        profiles,
+	}
+}
+
+// Load the benchmark script template from the given path (the embedded one if empty), and check it expands without
+// errors. Returns the parsed template and its hash.
+func loadScriptTemplate(path string) (*template.Template, string, error) {
+	text := runScriptTmpl
+	if path != "" {
+		textBytes, err := os.ReadFile(path)
+		if err != nil {
+			return nil, "", fmt.Errorf("failed to read script template: %w", err)
+		}
+		text = string(textBytes)
+	}
+
+	tmpl, err := template.New("benchmark_script").Funcs(scriptTemplateFuncs).Parse(text)
+	if err != nil {
+		return nil, "", fmt.Errorf("invalid script template: %w", err)
+	}
+
+	// Expand with sample values, to catch references to values that do not exist
+	sampleParams := core.JobParameters{
+		GitRemote:       "https://github.com/synadia-labs/go-bench-away.git",
+		GitRef:          "main",
+		TestsSubDir:     ".",
+		TestsFilterExpr: ".*",
+		Reps:            1,
+		TestMinRuntime:  time.Second,
+		Timeout:         time.Minute,
+		Env:             []string{"KEY=VALUE"},
+		Profiles:        core.ProfileKindsAll,
+	}
+	sampleValues := newScriptValues(os.TempDir(), &sampleParams)
+	sampleValues.GitMirrorPath = filepath.Join(os.TempDir(), "mirror.git")
+	sampleValues.GoModCache = filepath.Join(os.TempDir(), "gomodcache")
+	sampleValues.GoBuildCache = filepath.Join(os.TempDir(), "gocache")
+	if err := tmpl.Execute(io.Discard, sampleValues); err != nil {
+		return nil, "", fmt.Errorf("invalid script template: %w", err)
+	}
+
+	return tmpl, fmt.Sprintf("sha256:%x", sha256.Sum256([]byte(text))), nil
+}
@@ -0,0 +1,129 @@
+package worker
+
+import (
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/synadia-labs/go-bench-away/v1/core"
+	"golang.org/x/sys/unix"
+)
+
+// A job slot, the worker runs one job at a time in each of its slots
+type slot struct {
+	index      int
+	cpus       []int           // CPUs the jobs running in this slot are pinned to (empty: not pinned)
+	workerInfo core.WorkerInfo // Worker info recorded in the jobs running in this slot
+}
+
+// Create the given number of slots, each pinned to its own set of CPUs (unless cpusPerSlot is 0)
+func newSlots(workerInfo core.WorkerInfo, count, cpusPerSlot int) ([]*slot, error) {
+	if count < 1 {
+		return nil, fmt.Errorf("invalid number of slots: %d", count)
+	} else if cpusPerSlot < 0 {
+		return nil, fmt.Errorf("invalid number of CPUs per slot: %d", cpusPerSlot)
+	}
+
+	var cpus []int
+	if cpusPerSlot > 0 {
+		var err error
+		cpus, err = availableCPUs()
+		if err != nil {
+			return nil, fmt.Errorf("failed to get available CPUs: %w", err)
+		} else if count*cpusPerSlot > len(cpus) {
+			return nil, fmt.Errorf("%d slots of %d CPUs need more than the %d CPUs available", count, cpusPerSlot, len(cpus))
+		}
+	}
+
+	slots := make([]*slot, count)
+	for i := range slots {
+		slots[i] = &slot{
+			index:      i,
+			workerInfo: workerInfo,
+		}
+		if cpusPerSlot > 0 {
+			slots[i].cpus = cpus[i*cpusPerSlot : (i+1)*cpusPerSlot]
+			slots[i].workerInfo.CPUSet = formatCPUList(slots[i].cpus)
+			slots[i].workerInfo.NUMANode = numaNodes(slots[i].cpus)
+		}
+	}
+	return slots, nil
+}
+
+// CPUs this process is allowed to run on, in ascending order
+func availableCPUs() ([]int, error) {
+	var set unix.CPUSet
+	if err := unix.SchedGetaffinity(0, &set); err != nil {
+		return nil, err
+	}
+	cpus := make([]int, 0, set.Count())
+	for cpu := 0; len(cpus) < set.Count(); cpu++ {
+		if set.IsSet(cpu) {
+			cpus = append(cpus, cpu)
+		}
+	}
+	return cpus, nil
+}
+
+// Format a sorted list of CPUs (or NUMA nodes) in the kernel list format, e.g. "0-3,8,10-11"
+func formatCPUList(cpus []int) string {
+	ranges := []string{}
+	for i := 0; i < len(cpus); {
+		j := i
+		for j+1 < len(cpus) && cpus[j+1] == cpus[j]+1 {
+			j++
+		}
+		if i == j {
+			ranges = append(ranges, strconv.Itoa(cpus[i]))
+		} else {
+			ranges = append(ranges, fmt.Sprintf("%d-%d", cpus[i], cpus[j]))
+		}
+		i = j + 1
+	}
+	return strings.Join(ranges, ",")
+}
+
+// NUMA node(s) of the given CPUs, in list format (empty if unknown)
+func numaNodes(cpus []int) string {
+	nodesSet := map[int]bool{}
+	for _, cpu := range cpus {
+		nodePaths, _ := filepath.Glob(fmt.Sprintf("/sys/devices/system/cpu/cpu%d/node[0-9]*", cpu))
+		for _, nodePath := range nodePaths {
+			if node, err := strconv.Atoi(strings.TrimPrefix(filepath.Base(nodePath), "node")); err == nil {
+				nodesSet[node] = true
+			}
+		}
+	}
+	nodes := make([]int, 0, len(nodesSet))
+	for node := range nodesSet {
+		nodes = append(nodes, node)
+	}
+	sort.Ints(nodes)
+	return formatCPUList(nodes)
+}
+
+// Start the command pinned to the given CPUs, the affinity is inherited by all processes it starts
+func startPinned(cmd *exec.Cmd, cpus []int) error {
+	errCh := make(chan error, 1)
+	go func() {
+		// The command inherits the affinity of the thread that forks it.
+		// The thread is never unlocked, so it is discarded when this goroutine exits rather than reused.
+		runtime.LockOSThread()
+
+		var set unix.CPUSet
+		set.Zero()
+		for _, cpu := range cpus {
+			set.Set(cpu)
+		}
+		if err := unix.SchedSetaffinity(0, &set); err != nil {
+			errCh <- fmt.Errorf("failed to set CPU affinity: %w", err)
+			return
+		}
+		errCh <- cmd.Start()
+	}()
+	return <-errCh
+}
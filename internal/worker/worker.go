@@ -3,6 +3,7 @@ package worker
 import (
 	"context"
 	_ "embed"
+	"errors"
 	"fmt"
 	"io"
 	"os"
@@ -10,8 +11,12 @@ import (
 	"path/filepath"
 	"regexp"
 	"strings"
+	"sync"
+	"syscall"
 	"text/template"
+	"time"
 
+	"github.com/google/uuid"
 	"github.com/synadia-labs/go-bench-away/v1/core"
 	"golang.org/x/sys/unix"
 )
@@ -22,13 +27,43 @@ const (
 	kResultsFilename   = "results.txt"
 	kShaFilename       = "sha.txt"
 	kGoversionFilename = "go_version.txt"
+	kStageFilename     = "stage.txt"
+
+	kGoCacheInfoFilename = "go_caches.txt"
+	kProfilesDirname     = "profiles"
 )
 
+// Time allowed for checkout, build and cleanup, on top of the job timeout (which applies to the benchmarks run, and
+// again to the profiling run if any)
+const kTimeoutGracePeriod = 15 * time.Minute
+
+// Time processes are given to exit after SIGTERM, before SIGKILL
+const kKillGracePeriod = 10 * time.Second
+
+// Time allowed to copy the remaining script output once it exits (background processes may keep the output open)
+const kOutputDrainTimeout = 5 * time.Second
+
+// Interval between checks of the job directory size, if limited
+const kDiskUsageCheckInterval = 10 * time.Second
+
 //go:embed scripts/benchmark.sh.tmpl
 var runScriptTmpl string
 
+var (
+	testCPUsRegexp  = regexp.MustCompile(`^[1-9][0-9]*(,[1-9][0-9]*)*$`)
+	buildTagsRegexp = regexp.MustCompile(`^[A-Za-z0-9_.]+(,[A-Za-z0-9_.]+)*$`)
+	envKeyRegexp    = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+)
+
+var scriptTemplateFuncs = template.FuncMap{
+	"shellquote": shellQuote,
+}
+
 type Worker interface {
+	// Run processes jobs until the context is closed (interrupting the current job), or until drained
 	Run(context.Context) error
+	// Drain stops picking up new jobs, Run returns once the current job (if any) completes
+	Drain(reason string)
 }
 
 type workerImpl struct {
@@ -37,10 +72,40 @@ type workerImpl struct {
 	workerInfo              core.WorkerInfo
 	scriptTemplate          *template.Template
 	testSkipRun             bool
+	heartbeatInterval       time.Duration
+	diskCheckInterval       time.Duration
+	timeoutGracePeriod      time.Duration
 	allowedGitRemoteRegexes []*regexp.Regexp
+	environmentPolicy       EnvironmentPolicy
+	gitCache                *gitCache
+	goModCacheDir           string
+	goBuildCacheDir         string
+	resourceLimits          ResourceLimits
+	cgroups                 *cgroupManager // Creates a cgroup for each job (nil if jobs do not run in a cgroup)
+	registration            core.WorkerRecord
+	registrationLock        sync.Mutex
+	slots                   []*slot
+	slotJobs                []string // ID of the job running in each slot (empty if idle), guarded by registrationLock
+	drainCh                 chan struct{}
+	drainOnce               sync.Once
 }
 
-func NewWorker(c WorkerClient, jobsDir string, allowedGitRemoteExpr []string) (Worker, error) {
+// Config holds the worker settings, the zero value is a worker running one job at a time with no restrictions
+type Config struct {
+	JobsDir              string            // Directory where jobs are staged (default: os.MkdirTemp default)
+	AllowedGitRemoteExpr []string          // Regexes restricting which git remotes can be targeted (empty: any)
+	Slots                int               // Number of jobs to run concurrently (default: 1)
+	CPUsPerSlot          int               // If not zero, each job slot is pinned to its own set of this many CPUs
+	EnvironmentPolicy    EnvironmentPolicy // Host conditions checked before running each job
+	ScriptTemplatePath   string            // Custom benchmark script template (default: the embedded one)
+	GitCacheDir          string            // Directory where mirrors of git remotes are kept (empty: no cache)
+	GitCacheMaxSize      int64             // Size in bytes above which least recently used mirrors are evicted (0: no limit)
+	GoModCacheDir        string            // Go module cache shared by jobs (empty: the worker user default)
+	GoBuildCacheDir      string            // Go build cache shared by jobs (empty: the worker user default)
+	ResourceLimits       ResourceLimits    // Resources each job can use
+}
+
+func NewWorker(c WorkerClient, config Config) (Worker, error) {
 	// Utsname byte arrays are filled with string termination characters,
 	// and naive string conversion preserves them.
 	bts := func(buf []byte) string {
@@ -56,9 +121,9 @@ func NewWorker(c WorkerClient, jobsDir string, allowedGitRemoteExpr []string) (W
 	}
 
 	var allowedGitRemoteRegexes []*regexp.Regexp
-	if len(allowedGitRemoteExpr) > 0 {
-		allowedGitRemoteRegexes = make([]*regexp.Regexp, 0, len(allowedGitRemoteExpr))
-		for _, expr := range allowedGitRemoteExpr {
+	if len(config.AllowedGitRemoteExpr) > 0 {
+		allowedGitRemoteRegexes = make([]*regexp.Regexp, 0, len(config.AllowedGitRemoteExpr))
+		for _, expr := range config.AllowedGitRemoteExpr {
 			regex, err := regexp.Compile(expr)
 			if err != nil {
 				return nil, fmt.Errorf("invalid git remote regex: %s: %w", regex, err)
@@ -67,58 +132,237 @@ func NewWorker(c WorkerClient, jobsDir string, allowedGitRemoteExpr []string) (W
 		}
 	}
 
+	scriptTemplate, scriptTemplateHash, err := loadScriptTemplate(config.ScriptTemplatePath)
+	if err != nil {
+		return nil, err
+	}
+
+	var cache *gitCache
+	if config.GitCacheDir != "" {
+		cache, err = newGitCache(config.GitCacheDir, config.GitCacheMaxSize)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	for _, dir := range []string{config.GoModCacheDir, config.GoBuildCacheDir} {
+		if dir == "" {
+			continue
+		} else if !filepath.IsAbs(dir) {
+			return nil, fmt.Errorf("Go cache directory must be an absolute path: %s", dir)
+		} else if err := os.MkdirAll(dir, 0750); err != nil {
+			return nil, fmt.Errorf("failed to create Go cache directory: %w", err)
+		}
+	}
+
+	var cgroups *cgroupManager
+	if config.ResourceLimits.usesCgroup() {
+		cgroups, err = newCgroupManager(config.ResourceLimits)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	workerInfo := core.WorkerInfo{
+		Hostname:       bts(buf.Nodename[:]),
+		Uname:          fmt.Sprintf("%s_%s-%s", bts(buf.Sysname[:]), bts(buf.Release[:]), bts(buf.Machine[:])),
+		Version:        fmt.Sprintf("%s (%s)", core.Version, core.SHA),
+		ScriptTemplate: scriptTemplateHash,
+		ResourceLimits: config.ResourceLimits.String(),
+	}
+
+	slots := config.Slots
+	if slots == 0 {
+		slots = 1
+	}
+	jobSlots, err := newSlots(workerInfo, slots, config.CPUsPerSlot)
+	if err != nil {
+		return nil, err
+	}
+
 	return &workerImpl{
-		c:       c,
-		jobsDir: jobsDir,
-		workerInfo: core.WorkerInfo{
-			Hostname: bts(buf.Nodename[:]),
-			Uname:    fmt.Sprintf("%s_%s-%s", bts(buf.Sysname[:]), bts(buf.Release[:]), bts(buf.Machine[:])),
-			Version:  fmt.Sprintf("%s (%s)", core.Version, core.SHA),
-		},
-		scriptTemplate:          template.Must(template.New("benchmark_script").Parse(runScriptTmpl)),
+		c:                       c,
+		jobsDir:                 config.JobsDir,
+		workerInfo:              workerInfo,
+		scriptTemplate:          scriptTemplate,
 		allowedGitRemoteRegexes: allowedGitRemoteRegexes,
+		heartbeatInterval:       kHeartbeatInterval,
+		diskCheckInterval:       kDiskUsageCheckInterval,
+		timeoutGracePeriod:      kTimeoutGracePeriod,
+		environmentPolicy:       config.EnvironmentPolicy,
+		gitCache:                cache,
+		goModCacheDir:           config.GoModCacheDir,
+		goBuildCacheDir:         config.GoBuildCacheDir,
+		resourceLimits:          config.ResourceLimits,
+		cgroups:                 cgroups,
+		slots:                   jobSlots,
+		slotJobs:                make([]string, len(jobSlots)),
+		drainCh:                 make(chan struct{}),
+		registration: core.WorkerRecord{
+			Id:         uuid.New().String(),
+			WorkerInfo: workerInfo,
+			Queue:      c.QueueName(),
+			Slots:      len(jobSlots),
+		},
 	}, nil
 }
 
 func (w *workerImpl) Run(ctx context.Context) error {
 
-	handleJob := func(jr *core.JobRecord, revision uint64) (bool, error) {
-		return w.processJob(jr, revision)
+	// Closing ctx interrupts the current job, while draining only stops dispatching new ones
+	dispatchCtx, stopDispatch := context.WithCancel(ctx)
+	defer stopDispatch()
+	go func() {
+		select {
+		case <-w.drainCh:
+			stopDispatch()
+		case <-dispatchCtx.Done():
+		}
+	}()
+
+	// Register while running, and unregister on the way out
+	w.registration.Started = time.Now().UTC()
+	w.register()
+	registrationCtx, stopRegistration := context.WithCancel(ctx)
+	go w.keepRegistered(registrationCtx)
+	defer func() {
+		stopRegistration()
+		w.unregister()
+	}()
+
+	stopListening, err := w.c.OnDrainRequest(w.registration.Id, func(requester string) {
+		w.Drain(fmt.Sprintf("requested by %s", requester))
+	})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Worker cannot be drained remotely: %v\n", err)
+	} else {
+		defer stopListening()
+	}
+
+	fmt.Printf("⚙️  Ready for work (worker: %s, slots: %d)\n", w.registration.Id, len(w.slots))
+
+	// Each slot dispatches and runs jobs independently
+	dispatchErrs := make(chan error, len(w.slots))
+	for _, s := range w.slots {
+		s := s
+		go func() {
+			dispatchErrs <- w.c.DispatchJobs(dispatchCtx, func(jr *core.JobRecord, revision uint64) (bool, error) {
+				return w.processJob(ctx, s, jr, revision)
+			})
+		}()
+	}
+
+	var dispatchErr error
+	for range w.slots {
+		if err := <-dispatchErrs; err != nil && dispatchErr == nil {
+			// Stop the other slots too, after their current job
+			dispatchErr = err
+			stopDispatch()
+		}
+	}
+
+	select {
+	case <-w.drainCh:
+		// Stopped as requested
+		fmt.Printf("⚙️  Drained, exiting\n")
+		return nil
+	default:
+		return dispatchErr
 	}
-	fmt.Printf("⚙️  Ready for work\n")
-	return w.c.DispatchJobs(ctx, handleJob)
 }
 
-func (w *workerImpl) processJob(job *core.JobRecord, revision uint64) (bool, error) {
+func (w *workerImpl) Drain(reason string) {
+	w.drainOnce.Do(func() {
+		fmt.Printf("⚙️  Draining (%s), exiting after the current job\n", reason)
+		close(w.drainCh)
+		w.registerDraining()
+	})
+}
+
+func (w *workerImpl) processJob(ctx context.Context, s *slot, job *core.JobRecord, revision uint64) (bool, error) {
 
 	if job.Status != core.Submitted {
 		return false, fmt.Errorf("Cannot process job %s in status %v", job.Id, job.Status)
 	}
 
 	job.SetRunningStatus()
-	job.WorkerInfo = w.workerInfo
+	job.WorkerInfo = s.workerInfo
 
 	newRevision, err := w.c.UpdateJob(job, revision)
 	if err != nil {
-		// TODO: retry if error is transitional
-		return false, fmt.Errorf("Failed to update job %s: %v", job.Id, err)
+		// Record is unchanged, the job is still Submitted and can be dispatched again
+		// (unless the error is due to a concurrent update, e.g. cancellation, then it is skipped)
+		return true, fmt.Errorf("Failed to update job %s: %v", job.Id, err)
 	}
 
-	fmt.Printf("⚙️  Processing job %s\n", job.Id)
+	fmt.Printf("⚙️  Processing job %s (attempt %d, slot %d)\n", job.Id, job.CurrentAttempt(), s.index)
+
+	w.registerJob(s, job.Id)
+	defer w.registerJob(s, "")
+
+	// Note recorded in the job history along with the final status
+	var finalNote string
+	// Job was stopped because the worker is shutting down, and should run again elsewhere
+	var interrupted bool
+
+	// Accept cancellation requests until the final status is recorded: the job context is cancelled (with the
+	// cancellation as cause) when someone cancels the job, or when the worker is shutting down
+	jobCtx, stopJob := context.WithCancelCause(ctx)
+	defer stopJob(nil)
+	stopListening, err := w.c.OnCancelRequest(job.Id, func(requester string) {
+		fmt.Printf("⚙️  Cancelling job %s (requested by %s)\n", job.Id, requester)
+		stopJob(&jobCancellation{requester: requester})
+	})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Job %s cannot be cancelled: %v\n", job.Id, err)
+		stopListening = func() {}
+	}
 
 	if allowed, denyReasonErr := w.isAllowed(job); !allowed {
 		fmt.Fprintf(os.Stderr, "Job %s is not allowed to run: %v\n", job.Id, denyReasonErr)
-		job.SetFinalStatus(core.Failed)
+		job.SetFailedStatus(core.NotAllowedFailure, "%v", denyReasonErr)
+		goto finalStatusUpdate
+	}
+
+	if validationErr := validateParameters(&job.Parameters); validationErr != nil {
+		fmt.Fprintf(os.Stderr, "Job %s has invalid parameters: %v\n", job.Id, validationErr)
+		job.SetFailedStatus(core.InvalidParametersFailure, "%v", validationErr)
 		goto finalStatusUpdate
 	}
 
+	// Record the state of the host, and check it is fit for benchmarking
+	job.WorkerInfo.Environment = collectEnvironment(s.cpus)
+	if violations := w.environmentPolicy.check(job.WorkerInfo.Environment); len(violations) > 0 {
+		job.WorkerInfo.Environment.Warnings = violations
+		fmt.Fprintf(os.Stderr, "Job %s environment policy violations: %s\n", job.Id, strings.Join(violations, "; "))
+		if w.environmentPolicy.Enforce {
+			job.SetFailedStatus(core.EnvironmentFailure, "Unstable environment: %s", strings.Join(violations, "; "))
+			goto finalStatusUpdate
+		}
+	}
+
 	// Run the job
 	{
-		jobTempDir, runErr := w.runJob(job)
+		// Keep the job record heartbeat fresh while the job runs and its artifacts are uploaded
+		hb := startHeartbeat(w.c, job, newRevision, w.heartbeatInterval)
+
+		jobTempDir, runErr := w.runJob(jobCtx, s, job)
 
 		// Update job status to final
-		if runErr != nil {
-			job.SetFinalStatus(core.Failed)
+		var cancellation *jobCancellation
+		var timeout *jobTimeout
+		var interruption *jobInterruption
+		if errors.As(runErr, &cancellation) {
+			job.SetFinalStatus(core.Cancelled)
+			finalNote = cancellation.Error()
+		} else if errors.As(runErr, &timeout) || failureCategory(runErr) == core.TimeoutFailure {
+			// Stopped by the worker past the deadline, or by `go test` past the job timeout
+			job.SetTimedOutStatus(core.TimeoutFailure, "%v", runErr)
+		} else if errors.As(runErr, &interruption) {
+			job.SetFailedStatus(core.WorkerFailure, "%v", runErr)
+			interrupted = true
+		} else if runErr != nil {
+			job.SetFailedStatus(failureCategory(runErr), "%v", runErr)
 		} else {
 			job.SetFinalStatus(core.Succeeded)
 		}
@@ -127,9 +371,13 @@ func (w *workerImpl) processJob(job *core.JobRecord, revision uint64) (bool, err
 		uploadErr := w.uploadArtifacts(job, jobTempDir)
 		if uploadErr != nil {
 			fmt.Fprintf(os.Stderr, "Job %s artifacts upload failed: %v\n", job.Id, uploadErr)
-			job.Status = core.Failed
+			if job.Status == core.Succeeded {
+				job.SetFailedStatus(core.ArtifactsFailure, "%v", uploadErr)
+			}
 		}
 
+		job.Heartbeat, newRevision = hb.stop()
+
 		// Remove job directory
 		if jobTempDir != "" && !job.Parameters.SkipCleanup {
 			defer os.RemoveAll(jobTempDir)
@@ -137,8 +385,42 @@ func (w *workerImpl) processJob(job *core.JobRecord, revision uint64) (bool, err
 	}
 
 finalStatusUpdate:
+	stopListening()
+	var cancellation *jobCancellation
+	if errors.As(context.Cause(jobCtx), &cancellation) && job.Status != core.Cancelled {
+		// Cancelled before or after the script ran (e.g. while uploading artifacts)
+		job.SetFinalStatus(core.Cancelled)
+		job.FailureReason = nil
+		finalNote = cancellation.Error()
+		interrupted = false
+	}
+
+	if interrupted {
+		fmt.Printf("⚙️  Job %s interrupted, requeueing\n", job.Id)
+		// Not a failure of the job, the attempt runs again without counting towards its retry policy
+		job.RestartAttempt()
+		note := fmt.Sprintf(
+			"Requeued after attempt %d was interrupted by %s shutdown",
+			job.CurrentAttempt(),
+			w.workerInfo.Hostname,
+		)
+		if _, err := w.c.UpdateJobWithNote(job, newRevision, note); err != nil {
+			return false, fmt.Errorf("Failed to requeue job %s: %v", job.Id, err)
+		}
+		return true, nil
+	}
+
+	if job.ShouldRetry() {
+		fmt.Printf("⚙️  Job %s attempt %d failed, requeueing\n", job.Id, job.CurrentAttempt())
+		note := job.Requeue()
+		if _, err := w.c.UpdateJobWithNote(job, newRevision, note); err != nil {
+			return false, fmt.Errorf("Failed to requeue job %s: %v", job.Id, err)
+		}
+		return true, nil
+	}
+
 	fmt.Printf("⚙️  Completed job %s, updating status to: %s\n", job.Id, job.Status)
-	_, finalUpdateErr := w.c.UpdateJob(job, newRevision)
+	_, finalUpdateErr := w.c.UpdateJobWithNote(job, newRevision, finalNote)
 	if finalUpdateErr != nil {
 		// TODO: retry if error is transitional
 		return false, fmt.Errorf("Failed to update job %s: %v", job.Id, finalUpdateErr)
@@ -147,7 +429,7 @@ finalStatusUpdate:
 	return false, nil
 }
 
-func (w *workerImpl) runJob(job *core.JobRecord) (string, error) {
+func (w *workerImpl) runJob(ctx context.Context, s *slot, job *core.JobRecord) (string, error) {
 
 	jobTempDir, err := os.MkdirTemp(w.jobsDir, fmt.Sprintf("go-bench-away-job-%s-", job.Id))
 	if err != nil {
@@ -158,50 +440,37 @@ func (w *workerImpl) runJob(job *core.JobRecord) (string, error) {
 		return jobTempDir, nil
 	}
 
+	// Everything from here (including the git mirror update) runs under the job deadline, if any
+	deadline := w.jobDeadline(&job.Parameters)
+	runCtx, cancelRun := ctx, context.CancelFunc(func() {})
+	if deadline > 0 {
+		runCtx, cancelRun = context.WithTimeout(ctx, deadline)
+	}
+	defer cancelRun()
+
 	scriptPath := filepath.Join(jobTempDir, kScriptFilename)
 	logPath := filepath.Join(jobTempDir, kLogFilename)
-	resultsPath := filepath.Join(jobTempDir, kResultsFilename)
 	shaPath := filepath.Join(jobTempDir, kShaFilename)
 	goVersionPath := filepath.Join(jobTempDir, kGoversionFilename)
+	stagePath := filepath.Join(jobTempDir, kStageFilename)
 
 	scriptFile, err := os.Create(scriptPath)
 	if err != nil {
 		return jobTempDir, fmt.Errorf("Failed to create script: %v", err)
 	}
 
-	scriptTemplateValues := struct {
-		JobDirPath      string
-		ResultsPath     string
-		ShaPath         string
-		GoVersionPath   string
-		GitRemote       string
-		GitRef          string
-		TestsSubDir     string
-		TestsFilterExpr string
-		Reps            string
-		MinRuntime      string
-		Timeout         string
-		GoPath          string
-		GoExperiment    string
-		CleanupCommand  string
-	}{
-		JobDirPath:      jobTempDir,
-		ResultsPath:     resultsPath,
-		ShaPath:         shaPath,
-		GoVersionPath:   goVersionPath,
-		GitRemote:       job.Parameters.GitRemote,
-		GitRef:          job.Parameters.GitRef,
-		TestsSubDir:     job.Parameters.TestsSubDir,
-		TestsFilterExpr: job.Parameters.TestsFilterExpr,
-		Reps:            fmt.Sprintf("%d", job.Parameters.Reps),
-		MinRuntime:      fmt.Sprintf("%v", job.Parameters.TestMinRuntime),
-		Timeout:         fmt.Sprintf("%v", job.Parameters.Timeout),
-		GoPath:          job.Parameters.GoPath,
-		GoExperiment:    job.Parameters.GoExperiment,
-		CleanupCommand:  job.Parameters.CleanupCmd,
-	}
-
-	err = w.scriptTemplate.Execute(scriptFile, scriptTemplateValues)
+	scriptValues := newScriptValues(jobTempDir, &job.Parameters)
+	scriptValues.GoModCache = w.goModCacheDir
+	scriptValues.GoBuildCache = w.goBuildCacheDir
+
+	// Let the script clone from the local mirror of the remote, if the git cache is enabled
+	if w.gitCache != nil {
+		var releaseMirror func()
+		scriptValues.GitMirrorPath, releaseMirror = w.gitCache.acquire(runCtx, job.Parameters.GitRemote)
+		defer releaseMirror()
+	}
+
+	err = w.scriptTemplate.Execute(scriptFile, scriptValues)
 	if err != nil {
 		return jobTempDir, fmt.Errorf("Failed to write job script: %v", err)
 	}
@@ -218,24 +487,104 @@ func (w *workerImpl) runJob(job *core.JobRecord) (string, error) {
 	}
 	defer logFile.Close()
 
-	// Tee output to logfile and worker stdout
-	mw := io.MultiWriter(logFile, os.Stdout)
+	// Publish output while the job runs, for clients following the log
+	liveLog := w.c.PublishJobLog(job.Id, job.CurrentAttempt())
+	defer liveLog.Close()
+
+	// Tee output to logfile, worker stdout and live log
+	mw := io.MultiWriter(logFile, os.Stdout, liveLog)
+
+	// Cancelled, worker shutting down, or past the deadline before the script starts (e.g. while updating the mirror)
+	if stopReason, _ := jobStopReason(ctx); stopReason != nil {
+		return jobTempDir, stopReason
+	} else if runCtx.Err() != nil {
+		return jobTempDir, &jobTimeout{deadline: deadline}
+	}
 
 	cmd := exec.CommandContext(context.Background(), scriptPath)
 
-	cmd.Stdout = mw
-	cmd.Stderr = mw
+	// Run the script in its own process group, so it can be stopped along with all its children
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+
+	// Start the script directly in its own cgroup, so the limits apply to all its children from the start
+	var cgroup *jobCgroup
+	if w.cgroups != nil {
+		cgroup, err = w.cgroups.create(fmt.Sprintf("job-%s-%d", job.Id, job.CurrentAttempt()))
+		if err != nil {
+			return jobTempDir, fmt.Errorf("Failed to create job cgroup: %v", err)
+		}
+		defer cgroup.remove()
+		cmd.SysProcAttr.UseCgroupFD = true
+		cmd.SysProcAttr.CgroupFD = cgroup.fd()
+	}
 
-	err = cmd.Start()
+	// Copy output through a pipe owned here rather than by cmd, so it can be drained once the script exits
+	outputReader, outputWriter, err := os.Pipe()
+	if err != nil {
+		return jobTempDir, fmt.Errorf("Failed to create output pipe: %v", err)
+	}
+	defer outputReader.Close()
+	outputCopied := make(chan struct{})
+	go func() {
+		_, _ = io.Copy(mw, outputReader)
+		close(outputCopied)
+	}()
+
+	cmd.Stdout = outputWriter
+	cmd.Stderr = outputWriter
+
+	if len(s.cpus) > 0 {
+		err = startPinned(cmd, s.cpus)
+	} else {
+		err = cmd.Start()
+	}
+	// The script has its own copy of the pipe write end, output is copied until it (and its children) close it
+	outputWriter.Close()
 	if err != nil {
 		return jobTempDir, fmt.Errorf("Failed to launch job %s: %w", job.Id, err)
 	}
 
+	group := newProcessGroup(cmd.Process.Pid)
+
+	// Stop the script if someone cancels the job, if it runs past its deadline (if any), or if the worker is shutting
+	// down
+	go func() {
+		select {
+		case <-group.doneCh:
+		case <-runCtx.Done():
+			if stopReason, cancelled := jobStopReason(ctx); cancelled {
+				group.stop(stopReason, 0)
+			} else if stopReason != nil {
+				fmt.Printf("⚙️  Stopping job %s, worker shutting down\n", job.Id)
+				group.stop(stopReason, kKillGracePeriod)
+			} else {
+				fmt.Printf("⚙️  Stopping job %s, deadline exceeded\n", job.Id)
+				group.stop(&jobTimeout{deadline: deadline}, kKillGracePeriod)
+			}
+		}
+	}()
+
+	// Stop the script if the job directory grows past its limit
+	if w.resourceLimits.DiskMax > 0 {
+		go w.limitDiskUsage(job, jobTempDir, group)
+	}
+
 	procState, waitErr := cmd.Process.Wait()
+	stopReason := group.exited()
+	select {
+	case <-outputCopied:
+	case <-time.After(kOutputDrainTimeout):
+		// Unblock the copy, output of processes left behind is lost
+		outputReader.Close()
+		<-outputCopied
+	}
 	if waitErr != nil {
 		return jobTempDir, fmt.Errorf("Error waiting for termination of job %s: %s", job.Id, waitErr)
 	}
 
+	job.RunStats = runStats(procState, cgroup, jobTempDir)
+	fmt.Printf("⚙️  Job %s resources used: %s\n", job.Id, job.RunStats)
+
 	shaBytes, err := os.ReadFile(shaPath)
 	if err == nil {
 		job.SHA = strings.TrimSpace(string(shaBytes))
@@ -250,41 +599,150 @@ func (w *workerImpl) runJob(job *core.JobRecord) (string, error) {
 		job.GoVersion = "?"
 	}
 	job.GoExperiment = job.Parameters.GoExperiment
+	job.GoCaches = readGoCacheInfo(filepath.Join(jobTempDir, kGoCacheInfoFilename))
 
-	if procState.ExitCode() != 0 {
-		return jobTempDir, fmt.Errorf("Non-zero exit code")
+	runErr := stopReason
+	if runErr == nil && procState.ExitCode() != 0 {
+		// Processes killed or failing to fork because of a limit usually fail the script, report why
+		if cgroup != nil {
+			runErr = cgroup.limitExceeded(w.resourceLimits)
+		}
+		if runErr == nil {
+			runErr = newJobFailure(
+				scriptStageFailureCategory(stagePath),
+				"Non-zero exit code (%d): %s",
+				procState.ExitCode(),
+				lastLogLine(logPath),
+			)
+		}
 	}
 
-	return jobTempDir, nil
+	// Results were measured before profiling, which is a diagnostic aid: unless someone stopped the job,
+	// keep the results if profiling fails (dropping partial profiles)
+	var cancellation *jobCancellation
+	var interruption *jobInterruption
+	if runErr != nil && readScriptStage(stagePath) == "profile" &&
+		!errors.As(runErr, &cancellation) && !errors.As(runErr, &interruption) {
+		fmt.Printf("⚙️  Job %s stopped while profiling: %v\n", job.Id, runErr)
+		_, _ = fmt.Fprintf(logFile, "⚠️  Profiling stopped, no profiles collected: %v\n", runErr)
+		_ = os.RemoveAll(filepath.Join(jobTempDir, kProfilesDirname))
+		return jobTempDir, nil
+	}
+
+	return jobTempDir, runErr
+}
+
+// Time the job script is allowed to run: the job timeout for the benchmarks run, and again for the profiling run if
+// any, plus a grace period for checkout, build and cleanup. Jobs without timeout (like `go test -timeout 0`) have no
+// deadline (0).
+func (w *workerImpl) jobDeadline(params *core.JobParameters) time.Duration {
+	if params.Timeout == 0 {
+		return 0
+	}
+	deadline := params.Timeout + w.timeoutGracePeriod
+	if len(params.Profiles) > 0 {
+		deadline += params.Timeout
+	}
+	return deadline
+}
+
+// Stop the job process group if the job directory size exceeds the limit, checked until the group exits
+func (w *workerImpl) limitDiskUsage(job *core.JobRecord, jobDirPath string, group *processGroup) {
+	ticker := time.NewTicker(w.diskCheckInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-group.doneCh:
+			return
+		case <-ticker.C:
+			if size := dirSize(jobDirPath); size > w.resourceLimits.DiskMax {
+				fmt.Printf("⚙️  Stopping job %s, disk usage limit exceeded\n", job.Id)
+				group.stop(
+					newJobFailure(
+						core.ResourceLimitFailure,
+						"Disk usage limit exceeded (%d MiB), job directory size: %d MiB",
+						w.resourceLimits.DiskMax>>20,
+						size>>20,
+					),
+					kKillGracePeriod,
+				)
+				return
+			}
+		}
+	}
+}
+
+// Resources used by the job script and its children, from its cgroup if it ran in one (more accurate: the peak memory
+// of the process tree, rather than of its biggest process), from the resource usage of the script process otherwise
+func runStats(procState *os.ProcessState, cgroup *jobCgroup, jobDirPath string) *core.RunStats {
+	stats := &core.RunStats{
+		CPUTime:   procState.UserTime() + procState.SystemTime(),
+		DiskUsage: uint64(dirSize(jobDirPath)),
+	}
+	if rusage, ok := procState.SysUsage().(*syscall.Rusage); ok {
+		// Max RSS is in KiB on Linux
+		stats.PeakMemory = uint64(rusage.Maxrss) * 1024
+	}
+	if cgroup != nil {
+		peakMemory, cpuTime := cgroup.stats()
+		if peakMemory > 0 {
+			stats.PeakMemory = peakMemory
+		}
+		if cpuTime > 0 {
+			stats.CPUTime = cpuTime
+		}
+	}
+	return stats
 }
 
 func (w *workerImpl) uploadArtifacts(job *core.JobRecord, jobDirPath string) error {
 
 	logPath := filepath.Join(jobDirPath, kLogFilename)
-	logArtifactKey, logErr := w.c.UploadLogArtifact(job.Id, logPath)
+	logArtifact := core.AttemptLogArtifact(job.CurrentAttempt())
+	logArtifactKey, logErr := w.c.UploadArtifact(job.Id, logArtifact, logPath, core.TextContentType)
 	if logErr != nil {
 		fmt.Printf("Log artifact upload error: %v\n", logErr)
 	} else {
 		job.Log = logArtifactKey
+		job.AddArtifact(logArtifact, logArtifactKey)
 	}
 
 	resultsPath := filepath.Join(jobDirPath, kResultsFilename)
-	resultsArtifactKey, resultsErr := w.c.UploadResultsArtifact(job.Id, resultsPath)
+	resultsArtifactKey, resultsErr := w.c.UploadArtifact(job.Id, core.ResultsArtifact, resultsPath, core.TextContentType)
 	if resultsErr != nil {
 		fmt.Printf("Results artifact upload error: %v\n", resultsErr)
 	} else {
 		job.Results = resultsArtifactKey
+		job.AddArtifact(core.ResultsArtifact, resultsArtifactKey)
 	}
 
 	scriptPath := filepath.Join(jobDirPath, kScriptFilename)
-	scriptArtifactKey, scriptErr := w.c.UploadScriptArtifact(job.Id, scriptPath)
+	scriptArtifactKey, scriptErr := w.c.UploadArtifact(job.Id, core.ScriptArtifact, scriptPath, core.ScriptContentType)
 	if scriptErr != nil {
 		fmt.Printf("Script artifact upload error: %v\n", scriptErr)
 	} else {
 		job.Script = scriptArtifactKey
+		job.AddArtifact(core.ScriptArtifact, scriptArtifactKey)
 	}
 
-	if logErr != nil || resultsErr != nil || scriptErr != nil {
+	// Profiles are missing if the job failed before profiling, or if profiling failed (does not fail the job)
+	var profilesErr error
+	for _, kind := range job.Parameters.Profiles {
+		profilePath := filepath.Join(jobDirPath, kProfilesDirname, kind.FileName())
+		if _, err := os.Stat(profilePath); err != nil {
+			fmt.Printf("No %s profile for job %s\n", kind, job.Id)
+			continue
+		}
+		profileArtifactKey, err := w.c.UploadArtifact(job.Id, kind.FileName(), profilePath, core.BinaryContentType)
+		if err != nil {
+			fmt.Printf("Profile artifact upload error: %v\n", err)
+			profilesErr = err
+			continue
+		}
+		job.AddArtifact(kind.FileName(), profileArtifactKey)
+	}
+
+	if logErr != nil || resultsErr != nil || scriptErr != nil || profilesErr != nil {
 		return fmt.Errorf("Artifacts upload error")
 	}
 
@@ -308,3 +766,52 @@ func (w *workerImpl) isAllowed(job *core.JobRecord) (bool, error) {
 	// No filtering, allow everything
 	return true, nil
 }
+
+// Validate job parameters that are passed to `go test` as options or environment
+func validateParameters(params *core.JobParameters) error {
+	if params.TestCPUs != "" && !testCPUsRegexp.MatchString(params.TestCPUs) {
+		return fmt.Errorf("invalid CPU list: '%s'", params.TestCPUs)
+	}
+
+	if params.BuildTags != "" && !buildTagsRegexp.MatchString(params.BuildTags) {
+		return fmt.Errorf("invalid build tags: '%s'", params.BuildTags)
+	}
+
+	if hasControlChars(params.GcFlags) {
+		return fmt.Errorf("invalid gcflags: %q", params.GcFlags)
+	}
+
+	if hasControlChars(params.LdFlags) {
+		return fmt.Errorf("invalid ldflags: %q", params.LdFlags)
+	}
+
+	if hasControlChars(params.GoFlags) {
+		return fmt.Errorf("invalid goflags: %q", params.GoFlags)
+	}
+
+	for _, kind := range params.Profiles {
+		if !core.ProfileKindsAll.Contains(kind) {
+			return fmt.Errorf("invalid profile: %q", kind)
+		}
+	}
+
+	for _, kv := range params.Env {
+		key, value, found := strings.Cut(kv, "=")
+		if !found || !envKeyRegexp.MatchString(key) {
+			return fmt.Errorf("invalid environment variable: %q", kv)
+		} else if hasControlChars(value) {
+			return fmt.Errorf("invalid value for environment variable %s: %q", key, value)
+		}
+	}
+
+	return nil
+}
+
+func hasControlChars(s string) bool {
+	return strings.IndexFunc(s, func(r rune) bool { return r < ' ' || r == 0x7f }) >= 0
+}
+
+// Quote a string so it is interpreted literally by the shell
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
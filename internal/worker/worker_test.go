@@ -1,9 +1,18 @@
 package worker
 
 import (
+	"bytes"
 	"context"
+	"errors"
+	"fmt"
+	"io"
 	"os"
+	"os/exec"
 	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"syscall"
 	"testing"
 	"time"
 
@@ -11,35 +20,82 @@ import (
 )
 
 type mockClient struct {
-	StubUpdateJob             func(*core.JobRecord, uint64) (uint64, error)
-	StubUploadLogArtifact     func(string, string) (string, error)
-	StubUploadResultsArtifact func(string, string) (string, error)
-	StubUploadScriptArtifact  func(string, string) (string, error)
+	StubUpdateJob           func(*core.JobRecord, uint64) (uint64, error)
+	StubUpdateJobWithNote   func(*core.JobRecord, uint64, string) (uint64, error)
+	StubUpdateJobFromStatus func(*core.JobRecord, uint64, core.JobStatus, string) (uint64, error)
+	StubUploadArtifact      func(string, string, string, string) (string, error)
+	StubDispatchJobs        func(context.Context, func(*core.JobRecord, uint64) (bool, error)) error
+	registrations           []core.WorkerRecord
+	noWorkersRegistry       bool
+	drainCallback           func(string)
+	cancelCallbacks         chan func(string) // Receives the cancel request callback of each job processed, if set
+	liveLogs                []*mockLiveLog
+}
+
+type mockLiveLog struct {
+	bytes.Buffer
+	jobId   string
+	attempt uint
+	closed  bool
+}
+
+func (l *mockLiveLog) Close() error {
+	l.closed = true
+	return nil
 }
 
 func (c *mockClient) UpdateJob(job *core.JobRecord, rev uint64) (uint64, error) {
 	return c.StubUpdateJob(job, rev)
 }
-func (c *mockClient) UploadLogArtifact(jobId string, path string) (string, error) {
-	return c.StubUploadLogArtifact(jobId, path)
+func (c *mockClient) UpdateJobWithNote(job *core.JobRecord, rev uint64, note string) (uint64, error) {
+	return c.StubUpdateJobWithNote(job, rev, note)
+}
+func (c *mockClient) UpdateJobFromStatus(job *core.JobRecord, rev uint64, from core.JobStatus, note string) (uint64, error) {
+	return c.StubUpdateJobFromStatus(job, rev, from, note)
 }
-func (c *mockClient) UploadResultsArtifact(jobId string, path string) (string, error) {
-	return c.StubUploadResultsArtifact(jobId, path)
+func (c *mockClient) UploadArtifact(jobId, name, path, contentType string) (string, error) {
+	return c.StubUploadArtifact(jobId, name, path, contentType)
 }
-func (c *mockClient) UploadScriptArtifact(jobId string, path string) (string, error) {
-	return c.StubUploadScriptArtifact(jobId, path)
+
+func (c *mockClient) PublishJobLog(jobId string, attempt uint) io.WriteCloser {
+	liveLog := &mockLiveLog{jobId: jobId, attempt: attempt}
+	c.liveLogs = append(c.liveLogs, liveLog)
+	return liveLog
+}
+
+func (c *mockClient) OnCancelRequest(jobId string, callback func(string)) (func(), error) {
+	if c.cancelCallbacks != nil {
+		c.cancelCallbacks <- callback
+	}
+	return func() {}, nil
+}
+func (c *mockClient) OnDrainRequest(workerId string, callback func(string)) (func(), error) {
+	c.drainCallback = callback
+	return func() {}, nil
+}
+func (c *mockClient) QueueName() string        { return "test" }
+func (c *mockClient) HasWorkersRegistry() bool { return !c.noWorkersRegistry }
+func (c *mockClient) RegisterWorker(worker *core.WorkerRecord) error {
+	c.registrations = append(c.registrations, *worker)
+	return nil
 }
+func (c *mockClient) UnregisterWorker(workerId string) error { return nil }
 
 func (c *mockClient) DispatchJobs(ctx context.Context, handleJob func(*core.JobRecord, uint64) (bool, error)) error {
+	if c.StubDispatchJobs != nil {
+		return c.StubDispatchJobs(ctx, handleJob)
+	}
 	return nil
 }
 
 func newMockClient() WorkerClient {
 	return &mockClient{
-		StubUpdateJob:             func(*core.JobRecord, uint64) (uint64, error) { return 0, nil },
-		StubUploadLogArtifact:     func(string, string) (string, error) { return "", nil },
-		StubUploadResultsArtifact: func(string, string) (string, error) { return "", nil },
-		StubUploadScriptArtifact:  func(string, string) (string, error) { return "", nil },
+		StubUpdateJob:         func(*core.JobRecord, uint64) (uint64, error) { return 0, nil },
+		StubUpdateJobWithNote: func(*core.JobRecord, uint64, string) (uint64, error) { return 0, nil },
+		StubUpdateJobFromStatus: func(*core.JobRecord, uint64, core.JobStatus, string) (uint64, error) {
+			return 0, nil
+		},
+		StubUploadArtifact: func(string, string, string, string) (string, error) { return "", nil },
 	}
 }
 
@@ -48,7 +104,7 @@ func TestProcessJob(t *testing.T) {
 	var client WorkerClient = newMockClient()
 	jobsDir := t.TempDir()
 
-	w, err := NewWorker(client, jobsDir, nil)
+	w, err := NewWorker(client, Config{JobsDir: jobsDir})
 	if w == nil {
 		t.Fatalf("Client is nil")
 	} else if err != nil {
@@ -73,7 +129,7 @@ func TestProcessJob(t *testing.T) {
 	}
 
 	job := core.NewJob(jobParams)
-	retry, err := wi.processJob(job, 1)
+	retry, err := wi.processJob(context.Background(), wi.slots[0], job, 1)
 
 	if retry {
 		t.Fatalf("Unexpected retry: %v", retry)
@@ -98,7 +154,7 @@ func TestFilterDisallowedJobs(t *testing.T) {
 		".*://github\\.com/SomeOrg/SomeProject.git$",
 	}
 
-	w, err := NewWorker(client, jobsDir, allowedGitRemotes)
+	w, err := NewWorker(client, Config{JobsDir: jobsDir, AllowedGitRemoteExpr: allowedGitRemotes})
 	if w == nil {
 		t.Fatalf("Client is nil")
 	} else if err != nil {
@@ -155,7 +211,7 @@ func TestFilterDisallowedJobs(t *testing.T) {
 				}
 
 				job := core.NewJob(jobParams)
-				retry, _ := wi.processJob(job, 1)
+				retry, _ := wi.processJob(context.Background(), wi.slots[0], job, 1)
 
 				if retry {
 					t.Fatalf("Unexpected retry: %v", retry)
@@ -164,7 +220,1219 @@ func TestFilterDisallowedJobs(t *testing.T) {
 				if job.Status != testCase.ExpectedStatus {
 					t.Fatalf("Expected status: %s, got %s", testCase.ExpectedStatus, job.Status)
 				}
+
+				if job.Status == core.Failed && job.FailureReason.Category != core.NotAllowedFailure {
+					t.Fatalf("Unexpected failure reason: %s", job.FailureReason)
+				}
 			},
 		)
 	}
 }
+
+func TestValidateParameters(t *testing.T) {
+
+	w, err := NewWorker(newMockClient(), Config{JobsDir: t.TempDir()})
+	if err != nil {
+		t.Fatalf("Client init failed: %v", err)
+	}
+
+	wi := w.(*workerImpl)
+	wi.testSkipRun = true
+
+	testCases := []struct {
+		name           string
+		params         core.JobParameters
+		expectedStatus core.JobStatus
+	}{
+		{"no options", core.JobParameters{}, core.Succeeded},
+		{"cpu list", core.JobParameters{TestCPUs: "1,2,4"}, core.Succeeded},
+		{"invalid cpu list", core.JobParameters{TestCPUs: "1,,4"}, core.Failed},
+		{"zero cpu", core.JobParameters{TestCPUs: "0"}, core.Failed},
+		{"build tags", core.JobParameters{BuildTags: "integration,go1.21"}, core.Succeeded},
+		{"invalid build tags", core.JobParameters{BuildTags: "foo; rm -rf /"}, core.Failed},
+		{"gcflags", core.JobParameters{GcFlags: "all=-N -l"}, core.Succeeded},
+		{"invalid gcflags", core.JobParameters{GcFlags: "-N\n-l"}, core.Failed},
+		{"ldflags", core.JobParameters{LdFlags: "-s -w -X 'main.version=1'"}, core.Succeeded},
+		{"goflags", core.JobParameters{GoFlags: "-mod=mod -trimpath"}, core.Succeeded},
+		{"invalid goflags", core.JobParameters{GoFlags: "-mod=mod\nrm"}, core.Failed},
+		{"env", core.JobParameters{Env: core.EnvVars{"GOGC=200", "GODEBUG=gctrace=1", "EMPTY="}}, core.Succeeded},
+		{"invalid env key", core.JobParameters{Env: core.EnvVars{"1GOGC=200"}}, core.Failed},
+		{"invalid env format", core.JobParameters{Env: core.EnvVars{"GOGC"}}, core.Failed},
+		{"invalid env value", core.JobParameters{Env: core.EnvVars{"GOGC=200\nrm"}}, core.Failed},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(
+			testCase.name,
+			func(t *testing.T) {
+				job := core.NewJob(testCase.params)
+				if _, err := wi.processJob(context.Background(), wi.slots[0], job, 1); err != nil {
+					t.Fatalf("Job processing error: %v", err)
+				}
+				if job.Status != testCase.expectedStatus {
+					t.Fatalf("Expected status: %s, got %s", testCase.expectedStatus, job.Status)
+				}
+			},
+		)
+	}
+}
+
+func TestShellQuote(t *testing.T) {
+	testCases := []string{
+		"",
+		"simple",
+		"with spaces",
+		"-X 'main.version=1'",
+		`"double" $HOME $(whoami) ` + "`id`",
+		"it's",
+	}
+
+	for _, s := range testCases {
+		out, err := exec.Command("bash", "-c", "printf '%s' "+shellQuote(s)).Output()
+		if err != nil {
+			t.Fatalf("Failed to run shell: %v", err)
+		}
+		if string(out) != s {
+			t.Fatalf("Expected: %s, actual: %s", s, string(out))
+		}
+	}
+}
+
+func TestFailureClassification(t *testing.T) {
+	dir := t.TempDir()
+
+	stagePath := filepath.Join(dir, kStageFilename)
+	if category := scriptStageFailureCategory(stagePath); category != core.SetupFailure {
+		t.Fatalf("Unexpected category without stage file: %s", category)
+	}
+
+	expectedCategories := map[string]core.FailureCategory{
+		"setup":     core.SetupFailure,
+		"checkout":  core.CheckoutFailure,
+		"build":     core.BuildFailure,
+		"benchmark": core.BenchmarkFailure,
+		"timeout":   core.TimeoutFailure,
+	}
+	for stage, expectedCategory := range expectedCategories {
+		if err := os.WriteFile(stagePath, []byte(stage+"\n"), 0600); err != nil {
+			t.Fatal(err)
+		}
+		if category := scriptStageFailureCategory(stagePath); category != expectedCategory {
+			t.Fatalf("Unexpected category for stage %s: %s", stage, category)
+		}
+	}
+
+	logPath := filepath.Join(dir, kLogFilename)
+	if err := os.WriteFile(logPath, []byte("Cloning...\n❌ Failed to checkout source\n\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if line := lastLogLine(logPath); line != "❌ Failed to checkout source" {
+		t.Fatalf("Unexpected last log line: %s", line)
+	}
+
+	err := newJobFailure(core.BuildFailure, "Non-zero exit code (%d)", 1)
+	if category := failureCategory(fmt.Errorf("wrapped: %w", err)); category != core.BuildFailure {
+		t.Fatalf("Unexpected category: %s", category)
+	}
+	if category := failureCategory(fmt.Errorf("other error")); category != core.WorkerFailure {
+		t.Fatalf("Unexpected category: %s", category)
+	}
+}
+
+func TestRetryJob(t *testing.T) {
+
+	client := newMockClient().(*mockClient)
+
+	var uploadedLogs []string
+	failUploads := true
+	client.StubUploadArtifact = func(jobId, name, _, _ string) (string, error) {
+		if strings.HasPrefix(name, "log.") {
+			uploadedLogs = append(uploadedLogs, name)
+			return fmt.Sprintf("jobs/%s/%s", jobId, name), nil
+		} else if failUploads && name == core.ResultsArtifact {
+			return "", fmt.Errorf("object store unavailable")
+		}
+		return name, nil
+	}
+	var requeueNotes []string
+	client.StubUpdateJobWithNote = func(_ *core.JobRecord, _ uint64, note string) (uint64, error) {
+		requeueNotes = append(requeueNotes, note)
+		return 0, nil
+	}
+
+	w, err := NewWorker(client, Config{JobsDir: t.TempDir()})
+	if err != nil {
+		t.Fatalf("Client init failed: %v", err)
+	}
+	wi := w.(*workerImpl)
+	wi.testSkipRun = true
+
+	job := core.NewJob(core.JobParameters{
+		Retry: core.RetryPolicy{MaxAttempts: 2},
+	})
+
+	// First attempt fails to upload artifacts, and is requeued
+	retry, err := wi.processJob(context.Background(), wi.slots[0], job, 1)
+	if err != nil {
+		t.Fatalf("Job processing error: %v", err)
+	} else if !retry {
+		t.Fatalf("Expected retry")
+	} else if job.Status != core.Submitted || job.Attempt != 2 || len(job.PreviousAttempts) != 1 {
+		t.Fatalf("Unexpected job after first attempt: %+v", job)
+	} else if job.PreviousAttempts[0].FailureReason.Category != core.ArtifactsFailure {
+		t.Fatalf("Unexpected failure reason: %s", job.PreviousAttempts[0].FailureReason)
+	} else if len(requeueNotes) != 1 {
+		t.Fatalf("Unexpected requeue notes: %v", requeueNotes)
+	}
+
+	// Second (and last) attempt fails the same way, but is not retried
+	retry, err = wi.processJob(context.Background(), wi.slots[0], job, 2)
+	if err != nil {
+		t.Fatalf("Job processing error: %v", err)
+	} else if retry {
+		t.Fatalf("Unexpected retry")
+	} else if job.Status != core.Failed || job.FailureReason.Category != core.ArtifactsFailure {
+		t.Fatalf("Unexpected job after last attempt: %+v", job)
+	}
+
+	// Each attempt uploads its own log
+	if !reflect.DeepEqual(uploadedLogs, []string{"log.txt", "log.attempt-2.txt"}) {
+		t.Fatalf("Unexpected log uploads: %v", uploadedLogs)
+	} else if log, _ := job.AttemptLog(1); log != fmt.Sprintf("jobs/%s/log.txt", job.Id) {
+		t.Fatalf("Unexpected first attempt log: %s", log)
+	}
+
+	// Failures caused by the code under test are not retried
+	failUploads = false
+	job = core.NewJob(core.JobParameters{
+		GitRemote: "https://example.com/repo.git",
+		GcFlags:   "\n",
+		Retry:     core.RetryPolicy{MaxAttempts: 3},
+	})
+	if retry, _ := wi.processJob(context.Background(), wi.slots[0], job, 1); retry || job.Status != core.Failed {
+		t.Fatalf("Unexpected retry of job with invalid parameters")
+	}
+}
+
+func TestHeartbeat(t *testing.T) {
+
+	client := newMockClient().(*mockClient)
+
+	updates := make(chan core.JobRecord, 100)
+	client.StubUpdateJobFromStatus = func(job *core.JobRecord, revision uint64, from core.JobStatus, _ string) (uint64, error) {
+		if from != core.Running {
+			t.Errorf("Unexpected previous status: %s", from)
+		}
+		updates <- *job
+		return revision + 1, nil
+	}
+
+	job := core.NewJob(core.JobParameters{})
+	job.SetRunningStatus()
+	job.Heartbeat = job.Heartbeat.Add(-1 * time.Hour)
+
+	hb := startHeartbeat(client, job, 10, 10*time.Millisecond)
+
+	// The job can be modified while the heartbeat runs
+	<-updates
+	job.SHA = "abc"
+	<-updates
+
+	lastHeartbeat, revision := hb.stop()
+
+	if revision < 12 {
+		t.Fatalf("Unexpected revision after 2+ updates: %d", revision)
+	} else if time.Since(lastHeartbeat) > time.Minute {
+		t.Fatalf("Unexpected heartbeat: %v", lastHeartbeat)
+	} else if !job.IsStale(time.Minute) {
+		t.Fatalf("Original record should not be updated by heartbeat")
+	}
+
+	// Heartbeats continue after transient errors, and stop on conflicts
+	failures := make(chan error, 2)
+	failures <- fmt.Errorf("nats: timeout")
+	failures <- fmt.Errorf("%w: wrong last sequence", core.ErrRevisionConflict)
+	attempts := make(chan struct{}, 100)
+	client.StubUpdateJobFromStatus = func(job *core.JobRecord, revision uint64, from core.JobStatus, _ string) (uint64, error) {
+		attempts <- struct{}{}
+		select {
+		case err := <-failures:
+			return 0, err
+		default:
+			return revision + 1, nil
+		}
+	}
+	hb = startHeartbeat(client, job, 10, 10*time.Millisecond)
+	<-attempts
+	<-attempts
+	<-hb.doneCh
+	if len(attempts) != 0 {
+		t.Fatalf("Unexpected heartbeat after conflict")
+	}
+}
+
+func TestHeartbeatDuringRetryUpload(t *testing.T) {
+
+	client := newMockClient().(*mockClient)
+	// Heartbeats serialize their copy of the record, while the job artifacts are recorded
+	client.StubUpdateJobFromStatus = func(job *core.JobRecord, revision uint64, from core.JobStatus, _ string) (uint64, error) {
+		_ = job.Bytes()
+		return revision + 1, nil
+	}
+	client.StubUploadArtifact = func(jobId, name, path, contentType string) (string, error) {
+		time.Sleep(10 * time.Millisecond)
+		return fmt.Sprintf("jobs/%s/%s", jobId, name), nil
+	}
+
+	w, err := NewWorker(client, Config{JobsDir: t.TempDir()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	wi := w.(*workerImpl)
+	wi.heartbeatInterval = time.Millisecond
+	wi.testSkipRun = true
+
+	// Second attempt of a job, whose record already has artifacts
+	job := core.NewJob(core.JobParameters{Retry: core.RetryPolicy{MaxAttempts: 2}})
+	job.SetRunningStatus()
+	job.AddArtifact(core.LogArtifact, fmt.Sprintf("jobs/%s/%s", job.Id, core.LogArtifact))
+	job.SetFailedStatus(core.WorkerFailure, "lost")
+	job.Requeue()
+
+	if _, err := wi.processJob(context.Background(), wi.slots[0], job, 1); err != nil {
+		t.Fatal(err)
+	} else if job.Artifacts[core.AttemptLogArtifact(2)] == "" {
+		t.Fatalf("Unexpected artifacts: %v", job.Artifacts)
+	}
+}
+
+// Start a script in its own process group, with a child process that would outlive it.
+// Returns the script command and the child PID.
+func startProcessGroup(t *testing.T, script string) (*exec.Cmd, int) {
+	t.Helper()
+	childPidPath := filepath.Join(t.TempDir(), "child.pid")
+
+	cmd := exec.Command("bash", "-c", fmt.Sprintf("%s; sleep 60 & echo $! > %s; wait", script, childPidPath))
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	if err := cmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+
+	var childPid int
+	for i := 0; i < 100 && childPid == 0; i++ {
+		time.Sleep(10 * time.Millisecond)
+		if data, err := os.ReadFile(childPidPath); err == nil {
+			_, _ = fmt.Sscanf(string(data), "%d", &childPid)
+		}
+	}
+	if childPid == 0 {
+		t.Fatalf("Child process did not start")
+	}
+	return cmd, childPid
+}
+
+// Check the process is gone (or a zombie, if nobody reaps orphans in this environment)
+func assertProcessGone(t *testing.T, pid int) {
+	t.Helper()
+	for i := 0; i < 100; i++ {
+		stat, err := os.ReadFile(fmt.Sprintf("/proc/%d/stat", pid))
+		if err != nil || strings.Contains(string(stat), ") Z ") {
+			return
+		} else if i == 99 {
+			t.Fatalf("Process %d survived: %s", pid, stat)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestCancelProcessGroup(t *testing.T) {
+	cmd, childPid := startProcessGroup(t, "true")
+
+	group := newProcessGroup(cmd.Process.Pid)
+	group.stop(&jobCancellation{requester: "tester"}, 0)
+
+	var cancellation *jobCancellation
+	if _, err := cmd.Process.Wait(); err != nil {
+		t.Fatal(err)
+	} else if stopReason := group.exited(); !errors.As(stopReason, &cancellation) || cancellation.requester != "tester" {
+		t.Fatalf("Unexpected stop reason: %v", stopReason)
+	}
+
+	assertProcessGone(t, childPid)
+
+	// Stopping after exit does nothing
+	group.stop(&jobCancellation{requester: "late"}, 0)
+	if stopReason := group.exited(); !errors.As(stopReason, &cancellation) || cancellation.requester != "tester" {
+		t.Fatalf("Unexpected stop reason: %v", stopReason)
+	}
+}
+
+func TestStopProcessGroupAfterGracePeriod(t *testing.T) {
+	// Script ignores SIGTERM, so it is only stopped by SIGKILL after the grace period
+	cmd, childPid := startProcessGroup(t, "trap '' TERM")
+
+	gracePeriod := 200 * time.Millisecond
+	group := newProcessGroup(cmd.Process.Pid)
+	start := time.Now()
+	go group.stop(&jobTimeout{deadline: time.Second}, gracePeriod)
+
+	var timeout *jobTimeout
+	if _, err := cmd.Process.Wait(); err != nil {
+		t.Fatal(err)
+	} else if elapsed := time.Since(start); elapsed < gracePeriod {
+		t.Fatalf("Script killed before grace period: %v", elapsed)
+	} else if stopReason := group.exited(); !errors.As(stopReason, &timeout) {
+		t.Fatalf("Unexpected stop reason: %v", stopReason)
+	}
+
+	assertProcessGone(t, childPid)
+}
+
+func TestDrain(t *testing.T) {
+
+	client := newMockClient().(*mockClient)
+	client.StubDispatchJobs = func(ctx context.Context, handleJob func(*core.JobRecord, uint64) (bool, error)) error {
+		// Request drain (as if remotely), then wait for dispatching to stop
+		client.drainCallback("tester")
+		<-ctx.Done()
+		return ctx.Err()
+	}
+
+	w, err := NewWorker(client, Config{JobsDir: t.TempDir()})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := w.Run(context.Background()); err != nil {
+		t.Fatalf("Unexpected error after drain: %v", err)
+	}
+
+	lastRegistration := client.registrations[len(client.registrations)-1]
+	if !lastRegistration.Draining {
+		t.Fatalf("Worker registration should be flagged as draining")
+	}
+
+	// Draining again does nothing
+	w.Drain("again")
+}
+
+func TestRunWithoutWorkersRegistry(t *testing.T) {
+
+	client := newMockClient().(*mockClient)
+	client.noWorkersRegistry = true
+	client.StubDispatchJobs = func(ctx context.Context, handleJob func(*core.JobRecord, uint64) (bool, error)) error {
+		return nil
+	}
+
+	w, err := NewWorker(client, Config{JobsDir: t.TempDir()})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := w.Run(context.Background()); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	} else if len(client.registrations) != 0 {
+		t.Fatalf("Unexpected registrations: %+v", client.registrations)
+	}
+}
+
+func TestInterruptJob(t *testing.T) {
+
+	var client = newMockClient()
+
+	w, err := NewWorker(client, Config{JobsDir: t.TempDir()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	wi := w.(*workerImpl)
+
+	job := core.NewJob(core.JobParameters{
+		GitRemote:       "https://github.com/synadia-labs/go-bench-away.git",
+		GitRef:          "main",
+		TestsFilterExpr: ".*",
+		Reps:            1,
+		TestMinRuntime:  1 * time.Second,
+		Timeout:         5 * time.Minute,
+		Username:        "test",
+	})
+
+	// Worker is already shutting down, the job is interrupted right after it starts
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	requeue, err := wi.processJob(ctx, wi.slots[0], job, 1)
+	if err != nil {
+		t.Fatal(err)
+	} else if !requeue {
+		t.Fatalf("Interrupted job should be requeued")
+	} else if job.Status != core.Submitted {
+		t.Fatalf("Unexpected status: %v", job.Status)
+	} else if job.CurrentAttempt() != 1 || len(job.PreviousAttempts) != 0 || job.FailureReason != nil {
+		t.Fatalf("Interruption should not count as a failed attempt: %d (%v)", job.CurrentAttempt(), job.FailureReason)
+	}
+}
+
+func TestFormatCPUList(t *testing.T) {
+	testCases := []struct {
+		cpus     []int
+		expected string
+	}{
+		{[]int{}, ""},
+		{[]int{3}, "3"},
+		{[]int{0, 1, 2, 3}, "0-3"},
+		{[]int{0, 1, 2, 3, 8, 10, 11}, "0-3,8,10-11"},
+		{[]int{1, 3, 5}, "1,3,5"},
+	}
+	for _, tc := range testCases {
+		if cpuList := formatCPUList(tc.cpus); cpuList != tc.expected {
+			t.Fatalf("Unexpected list for %v: %s (expected: %s)", tc.cpus, cpuList, tc.expected)
+		}
+	}
+}
+
+func TestSlotsPinning(t *testing.T) {
+	cpus, err := availableCPUs()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := NewWorker(newMockClient(), Config{Slots: len(cpus) + 1, CPUsPerSlot: 1}); err == nil {
+		t.Fatalf("Expected error with more slots than CPUs")
+	}
+
+	slots, err := newSlots(core.WorkerInfo{Hostname: "test"}, min(len(cpus), 2), 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i, s := range slots {
+		if s.workerInfo.Hostname != "test" || s.workerInfo.CPUSet != strconv.Itoa(cpus[i]) {
+			t.Fatalf("Unexpected slot %d worker info: %+v", i, s.workerInfo)
+		}
+
+		// Affinity is inherited by the script children
+		out := &strings.Builder{}
+		cmd := exec.Command("bash", "-c", "grep Cpus_allowed_list /proc/self/status")
+		cmd.Stdout = out
+		if err := startPinned(cmd, s.cpus); err != nil {
+			t.Fatal(err)
+		} else if err := cmd.Wait(); err != nil {
+			t.Fatal(err)
+		} else if allowed := strings.TrimSpace(strings.TrimPrefix(out.String(), "Cpus_allowed_list:")); allowed != s.workerInfo.CPUSet {
+			t.Fatalf("Unexpected slot %d affinity: %s (expected: %s)", i, allowed, s.workerInfo.CPUSet)
+		}
+	}
+
+	// This process is not affected
+	if cpusAfter, err := availableCPUs(); err != nil {
+		t.Fatal(err)
+	} else if len(cpusAfter) != len(cpus) {
+		t.Fatalf("Unexpected affinity after starting pinned commands: %v", cpusAfter)
+	}
+}
+
+func TestCollectEnvironment(t *testing.T) {
+	root := t.TempDir()
+	files := map[string]string{
+		"proc/sys/kernel/osrelease": "6.1.0-test\n",
+		"proc/cpuinfo": "processor\t: 0\nmodel name\t: Test CPU @ 3.00GHz\n\n" +
+			"processor\t: 1\nmodel name\t: Test CPU @ 3.00GHz\n",
+		"proc/meminfo":                  "MemTotal:       16384000 kB\nMemFree:         1024000 kB\n",
+		"proc/loadavg":                  "1.25 0.40 0.35 3/72 11211\n",
+		"sys/devices/system/cpu/online": "0-3\n",
+		"sys/devices/system/cpu/cpu0/cpufreq/scaling_governor":             "powersave\n",
+		"sys/devices/system/cpu/cpu1/cpufreq/scaling_governor":             "performance\n",
+		"sys/devices/system/cpu/cpu1/thermal_throttle/core_throttle_count": "7\n",
+		"sys/devices/system/cpu/intel_pstate/no_turbo":                     "0\n",
+		"sys/devices/system/cpu/smt/control":                               "on\n",
+	}
+	for path, content := range files {
+		path = filepath.Join(root, path)
+		if err := os.MkdirAll(filepath.Dir(path), 0750); err != nil {
+			t.Fatal(err)
+		} else if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	defaultHostRoot := hostRoot
+	hostRoot = root
+	defer func() { hostRoot = defaultHostRoot }()
+
+	expected := core.HostEnvironment{
+		CPUModel:         "Test CPU @ 3.00GHz",
+		CPUCores:         4,
+		MemoryTotal:      16384000 * 1024,
+		Kernel:           "6.1.0-test",
+		Governor:         "performance",
+		TurboBoost:       "enabled",
+		SMT:              "on",
+		LoadAverage:      1.25,
+		RunningProcesses: 3,
+		ThrottleCount:    7,
+	}
+
+	// Pinned to CPU 1
+	env := collectEnvironment([]int{1})
+	if !reflect.DeepEqual(*env, expected) {
+		t.Fatalf("Unexpected environment: %+v", env)
+	}
+
+	// All CPUs
+	env = collectEnvironment(nil)
+	if env.Governor != "performance,powersave" {
+		t.Fatalf("Unexpected governor: %s", env.Governor)
+	}
+
+	policy := EnvironmentPolicy{
+		MaxLoadAverage: 0.5,
+		Governor:       "performance",
+		NoTurboBoost:   true,
+		NoSMT:          true,
+	}
+	if violations := policy.check(env); len(violations) != 4 {
+		t.Fatalf("Unexpected violations: %v", violations)
+	} else if violations := (EnvironmentPolicy{}).check(env); len(violations) != 0 {
+		t.Fatalf("Unexpected violations with empty policy: %v", violations)
+	}
+
+	// Enforced policy fails the job
+	client := newMockClient()
+	policy.Enforce = true
+	w, err := NewWorker(client, Config{JobsDir: t.TempDir(), EnvironmentPolicy: policy})
+	if err != nil {
+		t.Fatal(err)
+	}
+	wi := w.(*workerImpl)
+	wi.testSkipRun = true
+
+	job := core.NewJob(core.JobParameters{
+		GitRemote:       "https://github.com/synadia-labs/go-bench-away.git",
+		GitRef:          "main",
+		TestsFilterExpr: ".*",
+		Reps:            1,
+		TestMinRuntime:  1 * time.Second,
+		Timeout:         5 * time.Minute,
+		Username:        "test",
+	})
+	if _, err := wi.processJob(context.Background(), wi.slots[0], job, 1); err != nil {
+		t.Fatal(err)
+	} else if job.Status != core.Failed || job.FailureReason.Category != core.EnvironmentFailure {
+		t.Fatalf("Unexpected job status: %v (%v)", job.Status, job.FailureReason)
+	} else if len(job.WorkerInfo.Environment.Warnings) != 4 {
+		t.Fatalf("Unexpected warnings: %v", job.WorkerInfo.Environment.Warnings)
+	}
+}
+
+func TestCustomScriptTemplate(t *testing.T) {
+	templatesDir := t.TempDir()
+	writeTemplate := func(name, text string) string {
+		path := filepath.Join(templatesDir, name)
+		if err := os.WriteFile(path, []byte(text), 0600); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+
+	invalidTemplates := map[string]string{
+		"missing.tmpl":       "",
+		"syntax.tmpl":        "#!/usr/bin/env bash\necho {{.GitRef\n",
+		"unknown-value.tmpl": "#!/usr/bin/env bash\necho {{.NoSuchValue}}\n",
+	}
+	for name, text := range invalidTemplates {
+		path := filepath.Join(templatesDir, name)
+		if text != "" {
+			path = writeTemplate(name, text)
+		}
+		if _, err := NewWorker(newMockClient(), Config{ScriptTemplatePath: path}); err == nil {
+			t.Fatalf("Expected error with template %s", name)
+		}
+	}
+
+	templatePath := writeTemplate("custom.tmpl", `#!/usr/bin/env bash
+set -e
+echo "benchmark" > "{{.StagePath}}"
+echo "custom" > "{{.ShaPath}}"
+echo "BenchmarkCustom-8 1 100 ns/op {{.GitRef}}" > "{{.ResultsPath}}"
+`)
+
+	var results string
+	client := newMockClient().(*mockClient)
+	client.StubUploadArtifact = func(jobId, name, path, _ string) (string, error) {
+		if name != core.ResultsArtifact {
+			return name, nil
+		}
+		data, err := os.ReadFile(path)
+		results = string(data)
+		return "results", err
+	}
+
+	w, err := NewWorker(client, Config{JobsDir: t.TempDir(), ScriptTemplatePath: templatePath})
+	if err != nil {
+		t.Fatal(err)
+	}
+	wi := w.(*workerImpl)
+
+	defaultWorker, err := NewWorker(newMockClient(), Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defaultHash := defaultWorker.(*workerImpl).workerInfo.ScriptTemplate
+
+	job := core.NewJob(core.JobParameters{
+		GitRemote:       "https://github.com/synadia-labs/go-bench-away.git",
+		GitRef:          "main",
+		TestsFilterExpr: ".*",
+		Reps:            1,
+		TestMinRuntime:  1 * time.Second,
+		Timeout:         5 * time.Minute,
+		Username:        "test",
+	})
+	if _, err := wi.processJob(context.Background(), wi.slots[0], job, 1); err != nil {
+		t.Fatal(err)
+	} else if job.Status != core.Succeeded {
+		t.Fatalf("Unexpected status: %v (%v)", job.Status, job.FailureReason)
+	} else if job.SHA != "custom" || !strings.Contains(results, "BenchmarkCustom-8 1 100 ns/op main") {
+		t.Fatalf("Custom script not used, SHA: %s, results: %s", job.SHA, results)
+	} else if !strings.HasPrefix(job.WorkerInfo.ScriptTemplate, "sha256:") || job.WorkerInfo.ScriptTemplate == defaultHash {
+		t.Fatalf("Unexpected script template hash: %s (default: %s)", job.WorkerInfo.ScriptTemplate, defaultHash)
+	}
+}
+
+func TestLiveLog(t *testing.T) {
+	templatePath := filepath.Join(t.TempDir(), "live.tmpl")
+	err := os.WriteFile(templatePath, []byte(`#!/usr/bin/env bash
+set -e
+echo "Live output of {{.GitRef}}"
+echo "benchmark" > "{{.StagePath}}"
+echo "BenchmarkLive-8 1 100 ns/op" > "{{.ResultsPath}}"
+`), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	client := newMockClient().(*mockClient)
+	w, err := NewWorker(client, Config{JobsDir: t.TempDir(), ScriptTemplatePath: templatePath})
+	if err != nil {
+		t.Fatal(err)
+	}
+	wi := w.(*workerImpl)
+
+	job := core.NewJob(core.JobParameters{
+		GitRef:  "main",
+		Timeout: time.Minute,
+	})
+	job.Attempt = 2
+	if _, err := wi.processJob(context.Background(), wi.slots[0], job, 1); err != nil {
+		t.Fatal(err)
+	} else if job.Status != core.Succeeded {
+		t.Fatalf("Unexpected status: %v (%v)", job.Status, job.FailureReason)
+	}
+
+	if len(client.liveLogs) != 1 {
+		t.Fatalf("Expected 1 live log, got: %d", len(client.liveLogs))
+	}
+	liveLog := client.liveLogs[0]
+	if liveLog.jobId != job.Id || liveLog.attempt != 2 {
+		t.Fatalf("Unexpected live log job: %s (attempt %d)", liveLog.jobId, liveLog.attempt)
+	} else if !liveLog.closed {
+		t.Fatalf("Live log not closed")
+	} else if !strings.Contains(liveLog.String(), "Live output of main") {
+		t.Fatalf("Unexpected live log: %s", liveLog.String())
+	}
+}
+
+func TestGitCache(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not available")
+	}
+
+	git := func(dir string, args ...string) string {
+		t.Helper()
+		cmd := exec.Command("git", append([]string{"-C", dir, "-c", "user.name=test", "-c", "user.email=test@test"}, args...)...)
+		out, err := cmd.CombinedOutput()
+		if err != nil {
+			t.Fatalf("git %v: %v: %s", args, err, out)
+		}
+		return strings.TrimSpace(string(out))
+	}
+	newRemote := func(name string) string {
+		t.Helper()
+		remote := filepath.Join(t.TempDir(), name)
+		git(filepath.Dir(remote), "init", "--quiet", remote)
+		git(remote, "commit", "--quiet", "--allow-empty", "-m", "first")
+		return remote
+	}
+
+	cache, err := newGitCache(t.TempDir(), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	remote := newRemote("remote-1")
+
+	// Concurrent slots using the same remote
+	mirrorPaths := make(chan string, 2)
+	releases := make(chan func(), 2)
+	for i := 0; i < 2; i++ {
+		go func() {
+			mirrorPath, release := cache.acquire(context.Background(), remote)
+			mirrorPaths <- mirrorPath
+			releases <- release
+		}()
+	}
+	mirrorPath := <-mirrorPaths
+	if mirrorPath == "" || mirrorPath != <-mirrorPaths {
+		t.Fatalf("Unexpected mirror path: %s", mirrorPath)
+	}
+	(<-releases)()
+	(<-releases)()
+
+	// Mirror is updated incrementally
+	git(remote, "commit", "--quiet", "--allow-empty", "-m", "second")
+	if mirrorPath, release := cache.acquire(context.Background(), remote); mirrorPath == "" {
+		t.Fatalf("Mirror not available")
+	} else if git(mirrorPath, "rev-parse", "HEAD") != git(remote, "rev-parse", "HEAD") {
+		t.Fatalf("Mirror not updated")
+	} else {
+		release()
+	}
+
+	// Mirrors are garbage-collected from time to time, unless in use
+	_, inUseRelease := cache.acquire(context.Background(), remote)
+	longAgo := time.Now().Add(-2 * kMirrorMaintenanceInterval)
+	if err := os.Chtimes(mirrorPath+kMirrorMaintainedSuffix, longAgo, longAgo); err != nil {
+		t.Fatal(err)
+	}
+	if _, release := cache.acquire(context.Background(), remote); !cache.maintenanceDue(mirrorPath) {
+		t.Fatalf("Mirror in use garbage-collected")
+	} else {
+		release()
+	}
+	inUseRelease()
+	if mirrorPath, release := cache.acquire(context.Background(), remote); mirrorPath == "" {
+		t.Fatalf("Mirror not available")
+	} else if cache.maintenanceDue(mirrorPath) {
+		t.Fatalf("Mirror not garbage-collected")
+	} else {
+		release()
+	}
+
+	// Creating the mirror is stopped with the job (e.g. past its deadline)
+	cancelledCtx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if mirrorPath, release := cache.acquire(cancelledCtx, newRemote("remote-cancelled")); mirrorPath != "" {
+		t.Fatalf("Unexpected mirror created with cancelled context: %s", mirrorPath)
+	} else {
+		release()
+	}
+
+	// Unreachable remote, no mirror
+	if mirrorPath, release := cache.acquire(context.Background(), filepath.Join(t.TempDir(), "nope")); mirrorPath != "" {
+		t.Fatalf("Unexpected mirror of missing remote: %s", mirrorPath)
+	} else {
+		release()
+	}
+
+	// Least recently used mirror is evicted, unless in use
+	cache.maxSize = 1
+	remote2 := newRemote("remote-2")
+	mirrorPath2, release2 := cache.acquire(context.Background(), remote2)
+	if mirrorPath2 == "" {
+		t.Fatalf("Mirror not available")
+	} else if isMirror(mirrorPath) {
+		t.Fatalf("Least recently used mirror not evicted")
+	}
+	if mirrorPath, release := cache.acquire(context.Background(), remote); mirrorPath == "" {
+		t.Fatalf("Mirror not available")
+	} else if !isMirror(mirrorPath2) {
+		t.Fatalf("Mirror in use evicted")
+	} else {
+		release()
+	}
+	release2()
+}
+
+func TestReadGoCacheInfo(t *testing.T) {
+	infoPath := filepath.Join(t.TempDir(), kGoCacheInfoFilename)
+
+	if info := readGoCacheInfo(infoPath); info != nil {
+		t.Fatalf("Unexpected info without file: %+v", info)
+	}
+
+	content := "GOMODCACHE=/cache/mod\nGOMODCACHE_KB=2048\nGOCACHE=/cache/build\nGOCACHE_KB=\n" +
+		"CLEAN_BUILD_CACHE=true\nPACKAGES_CACHED=3\nPACKAGES_TOTAL=4\n"
+	if err := os.WriteFile(infoPath, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := core.GoCacheInfo{
+		ModCacheDir:     "/cache/mod",
+		ModCacheSize:    2048 * 1024,
+		BuildCacheDir:   "/cache/build",
+		CleanBuildCache: true,
+		PackagesCached:  3,
+		PackagesTotal:   4,
+	}
+	if info := readGoCacheInfo(infoPath); info == nil || *info != expected {
+		t.Fatalf("Expected: %+v, got: %+v", expected, info)
+	}
+	if hitRate := expected.HitRate(); hitRate != "3/4 packages (75%)" {
+		t.Fatalf("Unexpected hit rate: %s", hitRate)
+	}
+}
+
+func TestCgroupLimits(t *testing.T) {
+	root := t.TempDir()
+	for file, content := range map[string]string{"cgroup.controllers": "cpu memory pids", "cgroup.subtree_control": ""} {
+		if err := os.WriteFile(filepath.Join(root, file), []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	limits := ResourceLimits{MemoryMax: 64 << 20, CPUMax: 1.5, PidsMax: 100, DiskMax: 1 << 30, CgroupRoot: root}
+	if s := limits.String(); s != "memory: 64 MiB, cpu: 1.5, pids: 100, disk: 1024 MiB" {
+		t.Fatalf("Unexpected limits description: %s", s)
+	}
+
+	if _, err := newCgroupManager(ResourceLimits{CgroupRoot: t.TempDir()}); err == nil {
+		t.Fatalf("Expected error without cgroup v2")
+	}
+
+	cgroups, err := newCgroupManager(limits)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cg, err := cgroups.create("job-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cg.dir.Close()
+
+	expectedFiles := map[string]string{
+		"memory.max":       "67108864",
+		"memory.oom.group": "1",
+		"memory.swap.max":  "0",
+		"cpu.max":          "150000 100000",
+		"pids.max":         "100",
+	}
+	for file, expected := range expectedFiles {
+		if value := readCgroupFile(cg.path, file); value != expected {
+			t.Fatalf("Expected %s: %s, got: %s", file, expected, value)
+		}
+	}
+
+	if err := cg.limitExceeded(limits); err != nil {
+		t.Fatalf("Unexpected limit error: %v", err)
+	}
+
+	writeCgroupFile(cg.path, "memory.peak", "1048576\n")
+	writeCgroupFile(cg.path, "cpu.stat", "usage_usec 2500000\nuser_usec 2000000\nsystem_usec 500000\n")
+	if peakMemory, cpuTime := cg.stats(); peakMemory != 1<<20 || cpuTime != 2500*time.Millisecond {
+		t.Fatalf("Unexpected stats: %d, %v", peakMemory, cpuTime)
+	}
+
+	writeCgroupFile(cg.path, "pids.events", "max 3\n")
+	if err := cg.limitExceeded(limits); failureCategory(err) != core.ResourceLimitFailure {
+		t.Fatalf("Unexpected limit error: %v", err)
+	}
+	writeCgroupFile(cg.path, "memory.events", "low 0\nhigh 0\nmax 5\noom 1\noom_kill 1\noom_group_kill 1\n")
+	if err := cg.limitExceeded(limits); err == nil || !strings.HasPrefix(err.Error(), "Memory limit exceeded (64 MiB)") {
+		t.Fatalf("Unexpected limit error: %v", err)
+	}
+}
+
+func TestDiskUsageLimit(t *testing.T) {
+	templatePath := filepath.Join(t.TempDir(), "disk.tmpl")
+	err := os.WriteFile(templatePath, []byte(`#!/usr/bin/env bash
+echo "benchmark" > "{{.StagePath}}"
+head -c 2097152 /dev/zero > "{{.JobDirPath}}/big"
+sleep 30
+`), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	w, err := NewWorker(newMockClient(), Config{
+		JobsDir:            t.TempDir(),
+		ScriptTemplatePath: templatePath,
+		ResourceLimits:     ResourceLimits{DiskMax: 1 << 20},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	wi := w.(*workerImpl)
+	wi.diskCheckInterval = 10 * time.Millisecond
+
+	job := core.NewJob(core.JobParameters{Timeout: time.Minute})
+	start := time.Now()
+	if _, err := wi.processJob(context.Background(), wi.slots[0], job, 1); err != nil {
+		t.Fatal(err)
+	}
+	if job.Status != core.Failed || job.FailureReason.Category != core.ResourceLimitFailure {
+		t.Fatalf("Unexpected status: %v (%v)", job.Status, job.FailureReason)
+	} else if time.Since(start) > 20*time.Second {
+		t.Fatalf("Job not stopped when exceeding the limit")
+	} else if job.RunStats == nil || job.RunStats.DiskUsage < 2<<20 || job.RunStats.PeakMemory == 0 {
+		t.Fatalf("Unexpected run stats: %+v", job.RunStats)
+	} else if job.WorkerInfo.ResourceLimits != "disk: 1 MiB" {
+		t.Fatalf("Unexpected resource limits: %s", job.WorkerInfo.ResourceLimits)
+	}
+}
+
+func TestProfileArtifacts(t *testing.T) {
+	templatePath := filepath.Join(t.TempDir(), "profiles.tmpl")
+	err := os.WriteFile(templatePath, []byte(`#!/usr/bin/env bash
+set -e
+echo "benchmark" > "{{.StagePath}}"
+mkdir -p "{{.ProfilesPath}}"
+{{- range .Profiles}}
+echo "{{.}}" > "{{$.ProfilesPath}}/{{if eq . "trace"}}trace.out{{else}}{{.}}.pprof{{end}}"
+{{- end}}
+rm -f "{{.ProfilesPath}}/mutex.pprof"
+`), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	uploaded := map[string]string{}
+	client := newMockClient().(*mockClient)
+	client.StubUploadArtifact = func(jobId, name, path, contentType string) (string, error) {
+		if contentType != core.BinaryContentType {
+			return name, nil
+		}
+		data, err := os.ReadFile(path)
+		uploaded[name] = strings.TrimSpace(string(data))
+		return fmt.Sprintf("jobs/%s/%s", jobId, name), err
+	}
+
+	w, err := NewWorker(client, Config{JobsDir: t.TempDir(), ScriptTemplatePath: templatePath})
+	if err != nil {
+		t.Fatal(err)
+	}
+	wi := w.(*workerImpl)
+
+	job := core.NewJob(core.JobParameters{
+		Timeout:  time.Minute,
+		Profiles: core.ProfileKinds{core.CPUProfile, core.MutexProfile, core.Trace},
+	})
+	if _, err := wi.processJob(context.Background(), wi.slots[0], job, 1); err != nil {
+		t.Fatal(err)
+	} else if job.Status != core.Succeeded {
+		t.Fatalf("Unexpected status: %v (%v)", job.Status, job.FailureReason)
+	}
+
+	// Missing profiles are skipped
+	expectedUploads := map[string]string{"cpu.pprof": "cpu", "trace.out": "trace"}
+	if !reflect.DeepEqual(uploaded, expectedUploads) {
+		t.Fatalf("Expected uploads: %v, got: %v", expectedUploads, uploaded)
+	}
+	if names := job.ArtifactNames(); !reflect.DeepEqual(names, []string{"cpu.pprof", "trace.out"}) {
+		t.Fatalf("Unexpected artifacts: %v", names)
+	} else if job.Artifacts["cpu.pprof"] != fmt.Sprintf("jobs/%s/cpu.pprof", job.Id) {
+		t.Fatalf("Unexpected artifact key: %s", job.Artifacts["cpu.pprof"])
+	}
+
+	invalidJob := core.NewJob(core.JobParameters{Profiles: core.ProfileKinds{"goroutine"}})
+	if _, err := wi.processJob(context.Background(), wi.slots[0], invalidJob, 1); err != nil {
+		t.Fatal(err)
+	} else if invalidJob.Status != core.Failed || invalidJob.FailureReason.Category != core.InvalidParametersFailure {
+		t.Fatalf("Unexpected status: %v (%v)", invalidJob.Status, invalidJob.FailureReason)
+	}
+}
+
+// Create a git repository with a Go module containing the given benchmarks source, for jobs using the default script
+func newBenchmarksRemote(t *testing.T, benchmarks string) string {
+	t.Helper()
+	for _, tool := range []string{"git", "go"} {
+		if _, err := exec.LookPath(tool); err != nil {
+			t.Skipf("%s not available", tool)
+		}
+	}
+
+	remote := t.TempDir()
+	files := map[string]string{
+		"go.mod":        "module example.com/bench\n\ngo 1.21\n",
+		"bench_test.go": benchmarks,
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(remote, name), []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, args := range [][]string{
+		{"init", "--quiet", "--initial-branch=main"},
+		{"add", "."},
+		{"commit", "--quiet", "-m", "benchmarks"},
+	} {
+		cmd := exec.Command("git", append([]string{"-C", remote, "-c", "user.name=test", "-c", "user.email=test@test"}, args...)...)
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("git %v: %v: %s", args, err, out)
+		}
+	}
+	return remote
+}
+
+func TestBenchmarksTimeout(t *testing.T) {
+	remote := newBenchmarksRemote(t, `package bench
+
+import (
+	"testing"
+	"time"
+)
+
+// Selected by the benchmarks filter, runs past the job timeout
+func TestSlow(t *testing.T) {
+	time.Sleep(time.Minute)
+}
+
+func BenchmarkFast(b *testing.B) {
+	for i := 0; i < b.N; i++ {
+	}
+}
+`)
+
+	w, err := NewWorker(newMockClient(), Config{JobsDir: t.TempDir()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	wi := w.(*workerImpl)
+
+	job := core.NewJob(core.JobParameters{
+		GitRemote:       remote,
+		GitRef:          "main",
+		TestsSubDir:     ".",
+		TestsFilterExpr: ".*",
+		Reps:            1,
+		TestMinRuntime:  time.Second,
+		Timeout:         2 * time.Second,
+		Username:        "test",
+	})
+	if _, err := wi.processJob(context.Background(), wi.slots[0], job, 1); err != nil {
+		t.Fatal(err)
+	}
+	if job.Status != core.TimedOut || job.FailureReason.Category != core.TimeoutFailure {
+		t.Fatalf("Unexpected status: %v (%v)", job.Status, job.FailureReason)
+	} else if !strings.Contains(job.FailureReason.Message, "Benchmarks timed out after 2s") {
+		t.Fatalf("Unexpected failure reason: %v", job.FailureReason)
+	}
+}
+
+func TestProfilingPastDeadline(t *testing.T) {
+	templatePath := filepath.Join(t.TempDir(), "slow-profiles.tmpl")
+	err := os.WriteFile(templatePath, []byte(`#!/usr/bin/env bash
+set -e
+echo "benchmark" > "{{.StagePath}}"
+echo "BenchmarkFoo-8 1 100 ns/op" > "{{.ResultsPath}}"
+echo "profile" > "{{.StagePath}}"
+mkdir -p "{{.ProfilesPath}}"
+echo "partial" > "{{.ProfilesPath}}/cpu.pprof"
+sleep 30
+`), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var uploaded []string
+	client := newMockClient().(*mockClient)
+	client.StubUploadArtifact = func(jobId, name, path, contentType string) (string, error) {
+		uploaded = append(uploaded, name)
+		return name, nil
+	}
+
+	w, err := NewWorker(client, Config{JobsDir: t.TempDir(), ScriptTemplatePath: templatePath})
+	if err != nil {
+		t.Fatal(err)
+	}
+	wi := w.(*workerImpl)
+
+	// No timeout, no deadline
+	if deadline := wi.jobDeadline(&core.JobParameters{}); deadline != 0 {
+		t.Fatalf("Unexpected deadline without timeout: %v", deadline)
+	}
+
+	// Profiling runs the benchmarks again, with a timeout of its own
+	params := core.JobParameters{Timeout: time.Hour}
+	if deadline := wi.jobDeadline(&params); deadline != time.Hour+kTimeoutGracePeriod {
+		t.Fatalf("Unexpected deadline: %v", deadline)
+	}
+	params.Profiles = core.ProfileKinds{core.CPUProfile}
+	if deadline := wi.jobDeadline(&params); deadline != 2*time.Hour+kTimeoutGracePeriod {
+		t.Fatalf("Unexpected deadline with profiling: %v", deadline)
+	}
+
+	// Stopped past the deadline while profiling, the results measured are kept
+	wi.timeoutGracePeriod = 100 * time.Millisecond
+	job := core.NewJob(core.JobParameters{
+		Timeout:  100 * time.Millisecond,
+		Profiles: core.ProfileKinds{core.CPUProfile},
+	})
+	if _, err := wi.processJob(context.Background(), wi.slots[0], job, 1); err != nil {
+		t.Fatal(err)
+	} else if job.Status != core.Succeeded {
+		t.Fatalf("Unexpected status: %v (%v)", job.Status, job.FailureReason)
+	} else if !reflect.DeepEqual(uploaded, []string{"log.txt", core.ResultsArtifact, core.ScriptArtifact}) {
+		t.Fatalf("Unexpected uploads: %v", uploaded)
+	}
+}
+
+func TestCancelJob(t *testing.T) {
+	templatePath := filepath.Join(t.TempDir(), "slow.tmpl")
+	err := os.WriteFile(templatePath, []byte(`#!/usr/bin/env bash
+echo "benchmark" > "{{.StagePath}}"
+sleep 30
+`), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	client := newMockClient().(*mockClient)
+	client.cancelCallbacks = make(chan func(string), 1)
+	var finalNote string
+	client.StubUpdateJobWithNote = func(_ *core.JobRecord, _ uint64, note string) (uint64, error) {
+		finalNote = note
+		return 0, nil
+	}
+
+	w, err := NewWorker(client, Config{JobsDir: t.TempDir(), ScriptTemplatePath: templatePath})
+	if err != nil {
+		t.Fatal(err)
+	}
+	wi := w.(*workerImpl)
+
+	// Cancelled while the script runs
+	go func() {
+		cancel := <-client.cancelCallbacks
+		time.Sleep(100 * time.Millisecond)
+		cancel("tester")
+	}()
+	job := core.NewJob(core.JobParameters{Timeout: time.Minute})
+	start := time.Now()
+	if _, err := wi.processJob(context.Background(), wi.slots[0], job, 1); err != nil {
+		t.Fatal(err)
+	} else if job.Status != core.Cancelled || finalNote != "Cancelled by tester" {
+		t.Fatalf("Unexpected status: %v (%s)", job.Status, finalNote)
+	} else if time.Since(start) > 20*time.Second {
+		t.Fatalf("Script not stopped")
+	}
+
+	// Cancelled after the script ran, while uploading artifacts: the failed attempt is not retried
+	wi.testSkipRun = true
+	client.StubUploadArtifact = func(string, string, string, string) (string, error) {
+		select {
+		case cancel := <-client.cancelCallbacks:
+			cancel("tester")
+		default:
+		}
+		return "", fmt.Errorf("object store unavailable")
+	}
+	job = core.NewJob(core.JobParameters{
+		Timeout: time.Minute,
+		Retry:   core.RetryPolicy{MaxAttempts: 2},
+	})
+	if retry, err := wi.processJob(context.Background(), wi.slots[0], job, 1); err != nil {
+		t.Fatal(err)
+	} else if retry || job.Status != core.Cancelled || job.FailureReason != nil || finalNote != "Cancelled by tester" {
+		t.Fatalf("Unexpected status: %v (%v, %s, retry: %v)", job.Status, job.FailureReason, finalNote, retry)
+	}
+}
@@ -1,10 +1,16 @@
 package client
 
 import (
+	"compress/gzip"
 	"context"
+	"errors"
 	"fmt"
 	"io"
 	"os"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
 	"time"
 
 	"github.com/synadia-labs/go-bench-away/v1/core"
@@ -12,6 +18,24 @@ import (
 	"github.com/nats-io/nats.go"
 )
 
+// Time allowed to read an artifact
+const kArtifactReadTimeout = 30 * time.Minute
+
+var artifactNameRegexp = regexp.MustCompile(`^[A-Za-z0-9_\-][A-Za-z0-9_.\-]*$`)
+
+// Error loading a job without record (never submitted, or deleted), matches nats.ErrKeyNotFound
+type jobNotFoundError struct {
+	jobId string
+}
+
+func (e *jobNotFoundError) Error() string {
+	return fmt.Sprintf("Job not found: '%s'", e.jobId)
+}
+
+func (e *jobNotFoundError) Unwrap() error {
+	return nats.ErrKeyNotFound
+}
+
 func (c *Client) LoadJob(jobId string) (*core.JobRecord, uint64, error) {
 
 	c.logDebug("Loading job '%s'", jobId)
@@ -20,7 +44,7 @@ func (c *Client) LoadJob(jobId string) (*core.JobRecord, uint64, error) {
 
 	kve, err := c.jobsRepository.Get(jobRecordKey)
 	if err == nats.ErrKeyNotFound {
-		return nil, 0, fmt.Errorf("Job not found: '%s'", jobId)
+		return nil, 0, &jobNotFoundError{jobId: jobId}
 	} else if err != nil {
 		return nil, 0, err
 	}
@@ -37,39 +61,297 @@ func (c *Client) LoadJob(jobId string) (*core.JobRecord, uint64, error) {
 	return job, revision, nil
 }
 
+// UploadArtifact uploads a file attached to the job under the given name (e.g. log.txt, cpu.pprof), replacing any
+// previous artifact with the same name. Files are stored gzip-compressed, unless they already are (e.g. profiles).
+// Returns the object store key of the artifact, to record on the job (see core.JobRecord.AddArtifact) so that it is
+// listed.
+func (c *Client) UploadArtifact(jobId, name, filePath, contentType string) (string, error) {
+	if !artifactNameRegexp.MatchString(name) {
+		return "", fmt.Errorf("invalid artifact name: '%s'", name)
+	}
+
+	key := fmt.Sprintf(kArtifactKeyTmpl, jobId, name)
+	objMeta := nats.ObjectMeta{
+		Name:        key,
+		Description: fmt.Sprintf("Job %s %s", jobId, name),
+		Metadata: map[string]string{
+			kArtifactJobIdMetadata: jobId,
+			kArtifactNameMetadata:  name,
+			kArtifactTypeMetadata:  contentType,
+		},
+	}
+
+	file, err := os.Open(filePath)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	fileInfo, err := file.Stat()
+	if err != nil {
+		return "", err
+	}
+	objMeta.Metadata[kArtifactSizeMetadata] = strconv.FormatInt(fileInfo.Size(), 10)
+
+	var reader io.Reader = file
+	if compressed, err := isGzipped(file); err != nil {
+		return "", err
+	} else if !compressed {
+		objMeta.Metadata[kArtifactEncMetadata] = core.GzipEncoding
+		gzipReader := compressReader(file)
+		defer gzipReader.Close()
+		reader = gzipReader
+	}
+
+	if _, err := c.artifactsStore.Put(&objMeta, reader); err != nil {
+		return "", err
+	}
+	return key, nil
+}
+
+// Whether the file content is already gzip-compressed (checking its magic number), e.g. pprof profiles
+func isGzipped(file *os.File) (bool, error) {
+	magic := make([]byte, 2)
+	_, readErr := io.ReadFull(file, magic)
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return false, err
+	}
+	return readErr == nil && magic[0] == 0x1f && magic[1] == 0x8b, nil
+}
+
+// Returns a reader of the gzip-compressed content of the given reader, which must be closed
+func compressReader(r io.Reader) io.ReadCloser {
+	pr, pw := io.Pipe()
+	go func() {
+		gw := gzip.NewWriter(pw)
+		_, err := io.Copy(gw, r)
+		if err == nil {
+			err = gw.Close()
+		}
+		pw.CloseWithError(err)
+	}()
+	return pr
+}
+
+// Returns a reader of the decompressed content of an artifact stored with the given encoding
+func decodeReader(r io.Reader, encoding string) (io.Reader, error) {
+	switch encoding {
+	case "":
+		return r, nil
+	case core.GzipEncoding:
+		return gzip.NewReader(r)
+	default:
+		return nil, fmt.Errorf("unsupported artifact encoding: '%s'", encoding)
+	}
+}
+
+// ListArtifacts returns the artifacts recorded on the job, sorted by name
+func (c *Client) ListArtifacts(jobId string) ([]core.ArtifactInfo, error) {
+	job, _, err := c.LoadJob(jobId)
+	if err != nil {
+		return nil, err
+	}
+
+	artifacts := []core.ArtifactInfo{}
+	for _, key := range job.ArtifactKeys() {
+		object, err := c.artifactsStore.GetInfo(key)
+		if errors.Is(err, nats.ErrObjectNotFound) {
+			continue
+		} else if err != nil {
+			return nil, fmt.Errorf("failed to get artifact info: %w", err)
+		}
+		artifacts = append(artifacts, artifactInfo(object))
+	}
+	sort.Slice(artifacts, func(i, j int) bool {
+		return artifacts[i].Name < artifacts[j].Name
+	})
+	return artifacts, nil
+}
+
+// OpenArtifact returns a reader of the job artifact with the given name, which must be closed, and its description.
+// The content is decompressed if the artifact is stored compressed.
+func (c *Client) OpenArtifact(jobId, name string) (io.ReadCloser, *core.ArtifactInfo, error) {
+	return c.openArtifact(jobId, name, true)
+}
+
+// OpenStoredArtifact is like OpenArtifact, but returns the content as stored, compressed with the encoding described
+// in the artifact info, if any (e.g. to serve it as is to clients accepting the encoding)
+func (c *Client) OpenStoredArtifact(jobId, name string) (io.ReadCloser, *core.ArtifactInfo, error) {
+	return c.openArtifact(jobId, name, false)
+}
+
+func (c *Client) openArtifact(jobId, name string, decode bool) (io.ReadCloser, *core.ArtifactInfo, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), kArtifactReadTimeout)
+	object, err := c.artifactsStore.Get(fmt.Sprintf(kArtifactKeyTmpl, jobId, name), nats.Context(ctx))
+	if errors.Is(err, nats.ErrObjectNotFound) {
+		cancel()
+		return nil, nil, fmt.Errorf("Job %s has no artifact '%s'", jobId, name)
+	} else if err != nil {
+		cancel()
+		return nil, nil, fmt.Errorf("artifact get: %w", err)
+	}
+
+	objectInfo, err := object.Info()
+	if err != nil {
+		object.Close()
+		cancel()
+		return nil, nil, fmt.Errorf("artifact info: %w", err)
+	}
+	info := artifactInfo(objectInfo)
+
+	var reader io.Reader = object
+	if decode {
+		if reader, err = decodeReader(object, info.Encoding); err != nil {
+			object.Close()
+			cancel()
+			return nil, nil, fmt.Errorf("artifact decode: %w", err)
+		}
+	}
+
+	return &artifactReader{Reader: reader, object: object, cancel: cancel}, &info, nil
+}
+
+// DownloadArtifact saves the (decompressed) job artifact with the given name to a file
+func (c *Client) DownloadArtifact(jobId, name, filePath string) error {
+	err := c.downloadArtifact(fmt.Sprintf(kArtifactKeyTmpl, jobId, name), filePath)
+	if errors.Is(err, nats.ErrObjectNotFound) {
+		return fmt.Errorf("Job %s has no artifact '%s'", jobId, name)
+	}
+	return err
+}
+
+// Save the decompressed artifact with the given key to a file
+func (c *Client) downloadArtifact(key, filePath string) error {
+	file, err := os.Create(filePath)
+	if err != nil {
+		return err
+	}
+	if err := c.readArtifact(key, file); err != nil {
+		file.Close()
+		os.Remove(filePath)
+		return err
+	}
+	return file.Close()
+}
+
+// DeleteArtifacts deletes all the artifacts attached to the job
+func (c *Client) DeleteArtifacts(jobId string) error {
+	artifacts, err := c.ListArtifacts(jobId)
+	if err != nil {
+		return err
+	}
+	for _, artifact := range artifacts {
+		if err := c.DeleteArtifact(jobId, artifact.Name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// DeleteArtifact deletes the job artifact with the given name
+func (c *Client) DeleteArtifact(jobId, name string) error {
+	if err := c.artifactsStore.Delete(fmt.Sprintf(kArtifactKeyTmpl, jobId, name)); err != nil {
+		return fmt.Errorf("failed to delete artifact '%s': %w", name, err)
+	}
+	return nil
+}
+
+// Describe an artifact from its object info.
+// Artifacts uploaded by older versions have no metadata: their name is the last part of their key, and their content
+// type is derived from the name.
+func artifactInfo(object *nats.ObjectInfo) core.ArtifactInfo {
+	name := object.Metadata[kArtifactNameMetadata]
+	if name == "" {
+		name = path.Base(object.Name)
+	}
+	// Artifacts are stored uncompressed unless their encoding is set
+	size := object.Size
+	if originalSize, err := strconv.ParseUint(object.Metadata[kArtifactSizeMetadata], 10, 64); err == nil {
+		size = originalSize
+	}
+	contentType := object.Metadata[kArtifactTypeMetadata]
+	if contentType == "" {
+		switch path.Ext(name) {
+		case ".txt":
+			contentType = core.TextContentType
+		case ".sh":
+			contentType = core.ScriptContentType
+		default:
+			contentType = core.BinaryContentType
+		}
+	}
+	return core.ArtifactInfo{
+		Name:        name,
+		ContentType: contentType,
+		Size:        size,
+		Encoding:    object.Metadata[kArtifactEncMetadata],
+		StoredSize:  object.Size,
+		Modified:    object.ModTime,
+	}
+}
+
+// Artifact object reader (possibly decompressing), closing the object and releasing the read context when closed
+type artifactReader struct {
+	io.Reader
+	object nats.ObjectResult
+	cancel context.CancelFunc
+}
+
+func (r *artifactReader) Close() error {
+	defer r.cancel()
+	return r.object.Close()
+}
+
+// DownloadLogArtifact saves the job log to a file.
+//
+// Deprecated: use DownloadArtifact.
 func (c *Client) DownloadLogArtifact(job *core.JobRecord, filePath string) error {
 	if job.Log == "" {
 		return fmt.Errorf("Job %s has no log artifact", job.Id)
 	}
-	return c.artifactsStore.GetFile(job.Log, filePath)
+	return c.downloadArtifact(job.Log, filePath)
 }
 
+// DownloadResultsArtifact saves the job results to a file.
+//
+// Deprecated: use DownloadArtifact.
 func (c *Client) DownloadResultsArtifact(job *core.JobRecord, filePath string) error {
 	if job.Results == "" {
 		return fmt.Errorf("Job %s has no results artifact", job.Id)
 	}
-	return c.artifactsStore.GetFile(job.Results, filePath)
+	return c.downloadArtifact(job.Results, filePath)
 }
 
+// DownloadScriptArtifact saves the job script to a file.
+//
+// Deprecated: use DownloadArtifact.
 func (c *Client) DownloadScriptArtifact(job *core.JobRecord, filePath string) error {
 	if job.Script == "" {
 		return fmt.Errorf("Job %s has no script artifact", job.Id)
 	}
-	return c.artifactsStore.GetFile(job.Script, filePath)
+	return c.downloadArtifact(job.Script, filePath)
 }
 
 func (c *Client) readArtifact(key string, w io.Writer) error {
 	if key == "" {
 		return fmt.Errorf("missing artifact")
 	}
-	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Minute)
+	ctx, cancel := context.WithTimeout(context.Background(), kArtifactReadTimeout)
 	defer cancel()
 	o, err := c.artifactsStore.Get(key, nats.Context(ctx))
 	if err != nil {
 		return fmt.Errorf("artifact get: %w", err)
 	}
 	defer o.Close()
-	_, err = io.Copy(w, o)
+	info, err := o.Info()
+	if err != nil {
+		return fmt.Errorf("artifact info: %w", err)
+	}
+	reader, err := decodeReader(o, info.Metadata[kArtifactEncMetadata])
+	if err != nil {
+		return fmt.Errorf("artifact decode: %w", err)
+	}
+	_, err = io.Copy(w, reader)
 	if err != nil {
 		return fmt.Errorf("artifact copy: %w", err)
 	}
@@ -84,43 +366,36 @@ func (c *Client) LoadLogArtifact(job *core.JobRecord, writer io.Writer) error {
 	return c.readArtifact(job.Log, writer)
 }
 
+// LoadAttemptLogArtifact writes the log of the given attempt, which may be a previous failed one
+func (c *Client) LoadAttemptLogArtifact(job *core.JobRecord, attempt uint, writer io.Writer) error {
+	key, err := job.AttemptLog(attempt)
+	if err != nil {
+		return err
+	}
+	return c.readArtifact(key, writer)
+}
+
 func (c *Client) LoadScriptArtifact(job *core.JobRecord, writer io.Writer) error {
 	return c.readArtifact(job.Script, writer)
 }
 
-func (c *Client) UploadLogArtifact(jobId, logFilePath string) (string, error) {
-	key := fmt.Sprintf(logArtifactKeyTemplate, jobId)
-	description := fmt.Sprintf("Job %s log file", jobId)
-	err := c.uploadArtifact(key, description, logFilePath)
-	return key, err
+// UploadLogArtifact uploads the log of the given attempt.
+//
+// Deprecated: use UploadArtifact with core.AttemptLogArtifact.
+func (c *Client) UploadLogArtifact(jobId string, attempt uint, logFilePath string) (string, error) {
+	return c.UploadArtifact(jobId, core.AttemptLogArtifact(attempt), logFilePath, core.TextContentType)
 }
 
+// UploadResultsArtifact uploads the job results.
+//
+// Deprecated: use UploadArtifact with core.ResultsArtifact.
 func (c *Client) UploadResultsArtifact(jobId, resultsFilePath string) (string, error) {
-	key := fmt.Sprintf(resultsArtifactKeyTemplate, jobId)
-	description := fmt.Sprintf("Job %s results file", jobId)
-	err := c.uploadArtifact(key, description, resultsFilePath)
-	return key, err
+	return c.UploadArtifact(jobId, core.ResultsArtifact, resultsFilePath, core.TextContentType)
 }
 
+// UploadScriptArtifact uploads the job script.
+//
+// Deprecated: use UploadArtifact with core.ScriptArtifact.
 func (c *Client) UploadScriptArtifact(jobId, scriptFilePath string) (string, error) {
-	key := fmt.Sprintf(scriptArtifactKeyTemplate, jobId)
-	description := fmt.Sprintf("Job %s run script file", jobId)
-	err := c.uploadArtifact(key, description, scriptFilePath)
-	return key, err
-}
-
-func (c *Client) uploadArtifact(key, description, filePath string) error {
-	objMeta := nats.ObjectMeta{
-		Name:        key,
-		Description: description,
-	}
-
-	file, err := os.Open(filePath)
-	if err != nil {
-		return err
-	}
-	defer file.Close()
-
-	_, putErr := c.artifactsStore.Put(&objMeta, file)
-	return putErr
+	return c.UploadArtifact(jobId, core.ScriptArtifact, scriptFilePath, core.ScriptContentType)
 }
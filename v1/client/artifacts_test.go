@@ -0,0 +1,278 @@
+package client
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	server "github.com/nats-io/nats-server/v2/test"
+	"github.com/nats-io/nats.go"
+	"github.com/synadia-labs/go-bench-away/v1/core"
+)
+
+func TestArtifacts(t *testing.T) {
+
+	opts := server.DefaultTestOptions
+	opts.Port = -1
+	opts.JetStream = true
+	opts.StoreDir = t.TempDir()
+
+	s := server.RunServer(&opts)
+	defer s.Shutdown()
+
+	bareClient, err := NewClient(s.ClientURL(), "", "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer bareClient.Close()
+
+	if err := bareClient.CreateJobsRepository(); err != nil {
+		t.Fatal(err)
+	}
+	if err := bareClient.CreateArtifactsStore(); err != nil {
+		t.Fatal(err)
+	}
+
+	client, err := NewClient(s.ClientURL(), "", "test", InitJobsRepository(), InitArtifactsStore())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	// Artifacts are listed from the job record
+	putJob := func(job *core.JobRecord) {
+		if _, err := client.jobsRepository.Put(fmt.Sprintf(kJobRecordKeyTmpl, job.Id), job.Bytes()); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	dir := t.TempDir()
+	writeFile := func(name, content string) string {
+		filePath := filepath.Join(dir, name)
+		if err := os.WriteFile(filePath, []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+		return filePath
+	}
+
+	job1 := &core.JobRecord{Id: "job-1"}
+	job2 := &core.JobRecord{Id: "job-2"}
+
+	key, err := client.UploadArtifact(job1.Id, "cpu.pprof", writeFile("cpu", "profile"), core.BinaryContentType)
+	if err != nil {
+		t.Fatal(err)
+	} else if key != "jobs/job-1/cpu.pprof" {
+		t.Fatalf("Unexpected key: %s", key)
+	}
+	job1.AddArtifact("cpu.pprof", key)
+	if key, err = client.UploadResultsArtifact(job1.Id, writeFile("results", "BenchmarkFoo 1 1 ns/op")); err != nil {
+		t.Fatal(err)
+	}
+	job1.AddArtifact(core.ResultsArtifact, key)
+	if key, err = client.UploadArtifact(job2.Id, "log.txt", writeFile("log", "other job"), core.TextContentType); err != nil {
+		t.Fatal(err)
+	}
+	job2.AddArtifact(core.LogArtifact, key)
+	if _, err := client.UploadArtifact(job1.Id, "../escape", writeFile("bad", ""), core.TextContentType); err == nil {
+		t.Fatalf("Expected error uploading artifact with invalid name")
+	}
+
+	// Uploaded by an older version, without metadata, and only referenced by the record field
+	legacyMeta := nats.ObjectMeta{Name: "jobs/job-1/log.txt"}
+	if _, err := client.artifactsStore.Put(&legacyMeta, strings.NewReader("legacy log")); err != nil {
+		t.Fatal(err)
+	}
+	job1.Log = legacyMeta.Name
+
+	// Not recorded on the job
+	if _, err := client.UploadArtifact(job1.Id, "unlisted.txt", writeFile("unlisted", ""), core.TextContentType); err != nil {
+		t.Fatal(err)
+	}
+
+	putJob(job1)
+	putJob(job2)
+
+	artifacts, err := client.ListArtifacts("job-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []core.ArtifactInfo{
+		{Name: "cpu.pprof", ContentType: core.BinaryContentType, Size: 7},
+		{Name: "log.txt", ContentType: core.TextContentType, Size: 10},
+		{Name: core.ResultsArtifact, ContentType: core.TextContentType, Size: 22},
+	}
+	if len(artifacts) != len(expected) {
+		t.Fatalf("Expected %d artifacts, got: %+v", len(expected), artifacts)
+	}
+	for i, artifact := range artifacts {
+		if artifact.Name != expected[i].Name ||
+			artifact.ContentType != expected[i].ContentType ||
+			artifact.Size != expected[i].Size ||
+			artifact.Modified.IsZero() {
+			t.Fatalf("Expected artifact %+v, got: %+v", expected[i], artifact)
+		}
+	}
+
+	reader, info, err := client.OpenArtifact("job-1", "log.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := io.ReadAll(reader)
+	reader.Close()
+	if err != nil {
+		t.Fatal(err)
+	} else if string(data) != "legacy log" || info.Name != "log.txt" || info.ContentType != core.TextContentType {
+		t.Fatalf("Unexpected artifact: %s (%+v)", data, info)
+	}
+
+	if _, _, err := client.OpenArtifact("job-1", "missing.txt"); err == nil {
+		t.Fatalf("Expected error opening missing artifact")
+	}
+
+	downloadPath := filepath.Join(dir, "downloaded")
+	if err := client.DownloadArtifact("job-1", "cpu.pprof", downloadPath); err != nil {
+		t.Fatal(err)
+	} else if data, _ := os.ReadFile(downloadPath); string(data) != "profile" {
+		t.Fatalf("Unexpected downloaded artifact: %s", data)
+	}
+
+	// Artifacts uploaded by name can still be loaded through the job record fields
+	var buf bytes.Buffer
+	if err := client.LoadResultsArtifact(&core.JobRecord{Results: "jobs/job-1/results.txt"}, &buf); err != nil {
+		t.Fatal(err)
+	} else if buf.String() != "BenchmarkFoo 1 1 ns/op" {
+		t.Fatalf("Unexpected results: %s", buf.String())
+	}
+
+	if err := client.DeleteArtifacts("job-1"); err != nil {
+		t.Fatal(err)
+	}
+	if artifacts, err := client.ListArtifacts("job-1"); err != nil {
+		t.Fatal(err)
+	} else if len(artifacts) != 0 {
+		t.Fatalf("Unexpected artifacts after delete: %+v", artifacts)
+	}
+	if artifacts, err := client.ListArtifacts("job-2"); err != nil {
+		t.Fatal(err)
+	} else if len(artifacts) != 1 {
+		t.Fatalf("Unexpected artifacts of other job: %+v", artifacts)
+	}
+}
+
+func TestArtifactsCompression(t *testing.T) {
+
+	opts := server.DefaultTestOptions
+	opts.Port = -1
+	opts.JetStream = true
+	opts.StoreDir = t.TempDir()
+
+	s := server.RunServer(&opts)
+	defer s.Shutdown()
+
+	bareClient, err := NewClient(s.ClientURL(), "", "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer bareClient.Close()
+
+	if err := bareClient.CreateJobsRepository(); err != nil {
+		t.Fatal(err)
+	}
+	if err := bareClient.CreateArtifactsStore(); err != nil {
+		t.Fatal(err)
+	}
+
+	client, err := NewClient(s.ClientURL(), "", "test", InitJobsRepository(), InitArtifactsStore())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	dir := t.TempDir()
+	log := strings.Repeat("BenchmarkFoo-8   1000000   1000 ns/op\n", 1000)
+	logPath := filepath.Join(dir, "log")
+	if err := os.WriteFile(logPath, []byte(log), 0600); err != nil {
+		t.Fatal(err)
+	}
+	// Already compressed, like pprof profiles
+	var profile bytes.Buffer
+	gw := gzip.NewWriter(&profile)
+	_, _ = gw.Write([]byte("profile"))
+	_ = gw.Close()
+	profilePath := filepath.Join(dir, "profile")
+	if err := os.WriteFile(profilePath, profile.Bytes(), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	logKey, err := client.UploadLogArtifact("job-1", 1, logPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	profileKey, err := client.UploadArtifact("job-1", "cpu.pprof", profilePath, core.BinaryContentType)
+	if err != nil {
+		t.Fatal(err)
+	}
+	job := &core.JobRecord{Id: "job-1", Log: logKey}
+	job.AddArtifact("cpu.pprof", profileKey)
+	if _, err := client.jobsRepository.Put(fmt.Sprintf(kJobRecordKeyTmpl, job.Id), job.Bytes()); err != nil {
+		t.Fatal(err)
+	}
+
+	// Stored compressed, profiles are not compressed twice
+	if stored, err := client.artifactsStore.GetBytes(logKey); err != nil {
+		t.Fatal(err)
+	} else if len(stored) >= len(log) || !bytes.HasPrefix(stored, []byte{0x1f, 0x8b}) {
+		t.Fatalf("Log stored uncompressed (%d bytes)", len(stored))
+	}
+	if stored, err := client.artifactsStore.GetBytes("jobs/job-1/cpu.pprof"); err != nil {
+		t.Fatal(err)
+	} else if !bytes.Equal(stored, profile.Bytes()) {
+		t.Fatalf("Profile stored modified")
+	}
+
+	artifacts, err := client.ListArtifacts("job-1")
+	if err != nil {
+		t.Fatal(err)
+	} else if len(artifacts) != 2 {
+		t.Fatalf("Unexpected artifacts: %+v", artifacts)
+	} else if artifacts[0].Encoding != "" || artifacts[0].Size != artifacts[0].StoredSize {
+		t.Fatalf("Unexpected profile artifact: %+v", artifacts[0])
+	} else if artifacts[1].Encoding != core.GzipEncoding ||
+		artifacts[1].Size != uint64(len(log)) ||
+		artifacts[1].StoredSize >= artifacts[1].Size {
+		t.Fatalf("Unexpected log artifact: %+v", artifacts[1])
+	}
+
+	// Decompressed when read, unless the stored content is requested
+	var buf bytes.Buffer
+	if err := client.LoadLogArtifact(&core.JobRecord{Log: logKey}, &buf); err != nil {
+		t.Fatal(err)
+	} else if buf.String() != log {
+		t.Fatalf("Unexpected log (%d bytes)", buf.Len())
+	}
+
+	downloadPath := filepath.Join(dir, "downloaded")
+	if err := client.DownloadLogArtifact(&core.JobRecord{Id: "job-1", Log: logKey}, downloadPath); err != nil {
+		t.Fatal(err)
+	} else if data, _ := os.ReadFile(downloadPath); string(data) != log {
+		t.Fatalf("Unexpected downloaded log (%d bytes)", len(data))
+	}
+
+	reader, info, err := client.OpenStoredArtifact("job-1", "log.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reader.Close()
+	gr, err := gzip.NewReader(reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data, err := io.ReadAll(gr); err != nil || string(data) != log || info.Encoding != core.GzipEncoding {
+		t.Fatalf("Unexpected stored artifact (%v): %d bytes, %+v", err, len(data), info)
+	}
+}
@@ -2,18 +2,28 @@ package client
 
 import (
 	"fmt"
+	"os"
+	"os/user"
 	"time"
 
 	"github.com/nats-io/nats.go"
 )
 
 const (
-	kJobsConsumerNameTmpl      = "%s-worker" // Substitute Namespace
-	kJobRecordKeyTmpl          = "jobs/%s"   // substitute Job ID
-	kJobIdHeader               = "x-job-id"
-	logArtifactKeyTemplate     = "jobs/%s/log.txt"
-	resultsArtifactKeyTemplate = "jobs/%s/results.txt"
-	scriptArtifactKeyTemplate  = "jobs/%s/run.sh"
+	kJobsConsumerNameTmpl   = "%s-worker-%s" // Substitute Namespace and priority
+	kLegacyConsumerNameTmpl = "%s-worker"    // Substitute Namespace, consumer of all jobs before priorities
+	kJobRecordKeyTmpl       = "jobs/%s"      // substitute Job ID
+	kJobIdHeader            = "x-job-id"
+	kJobCancelSubjectTmpl   = "%s.jobs.cancel.%s"   // substitute Namespace and Job ID
+	kJobLogSubjectTmpl      = "%s.jobs.log.%s"      // substitute Namespace and Job ID
+	kWorkerRecordKeyTmpl    = "workers/%s"          // substitute Worker ID
+	kWorkerDrainSubjectTmpl = "%s.workers.drain.%s" // substitute Namespace and Worker ID
+	kArtifactKeyTmpl        = "jobs/%s/%s"          // substitute Job ID and artifact name
+	kArtifactJobIdMetadata  = "job-id"
+	kArtifactNameMetadata   = "artifact"
+	kArtifactTypeMetadata   = "content-type"
+	kArtifactEncMetadata    = "content-encoding"
+	kArtifactSizeMetadata   = "size" // Size before compression
 )
 
 type Options struct {
@@ -21,25 +31,31 @@ type Options struct {
 	credentials         string
 	namespace           string
 	clientName          string
+	actor               string
 	jobsQueueName       string
 	jobsQueueStreamName string
 	jobsSubmitSubject   string
 	jobsRepositoryName  string
 	artifactsStoreName  string
+	workersRegistryName string
+	logsStreamName      string
 	initJobsRepository  bool
 	initArtifactsStore  bool
 	initJobsQueue       bool
+	initWorkersRegistry bool
+	optWorkersRegistry  bool // Workers registry may be missing (deployments not upgraded yet)
 	verbose             bool
 }
 
 type Option func(*Options) error
 
 type Client struct {
-	options        Options
-	nc             *nats.Conn
-	js             nats.JetStreamContext
-	jobsRepository nats.KeyValue
-	artifactsStore nats.ObjectStore
+	options         Options
+	nc              *nats.Conn
+	js              nats.JetStreamContext
+	jobsRepository  nats.KeyValue
+	artifactsStore  nats.ObjectStore
+	workersRegistry nats.KeyValue
 }
 
 func (c *Client) Close() {
@@ -60,7 +76,10 @@ func NewClient(serverUrl, credentials, namespace string, opts ...Option) (*Clien
 			jobsSubmitSubject:   fmt.Sprintf("%s.jobs.submit", namespace),
 			jobsRepositoryName:  fmt.Sprintf("%s-jobs", namespace),
 			artifactsStoreName:  fmt.Sprintf("%s-artifacts", namespace),
+			workersRegistryName: fmt.Sprintf("%s-workers", namespace),
+			logsStreamName:      fmt.Sprintf("%s-logs", namespace),
 			clientName:          "go-bench-away CLI", //TODO add user@hostname
+			actor:               defaultActor(),
 		},
 	}
 
@@ -147,6 +166,22 @@ func NewClient(serverUrl, credentials, namespace string, opts ...Option) (*Clien
 
 	client.logDebug("Bound artifacts store")
 
+	if options.initWorkersRegistry {
+		kv, err := client.js.KeyValue(options.workersRegistryName)
+		if err == nats.ErrBucketNotFound && options.optWorkersRegistry {
+			client.logWarn("KV bucket not found: %s (need to run init-schema?), workers are not registered",
+				options.workersRegistryName)
+		} else if err == nats.ErrBucketNotFound {
+			return nil, fmt.Errorf("KV bucket not found: %s (need to run init-schema?)", options.workersRegistryName)
+		} else if err != nil {
+			return nil, err
+		} else {
+			client.workersRegistry = kv
+		}
+	}
+
+	client.logDebug("Bound workers registry")
+
 	// Disengage shutdown trap
 	initCompleted = true
 	return client, nil
@@ -172,6 +207,23 @@ func InitArtifactsStore() Option {
 	}
 }
 
+func InitWorkersRegistry() Option {
+	return func(o *Options) error {
+		o.initWorkersRegistry = true
+		return nil
+	}
+}
+
+// InitWorkersRegistryIfExists binds the workers registry if it exists, without failing otherwise
+// (see HasWorkersRegistry)
+func InitWorkersRegistryIfExists() Option {
+	return func(o *Options) error {
+		o.initWorkersRegistry = true
+		o.optWorkersRegistry = true
+		return nil
+	}
+}
+
 func WithClientName(clientName string) Option {
 	return func(o *Options) error {
 		o.clientName = clientName
@@ -188,6 +240,26 @@ func WithAltQueue(queueName string) Option {
 	}
 }
 
+// WithActor sets the name recorded in the history of jobs updated by this client (default: user@hostname)
+func WithActor(actor string) Option {
+	return func(o *Options) error {
+		o.actor = actor
+		return nil
+	}
+}
+
+func defaultActor() string {
+	username := "?"
+	if u, err := user.Current(); err == nil {
+		username = u.Username
+	}
+	hostname := "?"
+	if h, err := os.Hostname(); err == nil {
+		hostname = h
+	}
+	return fmt.Sprintf("%s@%s", username, hostname)
+}
+
 func Verbose(verbose bool) Option {
 	return func(o *Options) error {
 		o.verbose = verbose
@@ -2,6 +2,7 @@ package client
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"time"
 
@@ -10,28 +11,60 @@ import (
 	"github.com/nats-io/nats.go"
 )
 
+// How long a job waiting for its dependencies is held before being checked again
+const kDependenciesRecheckDelay = 10 * time.Second
+
+// How long a job requeued by the handler is held before being dispatched again
+const kRequeueDelay = 30 * time.Second
+
+// How long a dispatched job message can go without being acknowledged (or marked in progress) before it is
+// redelivered. While the handler runs, the message is marked in progress periodically, so this only expires
+// if the worker dies.
+const kJobAckWait = 2 * time.Minute
+
+// How often the message of a job being handled is marked in progress
+const kJobKeepAliveInterval = kJobAckWait / 4
+
+type dependenciesState int
+
+const (
+	dependenciesPending dependenciesState = iota
+	dependenciesSatisfied
+	dependenciesFailed
+)
+
+// DispatchJobs fetches submitted jobs from the queue and passes them to the handler, one at a time.
+// If the handler returns true, the job message is not acknowledged and the job is dispatched again after a delay
+// (the handler is expected to have reset the job record to Submitted).
+// Closing the context stops dispatching new jobs, the job being handled (if any) is not interrupted.
 func (c *Client) DispatchJobs(ctx context.Context, handleJob func(*core.JobRecord, uint64) (bool, error)) error {
 
-	// Subscribe with durable pull consumer
-	consumerName := fmt.Sprintf(kJobsConsumerNameTmpl, c.options.namespace)
-	var subOpts = []nats.SubOpt{
-		nats.BindStream(c.options.jobsQueueStreamName),
-		nats.MaxAckPending(500),
-	}
-	sub, err := c.js.PullSubscribe(
-		"",
-		consumerName,
-		subOpts...,
-	)
-	if err != nil {
-		return fmt.Errorf("Subscribe error: %v", err)
-	}
+	// Subscribe with one durable pull consumer per priority level, highest priority first
+	subs := make([]*nats.Subscription, 0, len(core.Priorities))
 	defer func() {
-		if err := sub.Unsubscribe(); err != nil {
-			c.logWarn("Failed to unsubscribe: %v", err)
+		for _, sub := range subs {
+			if err := sub.Unsubscribe(); err != nil {
+				c.logWarn("Failed to unsubscribe: %v", err)
+			}
 		}
 	}()
 
+	for _, priority := range core.Priorities {
+		consumerName, err := c.createJobsConsumer(priority)
+		if err != nil {
+			return fmt.Errorf("Consumer error (priority: %s): %v", priority, err)
+		}
+		sub, err := c.js.PullSubscribe(
+			c.jobsSubmitSubject(priority),
+			consumerName,
+			nats.Bind(c.options.jobsQueueStreamName, consumerName),
+		)
+		if err != nil {
+			return fmt.Errorf("Subscribe error (priority: %s): %v", priority, err)
+		}
+		subs = append(subs, sub)
+	}
+
 	var dispatchErr error
 
 dispatchLoop:
@@ -42,8 +75,8 @@ dispatchLoop:
 			break dispatchLoop
 		}
 
-		// Try to fetch one message
-		msgs, err := sub.Fetch(1, nats.MaxWait(1*time.Second))
+		// Try to fetch one message, starting from the highest priority
+		msgs, err := fetchNext(subs)
 		if err == nats.ErrTimeout {
 			c.logDebug("No pending jobs")
 			continue dispatchLoop
@@ -60,12 +93,26 @@ dispatchLoop:
 		}
 
 		msg := msgs[0]
+
+		if ctx.Err() != nil {
+			// Context was closed while fetching, give the message back so another worker can pick it up
+			if err := msg.Nak(); err != nil {
+				c.logWarn("Failed to NAK message: %v", err)
+			}
+			dispatchErr = fmt.Errorf("Context closed: %w", ctx.Err())
+			break dispatchLoop
+		}
+
 		if err := msg.InProgress(); err != nil {
 			c.logWarn("Failed to mark message as in-progress: %v", err)
 		}
 
 		c.logDebug("Handling job queue message")
 
+		if metadata, err := msg.Metadata(); err == nil && metadata.NumDelivered > 1 {
+			c.logDebug("Message delivered %d times", metadata.NumDelivered)
+		}
+
 		jobId := msg.Header.Get(kJobIdHeader)
 		if jobId == "" {
 			c.logWarn("Ignoring message lacking job ID header")
@@ -94,14 +141,72 @@ dispatchLoop:
 			continue dispatchLoop
 		}
 
+		if len(job.DependsOn) > 0 {
+			state, failedDependencyId, err := c.checkDependencies(job)
+			if err != nil {
+				c.logWarn("Failed to check dependencies of job %s: %v", jobId, err)
+			}
+
+			switch state {
+			case dependenciesPending:
+				c.logDebug("Holding job %s until its dependencies complete", jobId)
+				if err := msg.NakWithDelay(kDependenciesRecheckDelay); err != nil {
+					c.logWarn("Failed to NAK message: %v", err)
+				}
+				continue dispatchLoop
+
+			case dependenciesFailed:
+				c.logWarn(
+					"Dependency %s of job %s did not succeed (policy: %s)",
+					failedDependencyId,
+					jobId,
+					job.DependencyPolicy,
+				)
+				if job.DependencyPolicy == core.FailOnDependencyFailure {
+					job.SetFailedStatus(core.DependencyFailure, "Dependency %s did not succeed", failedDependencyId)
+				} else {
+					job.SetFinalStatus(core.Cancelled)
+					job.FailureReason = &core.FailureReason{
+						Category: core.DependencyFailure,
+						Message:  fmt.Sprintf("Dependency %s did not succeed", failedDependencyId),
+					}
+				}
+				if _, err := c.UpdateJob(job, revision); err != nil {
+					c.logWarn("Failed to update job %s: %v", jobId, err)
+				}
+				if err := msg.Ack(); err != nil {
+					c.logWarn("Failed to ACK message: %v", err)
+				}
+				continue dispatchLoop
+
+			case dependenciesSatisfied:
+				// Proceed to dispatch
+			}
+		}
+
 		c.logDebug("Dispatching job %s", jobId)
 
-		// TODO implement retry
-		_, handleErr := handleJob(job, revision)
+		stopKeepAlive := c.keepAlive(msg, kJobKeepAliveInterval)
+		requeue, handleErr := handleJob(job, revision)
+		stopKeepAlive()
 		if handleErr != nil {
 			c.logWarn("Failed to process job %s: %v", jobId, handleErr)
 		}
 
+		if requeue && c.isClaimedElsewhere(job.Id, revision) {
+			// Duplicate delivery, the handler lost the race to claim the job (or it was cancelled in the meantime)
+			c.logWarn("Job %s was modified since it was dispatched, skipping", jobId)
+			requeue = false
+		}
+
+		if requeue {
+			c.logDebug("Requeueing job %s", jobId)
+			if err := msg.NakWithDelay(kRequeueDelay); err != nil {
+				c.logWarn("Failed to NAK message: %v", err)
+			}
+			continue dispatchLoop
+		}
+
 		if err := msg.Ack(); err != nil {
 			c.logWarn("Failed to ACK message: %v", err)
 		}
@@ -109,3 +214,142 @@ dispatchLoop:
 
 	return dispatchErr
 }
+
+// Create the durable pull consumer for the given priority, or update its configuration if it already exists.
+// New consumers start where the consumer of versions without priorities is, if it still exists, rather than replaying
+// the whole queue. Returns the consumer name.
+func (c *Client) createJobsConsumer(priority core.JobPriority) (string, error) {
+	consumerName := fmt.Sprintf(kJobsConsumerNameTmpl, c.options.namespace, priority)
+
+	cfg := nats.ConsumerConfig{
+		Durable:       consumerName,
+		FilterSubject: c.jobsSubmitSubject(priority),
+		AckPolicy:     nats.AckExplicitPolicy,
+		AckWait:       kJobAckWait,
+		// Jobs held for their dependencies or requeued are redelivered many times, so deliveries are not limited.
+		// Duplicate deliveries are harmless: jobs are skipped unless their record is Submitted.
+		MaxDeliver:    -1,
+		MaxAckPending: 500,
+	}
+
+	info, err := c.js.ConsumerInfo(c.options.jobsQueueStreamName, consumerName)
+	if err == nats.ErrConsumerNotFound {
+		var startSeq uint64
+		if startSeq, err = c.legacyConsumerPosition(); err == nil && startSeq > 0 {
+			cfg.DeliverPolicy = nats.DeliverByStartSequencePolicy
+			cfg.OptStartSeq = startSeq
+		}
+		if err == nil {
+			_, err = c.js.AddConsumer(c.options.jobsQueueStreamName, &cfg)
+		}
+	} else if err == nil {
+		// Consumer created by a previous version, or another worker, upgrade it (its start position can't change)
+		cfg.DeliverPolicy = info.Config.DeliverPolicy
+		cfg.OptStartSeq = info.Config.OptStartSeq
+		_, err = c.js.UpdateConsumer(c.options.jobsQueueStreamName, &cfg)
+	}
+	if err != nil {
+		return "", err
+	}
+	return consumerName, nil
+}
+
+// Stream sequence of the first job not yet processed by the consumer of versions without priorities, 0 if it does
+// not exist. Jobs past it may have been processed already, delivering them again is harmless.
+func (c *Client) legacyConsumerPosition() (uint64, error) {
+	legacyConsumerName := fmt.Sprintf(kLegacyConsumerNameTmpl, c.options.namespace)
+	info, err := c.js.ConsumerInfo(c.options.jobsQueueStreamName, legacyConsumerName)
+	if err == nats.ErrConsumerNotFound {
+		return 0, nil
+	} else if err != nil {
+		return 0, err
+	}
+	return info.AckFloor.Stream + 1, nil
+}
+
+// Periodically mark the message as in progress so it is not redelivered, until the returned function is called
+func (c *Client) keepAlive(msg *nats.Msg, interval time.Duration) func() {
+	stopCh := make(chan struct{})
+	doneCh := make(chan struct{})
+	go func() {
+		defer close(doneCh)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stopCh:
+				return
+			case <-ticker.C:
+				if err := msg.InProgress(); err != nil {
+					c.logWarn("Failed to mark message as in-progress: %v", err)
+				}
+			}
+		}
+	}()
+	return func() {
+		close(stopCh)
+		<-doneCh
+	}
+}
+
+// Check whether the job record changed since the given revision, and is no longer Submitted.
+// I.e. another worker claimed it (after a duplicate delivery), or it was cancelled.
+func (c *Client) isClaimedElsewhere(jobId string, revision uint64) bool {
+	job, currentRevision, err := c.LoadJob(jobId)
+	if err != nil {
+		return false
+	}
+	return currentRevision != revision && job.Status != core.Submitted
+}
+
+// Check the status of the jobs the given job depends on.
+// If the job policy is not to run anyway, a dependency that did not succeed is reported as soon as it completes,
+// and its ID is returned. Dependencies whose record no longer exists (e.g. deleted) count as not succeeded, other
+// errors leave the dependencies pending.
+func (c *Client) checkDependencies(job *core.JobRecord) (dependenciesState, string, error) {
+	allCompleted := true
+	failedDependencyId := ""
+
+	for _, dependencyId := range job.DependsOn {
+		dependency, _, err := c.LoadJob(dependencyId)
+		if errors.Is(err, nats.ErrKeyNotFound) {
+			c.logWarn("Dependency %s of job %s not found", dependencyId, job.Id)
+			if failedDependencyId == "" {
+				failedDependencyId = dependencyId
+			}
+			continue
+		} else if err != nil {
+			return dependenciesPending, "", err
+		}
+
+		if !dependency.IsCompleted() {
+			allCompleted = false
+		} else if dependency.Status != core.Succeeded && failedDependencyId == "" {
+			failedDependencyId = dependencyId
+		}
+	}
+
+	if failedDependencyId != "" && job.DependencyPolicy != core.RunOnDependencyFailure {
+		return dependenciesFailed, failedDependencyId, nil
+	} else if !allCompleted {
+		return dependenciesPending, "", nil
+	}
+	return dependenciesSatisfied, "", nil
+}
+
+// Fetch one message from the first subscription (in order) that has any pending.
+// Returns nats.ErrTimeout if none of them do.
+func fetchNext(subs []*nats.Subscription) ([]*nats.Msg, error) {
+	// Poll each level briefly, so an idle loop over all priorities takes about a second
+	maxWait := 1 * time.Second / time.Duration(len(subs))
+	for _, sub := range subs {
+		msgs, err := sub.Fetch(1, nats.MaxWait(maxWait))
+		if err == nats.ErrTimeout {
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		return msgs, nil
+	}
+	return nil, nats.ErrTimeout
+}
@@ -0,0 +1,154 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/nats-io/nats.go"
+)
+
+const (
+	kLogsStreamMaxAge       = 24 * time.Hour
+	kLogsStreamMaxBytes     = 1 << 30
+	kLogChunkMaxSize        = 64 * 1024
+	kLogFlushInterval       = time.Second
+	kLogFollowCheckInterval = 10 * time.Second
+	kLogAttemptHeader       = "x-job-attempt"
+	kLogEndHeader           = "x-log-end"
+)
+
+func (c *Client) jobLogSubject(jobId string) string {
+	return fmt.Sprintf(kJobLogSubjectTmpl, c.options.namespace, jobId)
+}
+
+// PublishJobLog returns a writer publishing the output of a running job attempt, in chunks sent at least every
+// second. Publishing is best effort (the log artifact is the complete record), errors are not reported.
+// Closing the writer sends pending output and marks the end of the attempt log.
+func (c *Client) PublishJobLog(jobId string, attempt uint) io.WriteCloser {
+	return &logPublisher{
+		nc:      c.nc,
+		subject: c.jobLogSubject(jobId),
+		attempt: strconv.FormatUint(uint64(attempt), 10),
+	}
+}
+
+type logPublisher struct {
+	nc      *nats.Conn
+	subject string
+	attempt string
+	mu      sync.Mutex
+	buf     []byte
+	timer   *time.Timer
+	closed  bool
+}
+
+func (p *logPublisher) Write(data []byte) (int, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.closed {
+		return len(data), nil
+	}
+	p.buf = append(p.buf, data...)
+	if len(p.buf) >= kLogChunkMaxSize {
+		p.flush()
+	} else if p.timer == nil {
+		p.timer = time.AfterFunc(kLogFlushInterval, func() {
+			p.mu.Lock()
+			defer p.mu.Unlock()
+			p.flush()
+		})
+	}
+	return len(data), nil
+}
+
+// Publish buffered output, in chunks of bounded size. Must be called with the lock held.
+func (p *logPublisher) flush() {
+	if p.timer != nil {
+		p.timer.Stop()
+		p.timer = nil
+	}
+	for len(p.buf) > 0 {
+		chunkSize := min(len(p.buf), kLogChunkMaxSize)
+		p.publish(p.buf[:chunkSize], false)
+		p.buf = p.buf[chunkSize:]
+	}
+	p.buf = nil
+}
+
+func (p *logPublisher) publish(data []byte, end bool) {
+	msg := nats.NewMsg(p.subject)
+	msg.Header.Set(kLogAttemptHeader, p.attempt)
+	if end {
+		msg.Header.Set(kLogEndHeader, "true")
+	}
+	msg.Data = data
+	_ = p.nc.PublishMsg(msg)
+}
+
+func (p *logPublisher) Close() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.closed {
+		return nil
+	}
+	p.flush()
+	p.publish(nil, true)
+	p.closed = true
+	return p.nc.Flush()
+}
+
+// FollowJobLog writes the log of a job attempt as it is published, starting from the oldest output retained, until
+// the attempt ends or the context is cancelled. If the job record shows the attempt is over but the end of its log
+// never arrives (e.g. the worker died), it returns shortly after.
+func (c *Client) FollowJobLog(ctx context.Context, jobId string, attempt uint, w io.Writer) error {
+	if _, err := c.js.StreamInfo(c.options.logsStreamName); errors.Is(err, nats.ErrStreamNotFound) {
+		return fmt.Errorf("stream not found: %s (need to run init-schema?)", c.options.logsStreamName)
+	} else if err != nil {
+		return err
+	}
+
+	msgCh := make(chan *nats.Msg, 64)
+	sub, err := c.js.ChanSubscribe(c.jobLogSubject(jobId), msgCh, nats.OrderedConsumer(), nats.DeliverAll())
+	if err != nil {
+		return fmt.Errorf("failed to subscribe to job log: %w", err)
+	}
+	defer func() { _ = sub.Unsubscribe() }()
+
+	attemptHeader := strconv.FormatUint(uint64(attempt), 10)
+	ticker := time.NewTicker(kLogFollowCheckInterval)
+	defer ticker.Stop()
+	attemptOver := false
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+			if attemptOver {
+				return nil
+			} else if c.jobsRepository == nil {
+				continue
+			}
+			// Give the end of the log one more interval to arrive
+			if job, _, err := c.LoadJob(jobId); err == nil {
+				attemptOver = job.IsCompleted() || job.CurrentAttempt() != attempt
+			}
+		case msg := <-msgCh:
+			if msg.Header.Get(kLogAttemptHeader) != attemptHeader {
+				continue
+			} else if msg.Header.Get(kLogEndHeader) != "" {
+				return nil
+			}
+			if _, err := w.Write(msg.Data); err != nil {
+				return err
+			}
+		}
+	}
+}
@@ -0,0 +1,93 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	server "github.com/nats-io/nats-server/v2/test"
+)
+
+func TestJobLog(t *testing.T) {
+
+	opts := server.DefaultTestOptions
+	opts.Port = -1
+	opts.JetStream = true
+	opts.StoreDir = t.TempDir()
+
+	s := server.RunServer(&opts)
+	defer s.Shutdown()
+
+	client, err := NewClient(s.ClientURL(), "", "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	if err := client.FollowJobLog(ctx, "job-1", 1, io.Discard); err == nil {
+		t.Fatalf("Expected error following log before the logs stream is created")
+	}
+
+	if err := client.CreateLogsStream(); err != nil {
+		t.Fatal(err)
+	}
+	// Creating it again is a no-op
+	if err := client.CreateLogsStream(); err != nil {
+		t.Fatal(err)
+	}
+
+	// First attempt, completed before following starts
+	firstAttemptLog := client.PublishJobLog("job-1", 1)
+	_, _ = io.WriteString(firstAttemptLog, "first attempt\n")
+	if err := firstAttemptLog.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Second attempt, followed while it runs
+	secondAttemptLog := client.PublishJobLog("job-1", 2)
+	_, _ = io.WriteString(secondAttemptLog, "checkout\n")
+
+	followed := make(chan string, 1)
+	go func() {
+		var buf bytes.Buffer
+		if err := client.FollowJobLog(ctx, "job-1", 2, &buf); err != nil {
+			t.Errorf("Follow error: %v", err)
+		}
+		followed <- buf.String()
+	}()
+
+	// Larger than a message, sent in several chunks
+	largeOutput := strings.Repeat("x", 2*kLogChunkMaxSize+1) + "\n"
+	_, _ = io.WriteString(secondAttemptLog, largeOutput)
+	_, _ = io.WriteString(secondAttemptLog, "benchmark\n")
+	otherJobLog := client.PublishJobLog("job-2", 2)
+	_, _ = io.WriteString(otherJobLog, "other job\n")
+	if err := secondAttemptLog.Close(); err != nil {
+		t.Fatal(err)
+	}
+	// Output after close is dropped
+	_, _ = io.WriteString(secondAttemptLog, "late\n")
+
+	select {
+	case log := <-followed:
+		if expected := "checkout\n" + largeOutput + "benchmark\n"; log != expected {
+			t.Fatalf("Unexpected log (%d bytes, expected %d)", len(log), len(expected))
+		}
+	case <-ctx.Done():
+		t.Fatalf("Follow did not return at the end of the attempt")
+	}
+
+	// Following stops when the context is cancelled, if the attempt never ends
+	_ = otherJobLog.Close()
+	shortCtx, shortCancel := context.WithTimeout(ctx, 100*time.Millisecond)
+	defer shortCancel()
+	if err := client.FollowJobLog(shortCtx, "job-3", 1, io.Discard); err != context.DeadlineExceeded {
+		t.Fatalf("Expected deadline exceeded, got: %v", err)
+	}
+}
@@ -0,0 +1,198 @@
+package client
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/synadia-labs/go-bench-away/v1/core"
+
+	"github.com/nats-io/nats.go"
+)
+
+// Time allowed to read each message of the jobs queue while pruning
+const kPruneReadTimeout = 10 * time.Second
+
+// PruneJobs applies the retention policy to the jobs in the repository, and returns the decisions taken.
+// Jobs deleted have their artifacts, queue messages and record deleted, in this order, so a prune interrupted midway
+// is completed by the next one. Jobs kept without their logs have their artifacts other than results deleted, and
+// their record updated. With dryRun, decisions are returned but nothing is deleted.
+func (c *Client) PruneJobs(policy core.RetentionPolicy, dryRun bool) ([]core.PruneDecision, error) {
+	jobs, err := c.loadAllJobs()
+	if err != nil {
+		return nil, err
+	}
+
+	decisions := policy.Plan(jobs, time.Now())
+	if dryRun || len(decisions) == 0 {
+		return decisions, nil
+	}
+
+	jobMessages, err := c.jobMessages()
+	if err != nil {
+		return nil, err
+	}
+	jobArtifacts, err := c.jobArtifacts()
+	if err != nil {
+		return nil, err
+	}
+
+	pruned := make([]core.PruneDecision, 0, len(decisions))
+	for _, decision := range decisions {
+		var err error
+		switch decision.Action {
+		case core.PruneJob:
+			err = c.deleteJob(decision.Job.Id, jobArtifacts[decision.Job.Id], jobMessages[decision.Job.Id])
+		case core.PruneLogs:
+			err = c.deleteJobLogs(decision.Job.Id, jobArtifacts[decision.Job.Id])
+		}
+		if err != nil {
+			fmt.Printf("  Failed to prune %s: %v\n", decision.Job.Id, err)
+			continue
+		}
+		pruned = append(pruned, decision)
+	}
+
+	// Remove the markers left by deleted records (those older than the default threshold)
+	if err := c.jobsRepository.PurgeDeletes(); err != nil {
+		c.logWarn("Failed to purge deleted job records: %v", err)
+	}
+
+	return pruned, nil
+}
+
+// Load all job records from the repository
+func (c *Client) loadAllJobs() ([]*core.JobRecord, error) {
+	watcher, err := c.jobsRepository.WatchAll()
+	if err != nil {
+		return nil, fmt.Errorf("failed to watch KV: %v", err)
+	}
+	defer func() { _ = watcher.Stop() }()
+
+	jobs := []*core.JobRecord{}
+	for entry := range watcher.Updates() {
+		if entry == nil {
+			break
+		}
+		if entry.Operation() != nats.KeyValuePut {
+			continue
+		}
+		job, err := core.LoadJob(entry.Value())
+		if err != nil {
+			continue
+		}
+		jobs = append(jobs, job)
+	}
+	return jobs, nil
+}
+
+// Sequence numbers of the messages of each job in the jobs queue stream (there may be several, e.g. jobs requeued
+// by fail-stale in earlier versions), read with a single ordered consumer delivering headers only
+func (c *Client) jobMessages() (map[string][]uint64, error) {
+	sInfo, err := c.js.StreamInfo(c.options.jobsQueueStreamName)
+	if err != nil {
+		return nil, err
+	}
+
+	jobMessages := map[string][]uint64{}
+	if sInfo.State.Msgs == 0 {
+		return jobMessages, nil
+	}
+
+	sub, err := c.js.SubscribeSync(
+		"",
+		nats.BindStream(c.options.jobsQueueStreamName),
+		nats.OrderedConsumer(),
+		nats.HeadersOnly(),
+		nats.DeliverAll(),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to subscribe to jobs queue: %w", err)
+	}
+	defer func() { _ = sub.Unsubscribe() }()
+
+	for {
+		msg, err := sub.NextMsg(kPruneReadTimeout)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read jobs queue: %w", err)
+		}
+		meta, err := msg.Metadata()
+		if err != nil {
+			return nil, err
+		}
+		if jobId := msg.Header.Get(kJobIdHeader); jobId != "" {
+			jobMessages[jobId] = append(jobMessages[jobId], meta.Sequence.Stream)
+		}
+		if meta.NumPending == 0 {
+			return jobMessages, nil
+		}
+	}
+}
+
+// Objects in the artifacts store of each job, listing the store once.
+// Artifacts uploaded by older versions have no metadata: their job is taken from their key.
+func (c *Client) jobArtifacts() (map[string][]*nats.ObjectInfo, error) {
+	objects, err := c.artifactsStore.List()
+	if errors.Is(err, nats.ErrNoObjectsFound) {
+		return map[string][]*nats.ObjectInfo{}, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to list artifacts: %w", err)
+	}
+
+	jobArtifacts := map[string][]*nats.ObjectInfo{}
+	for _, object := range objects {
+		jobId := object.Metadata[kArtifactJobIdMetadata]
+		if jobId == "" {
+			// Key is jobs/<id>/<name>
+			if parts := strings.Split(object.Name, "/"); len(parts) == 3 {
+				jobId = parts[1]
+			}
+		}
+		if jobId != "" {
+			jobArtifacts[jobId] = append(jobArtifacts[jobId], object)
+		}
+	}
+	return jobArtifacts, nil
+}
+
+// Delete the artifacts, queue messages and record of a job
+func (c *Client) deleteJob(jobId string, artifacts []*nats.ObjectInfo, messages []uint64) error {
+	for _, object := range artifacts {
+		if err := c.artifactsStore.Delete(object.Name); err != nil && !errors.Is(err, nats.ErrObjectNotFound) {
+			return fmt.Errorf("failed to delete artifact '%s': %w", object.Name, err)
+		}
+	}
+	for _, seq := range messages {
+		err := c.js.DeleteMsg(c.options.jobsQueueStreamName, seq)
+		if err != nil && err != nats.ErrMsgNotFound {
+			return fmt.Errorf("failed to delete queue message %d: %w", seq, err)
+		}
+	}
+	if err := c.jobsRepository.Purge(fmt.Sprintf(kJobRecordKeyTmpl, jobId)); err != nil {
+		return fmt.Errorf("failed to delete job record: %w", err)
+	}
+	return nil
+}
+
+// Delete the artifacts of a job other than results, and their references from the job record
+func (c *Client) deleteJobLogs(jobId string, artifacts []*nats.ObjectInfo) error {
+	for _, object := range artifacts {
+		if artifactInfo(object).Name == core.ResultsArtifact {
+			continue
+		}
+		if err := c.artifactsStore.Delete(object.Name); err != nil && !errors.Is(err, nats.ErrObjectNotFound) {
+			return fmt.Errorf("failed to delete artifact '%s': %w", object.Name, err)
+		}
+	}
+
+	job, revision, err := c.LoadJob(jobId)
+	if err != nil {
+		return err
+	}
+	job.RemoveLogs()
+	if _, err := c.UpdateJob(job, revision); err != nil {
+		return fmt.Errorf("failed to update job record: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,165 @@
+package client
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	server "github.com/nats-io/nats-server/v2/test"
+	"github.com/nats-io/nats.go"
+	"github.com/synadia-labs/go-bench-away/v1/core"
+)
+
+func TestPruneJobs(t *testing.T) {
+
+	opts := server.DefaultTestOptions
+	opts.Port = -1
+	opts.JetStream = true
+	opts.StoreDir = t.TempDir()
+
+	s := server.RunServer(&opts)
+	defer s.Shutdown()
+
+	bareClient, err := NewClient(s.ClientURL(), "", "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer bareClient.Close()
+
+	if err := bareClient.CreateJobsQueue(); err != nil {
+		t.Fatal(err)
+	}
+	if err := bareClient.CreateJobsRepository(); err != nil {
+		t.Fatal(err)
+	}
+	if err := bareClient.CreateArtifactsStore(); err != nil {
+		t.Fatal(err)
+	}
+
+	client, err := NewClient(s.ClientURL(), "", "test", InitJobsQueue(), InitJobsRepository(), InitArtifactsStore())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	artifactPath := filepath.Join(t.TempDir(), "artifact")
+	if err := os.WriteFile(artifactPath, []byte("artifact"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	// Jobs succeeded the given number of days ago, with log and results
+	completeJob := func(params core.JobParameters, daysAgo int) string {
+		job, err := client.SubmitJob(params)
+		if err != nil {
+			t.Fatal(err)
+		}
+		job, revision, err := client.LoadJob(job.Id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if job.Log, err = client.UploadLogArtifact(job.Id, 1, artifactPath); err != nil {
+			t.Fatal(err)
+		}
+		if job.Results, err = client.UploadResultsArtifact(job.Id, artifactPath); err != nil {
+			t.Fatal(err)
+		}
+		job.SetFinalStatus(core.Succeeded)
+		job.Completed = time.Now().Add(-time.Duration(daysAgo) * 24 * time.Hour)
+		if _, err := client.UpdateJob(job, revision); err != nil {
+			t.Fatal(err)
+		}
+		return job.Id
+	}
+
+	oldJobId := completeJob(core.JobParameters{}, 40)
+	oldLabeledJobId := completeJob(core.JobParameters{Labels: core.Labels{"release": "v1"}}, 40)
+	recentJobId := completeJob(core.JobParameters{}, 10)
+	newJobId := completeJob(core.JobParameters{}, 1)
+
+	// Artifacts of the old job not referenced by its record, one uploaded by an older version (without metadata)
+	if _, err := client.UploadArtifact(oldJobId, "cpu.pprof", artifactPath, core.BinaryContentType); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.artifactsStore.PutString(fmt.Sprintf(kArtifactKeyTmpl, oldJobId, "legacy.txt"), "legacy"); err != nil {
+		t.Fatal(err)
+	}
+
+	keepLabels, err := core.ParseLabelSelector("release")
+	if err != nil {
+		t.Fatal(err)
+	}
+	policy := core.RetentionPolicy{
+		MaxAge:     30 * 24 * time.Hour,
+		KeepLabels: keepLabels,
+		LogsMaxAge: 7 * 24 * time.Hour,
+	}
+
+	// Dry run leaves everything in place
+	decisions, err := client.PruneJobs(policy, true)
+	if err != nil {
+		t.Fatal(err)
+	} else if len(decisions) != 2 {
+		t.Fatalf("Unexpected decisions: %+v", decisions)
+	}
+	if artifacts, err := client.ListArtifacts(oldJobId); err != nil || len(artifacts) != 2 {
+		t.Fatalf("Unexpected artifacts after dry run: %+v (%v)", artifacts, err)
+	}
+
+	decisions, err = client.PruneJobs(policy, false)
+	if err != nil {
+		t.Fatal(err)
+	} else if len(decisions) != 2 ||
+		decisions[0].Job.Id != oldJobId || decisions[0].Action != core.PruneJob ||
+		decisions[1].Job.Id != recentJobId || decisions[1].Action != core.PruneLogs {
+		t.Fatalf("Unexpected decisions: %+v", decisions)
+	}
+
+	// Record, queue message and artifacts of the old job are deleted
+	if _, _, err := client.LoadJob(oldJobId); err == nil {
+		t.Fatalf("Expected error loading deleted job")
+	}
+	for _, name := range []string{core.LogArtifact, core.ResultsArtifact, "cpu.pprof", "legacy.txt"} {
+		if _, err := client.artifactsStore.GetInfo(fmt.Sprintf(kArtifactKeyTmpl, oldJobId, name)); err != nats.ErrObjectNotFound {
+			t.Fatalf("Unexpected artifact %s of deleted job (%v)", name, err)
+		}
+	}
+	recentJobs, err := client.LoadRecentJobs(0, 0)
+	if err != nil {
+		t.Fatal(err)
+	} else if len(recentJobs) != 3 {
+		t.Fatalf("Unexpected jobs in queue: %d", len(recentJobs))
+	}
+	for _, job := range recentJobs {
+		if job.Id == oldJobId {
+			t.Fatalf("Deleted job still listed")
+		}
+	}
+
+	// The recent job keeps its results only
+	recentJob, _, err := client.LoadJob(recentJobId)
+	if err != nil {
+		t.Fatal(err)
+	} else if recentJob.Log != "" || recentJob.Results == "" {
+		t.Fatalf("Unexpected job after deleting logs: %+v", recentJob)
+	}
+	if artifacts, err := client.ListArtifacts(recentJobId); err != nil ||
+		len(artifacts) != 1 || artifacts[0].Name != core.ResultsArtifact {
+		t.Fatalf("Unexpected artifacts after deleting logs: %+v (%v)", artifacts, err)
+	}
+
+	// Other jobs are untouched
+	for _, jobId := range []string{oldLabeledJobId, newJobId} {
+		if artifacts, err := client.ListArtifacts(jobId); err != nil || len(artifacts) != 2 {
+			t.Fatalf("Unexpected artifacts of job %s: %+v (%v)", jobId, artifacts, err)
+		}
+	}
+
+	// Nothing left to prune
+	if decisions, err := client.PruneJobs(policy, false); err != nil {
+		t.Fatal(err)
+	} else if len(decisions) != 0 {
+		t.Fatalf("Unexpected decisions: %+v", decisions)
+	}
+}
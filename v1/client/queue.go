@@ -11,13 +11,54 @@ import (
 	"github.com/nats-io/nats.go"
 )
 
+// How long to wait for a worker to acknowledge a control request (e.g. job cancellation)
+const kControlRequestTimeout = 5 * time.Second
+
+// StaleHeartbeatThreshold is the age of the last heartbeat of a running job past which its worker is presumed lost
+// (the fail-stale default)
+const StaleHeartbeatThreshold = 5 * time.Minute
+
 func (c *Client) QueueName() string {
 	return c.options.jobsQueueName
 }
 
+// Subject where jobs of the given priority are published
+func (c *Client) jobsSubmitSubject(priority core.JobPriority) string {
+	if priority == core.NormalPriority {
+		return c.options.jobsSubmitSubject
+	}
+	return fmt.Sprintf("%s.%s", c.options.jobsSubmitSubject, priority)
+}
+
 func (c *Client) SubmitJob(params core.JobParameters) (*core.JobRecord, error) {
+	return c.SubmitJobAfter(params, nil, core.CancelOnDependencyFailure)
+}
+
+// SubmitJobAfter submits a job that is not dispatched until all the jobs it depends on have completed.
+// The policy determines what happens to the job if any of the dependencies does not succeed.
+func (c *Client) SubmitJobAfter(
+	params core.JobParameters,
+	dependsOn []string,
+	policy core.DependencyPolicy,
+) (*core.JobRecord, error) {
+
+	if params.Priority < core.LowPriority || params.Priority > core.UrgentPriority {
+		return nil, fmt.Errorf("Invalid job priority: %d", params.Priority)
+	}
+
+	if policy < core.CancelOnDependencyFailure || policy > core.RunOnDependencyFailure {
+		return nil, fmt.Errorf("Invalid dependency policy: %d", policy)
+	}
+
+	for _, dependencyId := range dependsOn {
+		if _, _, err := c.LoadJob(dependencyId); err != nil {
+			return nil, fmt.Errorf("Invalid dependency: %v", err)
+		}
+	}
 
 	job := core.NewJob(params)
+	job.DependsOn = dependsOn
+	job.DependencyPolicy = policy
 
 	jobRecordKey := fmt.Sprintf(kJobRecordKeyTmpl, job.Id)
 	_, err := c.jobsRepository.Create(jobRecordKey, job.Bytes())
@@ -25,18 +66,25 @@ func (c *Client) SubmitJob(params core.JobParameters) (*core.JobRecord, error) {
 		return nil, fmt.Errorf("Failed to create job record: %v", err)
 	}
 
-	submitMsg := nats.NewMsg(c.options.jobsSubmitSubject)
-	submitMsg.Header.Add(kJobIdHeader, job.Id)
-	submitMsg.Header.Add(nats.MsgIdHdr, job.Id)
-
-	_, pubErr := c.js.PublishMsg(submitMsg)
-	if pubErr != nil {
-		return nil, fmt.Errorf("Failed to submit job: %v", pubErr)
+	if err := c.publishJob(job); err != nil {
+		return nil, fmt.Errorf("Failed to submit job: %v", err)
 	}
 
 	return job, nil
 }
 
+// Publish a message to the queue, so the job is dispatched to a worker
+func (c *Client) publishJob(job *core.JobRecord) error {
+	submitMsg := nats.NewMsg(c.jobsSubmitSubject(job.Parameters.Priority))
+	submitMsg.Header.Add(kJobIdHeader, job.Id)
+	submitMsg.Header.Add(nats.MsgIdHdr, job.Id)
+
+	_, err := c.js.PublishMsg(submitMsg)
+	return err
+}
+
+// CancelJob cancels a job waiting in the queue, or asks the worker running it to stop it.
+// In the latter case, the job is marked Cancelled by the worker, shortly after this returns.
 func (c *Client) CancelJob(jobId string) error {
 
 	jobRecord, revision, err := c.LoadJob(jobId)
@@ -44,19 +92,75 @@ func (c *Client) CancelJob(jobId string) error {
 		return err
 	}
 
-	if jobRecord.Status != core.Submitted {
+	switch jobRecord.Status {
+	case core.Submitted:
+		jobRecord.SetFinalStatus(core.Cancelled)
+		_, err = c.UpdateJobWithNote(jobRecord, revision, fmt.Sprintf("Cancelled by %s", c.options.actor))
+		return err
+
+	case core.Running:
+		return c.requestCancel(jobRecord)
+
+	default:
 		return fmt.Errorf("cannot cancel job in state %s", jobRecord.Status.String())
 	}
+}
 
-	jobRecord.SetFinalStatus(core.Cancelled)
+// Subject where cancellation requests for a running job are sent
+func (c *Client) jobCancelSubject(jobId string) string {
+	return fmt.Sprintf(kJobCancelSubjectTmpl, c.options.namespace, jobId)
+}
 
-	_, err = c.UpdateJob(jobRecord, revision)
-	if err != nil {
-		return err
+// Ask the worker running the job to stop it, the request carries the name of who is cancelling
+func (c *Client) requestCancel(job *core.JobRecord) error {
+	_, err := c.nc.Request(c.jobCancelSubject(job.Id), []byte(c.options.actor), kControlRequestTimeout)
+	if err == nats.ErrNoResponders && job.IsStale(StaleHeartbeatThreshold) {
+		return fmt.Errorf(
+			"no worker is running job %s, last heartbeat %s ago (need to run fail-stale?)",
+			job.Id,
+			time.Since(job.Heartbeat).Truncate(time.Second),
+		)
+	} else if err == nats.ErrNoResponders {
+		// Worker just picked up or completed the job, or does not accept cancellation requests (older version)
+		return fmt.Errorf("the worker running job %s is not accepting cancellation requests, try again later", job.Id)
+	} else if err != nil {
+		return fmt.Errorf("failed to request cancellation of job %s: %v", job.Id, err)
 	}
 	return nil
 }
 
+// OnCancelRequest invokes the callback (with the name of who is cancelling) when cancellation of the given running
+// job is requested. Returns a function to stop listening.
+func (c *Client) OnCancelRequest(jobId string, callback func(string)) (func(), error) {
+	return c.onControlRequest(c.jobCancelSubject(jobId), callback)
+}
+
+// Invoke the callback (with the name of the requester) for each request received on the given control subject,
+// and respond once it returns. Returns a function to stop listening.
+func (c *Client) onControlRequest(subject string, callback func(string)) (func(), error) {
+	sub, err := c.nc.Subscribe(subject, func(msg *nats.Msg) {
+		callback(string(msg.Data))
+		if err := msg.Respond(nil); err != nil {
+			c.logWarn("Failed to respond to control request: %v", err)
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// Make sure the subscription is registered with the server before returning
+	if err := c.nc.Flush(); err != nil {
+		_ = sub.Unsubscribe()
+		return nil, err
+	}
+
+	return func() {
+		if err := sub.Unsubscribe(); err != nil {
+			c.logWarn("Failed to unsubscribe: %v", err)
+		}
+	}, nil
+}
+
 func (c *Client) LoadRecentJobs(limit, offset int) ([]*core.JobRecord, error) {
 	return c.LoadJobs(limit, offset, false)
 }
@@ -382,7 +486,13 @@ func (c *Client) CountJobsByStatus() (map[core.JobStatus]int, error) {
 	return counts, nil
 }
 
-func (c *Client) LoadJobsByKV(limit, offset int, statuses []core.JobStatus) ([]*core.JobRecord, map[core.JobStatus]int, error) {
+// LoadJobsByKV loads the most recent jobs matching both the given statuses and label selector.
+// The returned counts are per-status, for all jobs matching the label selector.
+func (c *Client) LoadJobsByKV(
+	limit, offset int,
+	statuses []core.JobStatus,
+	selector core.LabelSelector,
+) ([]*core.JobRecord, map[core.JobStatus]int, error) {
 	watcher, err := c.jobsRepository.WatchAll()
 	if err != nil {
 		return nil, nil, fmt.Errorf("failed to watch KV: %v", err)
@@ -408,6 +518,9 @@ func (c *Client) LoadJobsByKV(limit, offset int, statuses []core.JobStatus) ([]*
 		if err != nil {
 			continue
 		}
+		if !selector.Matches(job.Parameters.Labels) {
+			continue
+		}
 		counts[job.Status]++
 		if len(statusSet) == 0 || statusSet[job.Status] {
 			matched = append(matched, job)
@@ -429,7 +542,16 @@ func (c *Client) LoadJobsByKV(limit, offset int, statuses []core.JobStatus) ([]*
 	return matched, counts, nil
 }
 
-func (c *Client) FailStaleJobs() (int, error) {
+// Whether the worker running the job is still sending heartbeats
+func isAlive(job *core.JobRecord, heartbeatTimeout time.Duration) bool {
+	return !job.Heartbeat.IsZero() && !job.IsStale(heartbeatTimeout)
+}
+
+// FailStaleJobs marks Running jobs that are past their timeout as TimedOut, and jobs whose worker did not send a
+// heartbeat for longer than heartbeatTimeout as Failed (or requeues them, if their retry policy allows it).
+// Jobs past their timeout but still sending heartbeats are left to their worker, which enforces the timeout itself
+// (allowing a grace period). Jobs of workers that do not send heartbeats are timed out by this.
+func (c *Client) FailStaleJobs(heartbeatTimeout time.Duration) (int, error) {
 	watcher, err := c.jobsRepository.WatchAll()
 	if err != nil {
 		return 0, fmt.Errorf("failed to watch KV: %v", err)
@@ -443,6 +565,7 @@ func (c *Client) FailStaleJobs() (int, error) {
 	}
 
 	var staleJobs []staleJob
+	var lostJobs []string
 	var skippedActive int
 	for entry := range watcher.Updates() {
 		if entry == nil {
@@ -459,19 +582,23 @@ func (c *Client) FailStaleJobs() (int, error) {
 			continue
 		}
 		runtime := time.Since(job.Started)
-		if runtime > job.Parameters.Timeout {
+		if isAlive(job, heartbeatTimeout) {
+			skippedActive++
+		} else if job.Parameters.Timeout > 0 && runtime > job.Parameters.Timeout {
 			staleJobs = append(staleJobs, staleJob{
 				id:      job.Id,
 				runtime: runtime,
 				timeout: job.Parameters.Timeout,
 			})
+		} else if job.IsStale(heartbeatTimeout) {
+			lostJobs = append(lostJobs, job.Id)
 		} else {
 			skippedActive++
 		}
 	}
 
-	fmt.Printf("Found %d running jobs exceeding timeout, %d still within timeout\n",
-		len(staleJobs), skippedActive)
+	fmt.Printf("Found %d stale running jobs exceeding timeout, %d without heartbeat for %s, %d still active\n",
+		len(staleJobs), len(lostJobs), heartbeatTimeout, skippedActive)
 
 	updated := 0
 	for _, sj := range staleJobs {
@@ -480,12 +607,17 @@ func (c *Client) FailStaleJobs() (int, error) {
 			fmt.Printf("  Skip %s: %v\n", sj.id, err)
 			continue
 		}
-		if job.Status != core.Running {
+		if job.Status != core.Running || isAlive(job, heartbeatTimeout) {
 			continue
 		}
 		fmt.Printf("  Failing %s (ran %s, timeout %s)\n",
 			sj.id, sj.runtime.Truncate(time.Minute), sj.timeout)
-		job.SetFinalStatus(core.Failed)
+		job.SetTimedOutStatus(
+			core.StaleFailure,
+			"Found running for %s, past its timeout of %s",
+			sj.runtime.Truncate(time.Minute),
+			sj.timeout,
+		)
 		_, err = c.UpdateJob(job, revision)
 		if err != nil {
 			fmt.Printf("  Failed to update %s: %v\n", sj.id, err)
@@ -493,9 +625,49 @@ func (c *Client) FailStaleJobs() (int, error) {
 		}
 		updated++
 	}
+
+	for _, jobId := range lostJobs {
+		job, revision, err := c.LoadJob(jobId)
+		if err != nil {
+			fmt.Printf("  Skip %s: %v\n", jobId, err)
+			continue
+		}
+		if !job.IsStale(heartbeatTimeout) {
+			continue
+		}
+		lastHeartbeat := time.Since(job.Heartbeat).Truncate(time.Second)
+		job.SetFailedStatus(
+			core.LostWorkerFailure,
+			"No heartbeat from worker %s for %s",
+			job.WorkerInfo.Hostname,
+			lastHeartbeat,
+		)
+		if job.ShouldRetry() {
+			fmt.Printf("  Requeueing %s (last heartbeat %s ago)\n", jobId, lastHeartbeat)
+			if err := c.requeueJob(job, revision); err != nil {
+				fmt.Printf("  Failed to requeue %s: %v\n", jobId, err)
+				continue
+			}
+		} else {
+			fmt.Printf("  Failing %s (last heartbeat %s ago)\n", jobId, lastHeartbeat)
+			if _, err := c.UpdateJob(job, revision); err != nil {
+				fmt.Printf("  Failed to update %s: %v\n", jobId, err)
+				continue
+			}
+		}
+		updated++
+	}
 	return updated, nil
 }
 
+// Reset a failed job for another attempt. Like jobs requeued by workers, it is dispatched again when its queue
+// message, left unacknowledged by the lost worker, is redelivered.
+func (c *Client) requeueJob(job *core.JobRecord, revision uint64) error {
+	note := job.Requeue()
+	_, err := c.UpdateJobWithNote(job, revision, note)
+	return err
+}
+
 func containsIgnoreCase(s, substr string) bool {
 	return strings.Contains(strings.ToLower(s), strings.ToLower(substr))
 }
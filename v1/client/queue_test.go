@@ -3,10 +3,14 @@ package client
 import (
 	"context"
 	"errors"
+	"fmt"
+	"reflect"
+	"strings"
 	"testing"
 	"time"
 
 	server "github.com/nats-io/nats-server/v2/test"
+	"github.com/nats-io/nats.go"
 	"github.com/synadia-labs/go-bench-away/v1/core"
 )
 
@@ -162,3 +166,796 @@ func TestSubmit(t *testing.T) {
 		}
 	}
 }
+
+func TestDispatchByPriority(t *testing.T) {
+
+	opts := server.DefaultTestOptions
+	opts.Port = -1
+	opts.JetStream = true
+	opts.StoreDir = t.TempDir()
+
+	s := server.RunServer(&opts)
+	defer s.Shutdown()
+
+	bareClient, err := NewClient(s.ClientURL(), "", "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer bareClient.Close()
+
+	if err := bareClient.CreateJobsQueue(); err != nil {
+		t.Fatal(err)
+	}
+	if err := bareClient.CreateJobsRepository(); err != nil {
+		t.Fatal(err)
+	}
+
+	client, err := NewClient(s.ClientURL(), "", "test", InitJobsQueue(), InitJobsRepository())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	// Submit in the opposite order of the expected dispatch order
+	submitOrder := []core.JobPriority{
+		core.LowPriority,
+		core.NormalPriority,
+		core.HighPriority,
+		core.NormalPriority,
+		core.UrgentPriority,
+	}
+	expectedOrder := []core.JobPriority{
+		core.UrgentPriority,
+		core.HighPriority,
+		core.NormalPriority,
+		core.NormalPriority,
+		core.LowPriority,
+	}
+
+	jobIds := map[string]core.JobPriority{}
+	for _, priority := range submitOrder {
+		job, err := client.SubmitJob(core.JobParameters{
+			GitRemote: "https://github.com/synadia-labs/go-bench-away.git",
+			GitRef:    "main",
+			Priority:  priority,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		jobIds[job.Id] = priority
+	}
+
+	if _, err := client.SubmitJob(core.JobParameters{Priority: core.UrgentPriority + 1}); err == nil {
+		t.Fatalf("Expected error submitting job with invalid priority")
+	}
+
+	var dispatched []core.JobPriority
+	ctx, cancel := context.WithCancel(context.Background())
+	err = client.DispatchJobs(
+		ctx,
+		func(record *core.JobRecord, revision uint64) (bool, error) {
+			dispatched = append(dispatched, jobIds[record.Id])
+			record.SetFinalStatus(core.Succeeded)
+			if _, err := client.UpdateJob(record, revision); err != nil {
+				t.Fatal(err)
+			}
+			if len(dispatched) == len(expectedOrder) {
+				cancel()
+			}
+			return false, nil
+		},
+	)
+	if err != nil && !errors.Is(err, context.Canceled) {
+		t.Fatal(err)
+	}
+
+	for i, priority := range expectedOrder {
+		if dispatched[i] != priority {
+			t.Fatalf("Unexpected dispatch order: %v (expected: %v)", dispatched, expectedOrder)
+		}
+	}
+}
+
+func TestDispatchDuplicateDelivery(t *testing.T) {
+
+	opts := server.DefaultTestOptions
+	opts.Port = -1
+	opts.JetStream = true
+	opts.StoreDir = t.TempDir()
+
+	s := server.RunServer(&opts)
+	defer s.Shutdown()
+
+	bareClient, err := NewClient(s.ClientURL(), "", "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer bareClient.Close()
+
+	if err := bareClient.CreateJobsQueue(); err != nil {
+		t.Fatal(err)
+	}
+	if err := bareClient.CreateJobsRepository(); err != nil {
+		t.Fatal(err)
+	}
+
+	client, err := NewClient(s.ClientURL(), "", "test", InitJobsQueue(), InitJobsRepository())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	// Consumer created by a previous version, with default settings
+	streamName := client.options.jobsQueueStreamName
+	consumerName := fmt.Sprintf(kJobsConsumerNameTmpl, client.options.namespace, core.NormalPriority)
+	_, err = client.js.AddConsumer(streamName, &nats.ConsumerConfig{
+		Durable:       consumerName,
+		FilterSubject: client.jobsSubmitSubject(core.NormalPriority),
+		AckPolicy:     nats.AckExplicitPolicy,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	job, err := client.SubmitJob(core.JobParameters{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	err = client.DispatchJobs(
+		ctx,
+		func(record *core.JobRecord, revision uint64) (bool, error) {
+			// Another worker claims the job first, so this one fails to and asks for a requeue
+			other := *record
+			other.SetRunningStatus()
+			if _, err := client.UpdateJob(&other, revision); err != nil {
+				t.Fatal(err)
+			}
+			cancel()
+			return true, fmt.Errorf("failed to claim job %s", record.Id)
+		},
+	)
+	if err != nil && !errors.Is(err, context.Canceled) {
+		t.Fatal(err)
+	}
+
+	// Message is acknowledged rather than redelivered, and consumer settings are upgraded
+	for i := 0; ; i++ {
+		info, err := client.js.ConsumerInfo(streamName, consumerName)
+		if err != nil {
+			t.Fatal(err)
+		} else if info.Config.AckWait != kJobAckWait || info.Config.MaxDeliver != -1 {
+			t.Fatalf("Unexpected consumer config: %+v", info.Config)
+		} else if info.NumAckPending == 0 {
+			break
+		} else if i == 100 {
+			t.Fatalf("Job %s message not acknowledged", job.Id)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestLegacyConsumerMigration(t *testing.T) {
+
+	opts := server.DefaultTestOptions
+	opts.Port = -1
+	opts.JetStream = true
+	opts.StoreDir = t.TempDir()
+
+	s := server.RunServer(&opts)
+	defer s.Shutdown()
+
+	bareClient, err := NewClient(s.ClientURL(), "", "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer bareClient.Close()
+
+	if err := bareClient.CreateJobsQueue(); err != nil {
+		t.Fatal(err)
+	}
+	if err := bareClient.CreateJobsRepository(); err != nil {
+		t.Fatal(err)
+	}
+
+	client, err := NewClient(s.ClientURL(), "", "test", InitJobsQueue(), InitJobsRepository())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	var jobIds []string
+	for i := 0; i < 3; i++ {
+		job, err := client.SubmitJob(core.JobParameters{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		jobIds = append(jobIds, job.Id)
+	}
+
+	// Consumer of a version without priorities, which processed the first job
+	streamName := client.options.jobsQueueStreamName
+	legacyConsumerName := fmt.Sprintf(kLegacyConsumerNameTmpl, client.options.namespace)
+	_, err = client.js.AddConsumer(streamName, &nats.ConsumerConfig{
+		Durable:   legacyConsumerName,
+		AckPolicy: nats.AckExplicitPolicy,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sub, err := client.js.PullSubscribe("", legacyConsumerName, nats.Bind(streamName, legacyConsumerName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	msgs, err := sub.Fetch(1)
+	if err != nil {
+		t.Fatal(err)
+	} else if err := msgs[0].AckSync(); err != nil {
+		t.Fatal(err)
+	}
+	if err := sub.Unsubscribe(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Init again replaces it, new consumers start after the job processed
+	if err := bareClient.CreateJobsQueue(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.js.ConsumerInfo(streamName, legacyConsumerName); err != nats.ErrConsumerNotFound {
+		t.Fatalf("Expected legacy consumer deleted: %v", err)
+	}
+	consumerName := fmt.Sprintf(kJobsConsumerNameTmpl, client.options.namespace, core.NormalPriority)
+	if info, err := client.js.ConsumerInfo(streamName, consumerName); err != nil {
+		t.Fatal(err)
+	} else if info.NumPending+uint64(info.NumAckPending) != 2 {
+		t.Fatalf("Unexpected pending jobs: %+v", info)
+	}
+
+	var dispatched []string
+	ctx, cancel := context.WithCancel(context.Background())
+	err = client.DispatchJobs(
+		ctx,
+		func(record *core.JobRecord, revision uint64) (bool, error) {
+			dispatched = append(dispatched, record.Id)
+			if len(dispatched) == 2 {
+				cancel()
+			}
+			return false, nil
+		},
+	)
+	if err != nil && !errors.Is(err, context.Canceled) {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(dispatched, jobIds[1:]) {
+		t.Fatalf("Expected jobs %v dispatched, got: %v", jobIds[1:], dispatched)
+	}
+
+	// The start position is kept when consumers are upgraded
+	if _, err := client.createJobsConsumer(core.NormalPriority); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestDispatchWithDependencies(t *testing.T) {
+
+	opts := server.DefaultTestOptions
+	opts.Port = -1
+	opts.JetStream = true
+	opts.StoreDir = t.TempDir()
+
+	s := server.RunServer(&opts)
+	defer s.Shutdown()
+
+	bareClient, err := NewClient(s.ClientURL(), "", "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer bareClient.Close()
+
+	if err := bareClient.CreateJobsQueue(); err != nil {
+		t.Fatal(err)
+	}
+	if err := bareClient.CreateJobsRepository(); err != nil {
+		t.Fatal(err)
+	}
+
+	client, err := NewClient(s.ClientURL(), "", "test", InitJobsQueue(), InitJobsRepository())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	jobParams := core.JobParameters{
+		GitRemote: "https://github.com/synadia-labs/go-bench-away.git",
+		GitRef:    "main",
+	}
+
+	if _, err := client.SubmitJobAfter(jobParams, []string{"no-such-job"}, core.CancelOnDependencyFailure); err == nil {
+		t.Fatalf("Expected error submitting job with unknown dependency")
+	}
+
+	baseline, err := client.SubmitJob(jobParams)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dependencies := []string{baseline.Id}
+	cancelledJob, err := client.SubmitJobAfter(jobParams, dependencies, core.CancelOnDependencyFailure)
+	if err != nil {
+		t.Fatal(err)
+	}
+	failedJob, err := client.SubmitJobAfter(jobParams, dependencies, core.FailOnDependencyFailure)
+	if err != nil {
+		t.Fatal(err)
+	}
+	reportJob, err := client.SubmitJobAfter(jobParams, dependencies, core.RunOnDependencyFailure)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Dependencies are pending until the baseline completes
+	state, _, err := client.checkDependencies(reportJob)
+	if err != nil {
+		t.Fatal(err)
+	} else if state != dependenciesPending {
+		t.Fatalf("Unexpected dependencies state: %v", state)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	err = client.DispatchJobs(
+		ctx,
+		func(record *core.JobRecord, revision uint64) (bool, error) {
+			switch record.Id {
+			case baseline.Id:
+				record.SetFinalStatus(core.Failed)
+			case reportJob.Id:
+				record.SetFinalStatus(core.Succeeded)
+				cancel()
+			default:
+				t.Fatalf("Unexpected dispatched job: %s", record.Id)
+			}
+			if _, err := client.UpdateJob(record, revision); err != nil {
+				t.Fatal(err)
+			}
+			return false, nil
+		},
+	)
+	if err != nil && !errors.Is(err, context.Canceled) {
+		t.Fatal(err)
+	}
+
+	expectedStatuses := map[string]core.JobStatus{
+		baseline.Id:     core.Failed,
+		cancelledJob.Id: core.Cancelled,
+		failedJob.Id:    core.Failed,
+		reportJob.Id:    core.Succeeded,
+	}
+	for jobId, expectedStatus := range expectedStatuses {
+		job, _, err := client.LoadJob(jobId)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if job.Status != expectedStatus {
+			t.Fatalf("Unexpected status of job %s: %s (expected: %s)", jobId, job.Status, expectedStatus)
+		}
+	}
+}
+
+func TestDispatchWithDeletedDependency(t *testing.T) {
+
+	opts := server.DefaultTestOptions
+	opts.Port = -1
+	opts.JetStream = true
+	opts.StoreDir = t.TempDir()
+
+	s := server.RunServer(&opts)
+	defer s.Shutdown()
+
+	bareClient, err := NewClient(s.ClientURL(), "", "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer bareClient.Close()
+
+	if err := bareClient.CreateJobsQueue(); err != nil {
+		t.Fatal(err)
+	}
+	if err := bareClient.CreateJobsRepository(); err != nil {
+		t.Fatal(err)
+	}
+
+	client, err := NewClient(s.ClientURL(), "", "test", InitJobsQueue(), InitJobsRepository())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	dependency, err := client.SubmitJob(core.JobParameters{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	dependencies := []string{dependency.Id}
+	cancelledJob, err := client.SubmitJobAfter(core.JobParameters{}, dependencies, core.CancelOnDependencyFailure)
+	if err != nil {
+		t.Fatal(err)
+	}
+	reportJob, err := client.SubmitJobAfter(core.JobParameters{}, dependencies, core.RunOnDependencyFailure)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The dependency record is deleted before it runs
+	if err := client.jobsRepository.Purge(fmt.Sprintf(kJobRecordKeyTmpl, dependency.Id)); err != nil {
+		t.Fatal(err)
+	}
+
+	if state, failedDependencyId, err := client.checkDependencies(cancelledJob); err != nil {
+		t.Fatal(err)
+	} else if state != dependenciesFailed || failedDependencyId != dependency.Id {
+		t.Fatalf("Unexpected dependencies state: %v (%s)", state, failedDependencyId)
+	}
+	if state, _, err := client.checkDependencies(reportJob); err != nil {
+		t.Fatal(err)
+	} else if state != dependenciesSatisfied {
+		t.Fatalf("Unexpected dependencies state: %v", state)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	err = client.DispatchJobs(
+		ctx,
+		func(record *core.JobRecord, revision uint64) (bool, error) {
+			if record.Id != reportJob.Id {
+				t.Fatalf("Unexpected dispatched job: %s", record.Id)
+			}
+			record.SetFinalStatus(core.Succeeded)
+			if _, err := client.UpdateJob(record, revision); err != nil {
+				t.Fatal(err)
+			}
+			cancel()
+			return false, nil
+		},
+	)
+	if err != nil && !errors.Is(err, context.Canceled) {
+		t.Fatal(err)
+	}
+
+	if job, _, err := client.LoadJob(cancelledJob.Id); err != nil {
+		t.Fatal(err)
+	} else if job.Status != core.Cancelled || job.FailureReason.Category != core.DependencyFailure {
+		t.Fatalf("Unexpected job: %v (%v)", job.Status, job.FailureReason)
+	}
+}
+
+func TestLoadJobsByLabels(t *testing.T) {
+
+	opts := server.DefaultTestOptions
+	opts.Port = -1
+	opts.JetStream = true
+	opts.StoreDir = t.TempDir()
+
+	s := server.RunServer(&opts)
+	defer s.Shutdown()
+
+	bareClient, err := NewClient(s.ClientURL(), "", "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer bareClient.Close()
+
+	if err := bareClient.CreateJobsQueue(); err != nil {
+		t.Fatal(err)
+	}
+	if err := bareClient.CreateJobsRepository(); err != nil {
+		t.Fatal(err)
+	}
+
+	client, err := NewClient(s.ClientURL(), "", "test", InitJobsQueue(), InitJobsRepository())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	jobsLabels := []core.Labels{
+		{"pr": "1234"},
+		{"pr": "1234", "nightly": "true"},
+		{"pr": "5678"},
+		nil,
+	}
+	for _, labels := range jobsLabels {
+		_, err := client.SubmitJob(core.JobParameters{
+			GitRemote: "https://github.com/synadia-labs/go-bench-away.git",
+			GitRef:    "main",
+			Labels:    labels,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	testCases := []struct {
+		selector      string
+		expectedCount int
+	}{
+		{"", 4},
+		{"pr=1234", 2},
+		{"pr=1234,!nightly", 1},
+		{"pr", 3},
+		{"!pr", 1},
+		{"campaign=gc", 0},
+	}
+
+	for _, tc := range testCases {
+		selector, err := core.ParseLabelSelector(tc.selector)
+		if err != nil {
+			t.Fatal(err)
+		}
+		jobs, counts, err := client.LoadJobsByKV(0, 0, nil, selector)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(jobs) != tc.expectedCount || counts[core.Submitted] != tc.expectedCount {
+			t.Fatalf("Selector '%s' expected %d jobs, got: %d (counts: %v)", tc.selector, tc.expectedCount, len(jobs), counts)
+		}
+		for _, job := range jobs {
+			if !selector.Matches(job.Parameters.Labels) {
+				t.Fatalf("Selector '%s' loaded non-matching job labels: %s", tc.selector, job.Parameters.Labels)
+			}
+		}
+	}
+}
+
+func TestJobHistory(t *testing.T) {
+
+	opts := server.DefaultTestOptions
+	opts.Port = -1
+	opts.JetStream = true
+	opts.StoreDir = t.TempDir()
+
+	s := server.RunServer(&opts)
+	defer s.Shutdown()
+
+	bareClient, err := NewClient(s.ClientURL(), "", "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer bareClient.Close()
+
+	if err := bareClient.CreateJobsQueue(); err != nil {
+		t.Fatal(err)
+	}
+	if err := bareClient.CreateJobsRepository(); err != nil {
+		t.Fatal(err)
+	}
+
+	client, err := NewClient(s.ClientURL(), "", "test", InitJobsQueue(), InitJobsRepository(), WithActor("tester"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	job, err := client.SubmitJob(core.JobParameters{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Updates that do not change the status are not recorded
+	job, revision, err := client.LoadJob(job.Id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	job.SHA = "abc"
+	if _, err := client.UpdateJob(job, revision); err != nil {
+		t.Fatal(err)
+	}
+
+	// Updates of an outdated revision are rejected as conflicts
+	if _, err := client.UpdateJob(job, revision); !errors.Is(err, core.ErrRevisionConflict) {
+		t.Fatalf("Expected revision conflict, got: %v", err)
+	}
+
+	// Rejected updates do not record the transition
+	job.SetRunningStatus()
+	if _, err := client.UpdateJobFromStatus(job, revision, core.Submitted, ""); !errors.Is(err, core.ErrRevisionConflict) {
+		t.Fatalf("Expected revision conflict, got: %v", err)
+	} else if len(job.History) != 0 {
+		t.Fatalf("Unexpected history after conflict: %+v", job.History)
+	}
+
+	if err := client.CancelJob(job.Id); err != nil {
+		t.Fatal(err)
+	}
+
+	job, _, err = client.LoadJob(job.Id)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(job.History) != 1 {
+		t.Fatalf("Unexpected history: %+v", job.History)
+	}
+	transition := job.History[0]
+	if transition.From != core.Submitted || transition.To != core.Cancelled || transition.Actor != "tester" {
+		t.Fatalf("Unexpected transition: %+v", transition)
+	}
+}
+
+func TestFailStaleJobs(t *testing.T) {
+
+	opts := server.DefaultTestOptions
+	opts.Port = -1
+	opts.JetStream = true
+	opts.StoreDir = t.TempDir()
+
+	s := server.RunServer(&opts)
+	defer s.Shutdown()
+
+	bareClient, err := NewClient(s.ClientURL(), "", "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer bareClient.Close()
+
+	if err := bareClient.CreateJobsQueue(); err != nil {
+		t.Fatal(err)
+	}
+	if err := bareClient.CreateJobsRepository(); err != nil {
+		t.Fatal(err)
+	}
+
+	client, err := NewClient(s.ClientURL(), "", "test", InitJobsQueue(), InitJobsRepository())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	heartbeatTimeout := 5 * time.Minute
+
+	// Jobs running for the given time, with a heartbeat of the given age
+	startJob := func(params core.JobParameters, runtime, heartbeatAge time.Duration) string {
+		job, err := client.SubmitJob(params)
+		if err != nil {
+			t.Fatal(err)
+		}
+		job, revision, err := client.LoadJob(job.Id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		job.SetRunningStatus()
+		job.Started = time.Now().Add(-runtime)
+		job.Heartbeat = time.Now().Add(-heartbeatAge)
+		if _, err := client.UpdateJob(job, revision); err != nil {
+			t.Fatal(err)
+		}
+		return job.Id
+	}
+
+	params := core.JobParameters{Timeout: time.Hour}
+	activeJobId := startJob(params, time.Minute, time.Second)
+	lostJobId := startJob(params, time.Minute, time.Hour)
+	// Past its timeout, but the worker is alive and enforces the timeout (with a grace period)
+	overtimeActiveJobId := startJob(params, 2*time.Hour, time.Second)
+	overtimeLostJobId := startJob(params, 2*time.Hour, time.Hour)
+	params.Retry = core.RetryPolicy{MaxAttempts: 2}
+	retriedJobId := startJob(params, time.Minute, time.Hour)
+
+	updated, err := client.FailStaleJobs(heartbeatTimeout)
+	if err != nil {
+		t.Fatal(err)
+	} else if updated != 3 {
+		t.Fatalf("Unexpected number of updated jobs: %d", updated)
+	}
+
+	expectedStatuses := map[string]core.JobStatus{
+		activeJobId:         core.Running,
+		lostJobId:           core.Failed,
+		overtimeActiveJobId: core.Running,
+		overtimeLostJobId:   core.TimedOut,
+		retriedJobId:        core.Submitted,
+	}
+	for jobId, expectedStatus := range expectedStatuses {
+		job, _, err := client.LoadJob(jobId)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if job.Status != expectedStatus {
+			t.Fatalf("Unexpected status of job %s: %s (expected: %s)", jobId, job.Status, expectedStatus)
+		}
+		if jobId == lostJobId && job.FailureReason.Category != core.LostWorkerFailure {
+			t.Fatalf("Unexpected failure reason: %s", job.FailureReason)
+		}
+		if jobId == retriedJobId && job.Attempt != 2 {
+			t.Fatalf("Unexpected attempt: %d", job.Attempt)
+		}
+	}
+
+	// The requeued job is not published again, its message is redelivered
+	qs, err := client.GetQueueStatus()
+	if err != nil {
+		t.Fatal(err)
+	} else if qs.SubmittedCount != 5 {
+		t.Fatalf("Unexpected number of messages in queue: %d", qs.SubmittedCount)
+	}
+}
+
+func TestCancelRunningJob(t *testing.T) {
+
+	opts := server.DefaultTestOptions
+	opts.Port = -1
+	opts.JetStream = true
+	opts.StoreDir = t.TempDir()
+
+	s := server.RunServer(&opts)
+	defer s.Shutdown()
+
+	bareClient, err := NewClient(s.ClientURL(), "", "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer bareClient.Close()
+
+	if err := bareClient.CreateJobsQueue(); err != nil {
+		t.Fatal(err)
+	}
+	if err := bareClient.CreateJobsRepository(); err != nil {
+		t.Fatal(err)
+	}
+
+	client, err := NewClient(s.ClientURL(), "", "test", InitJobsQueue(), InitJobsRepository(), WithActor("tester"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	job, err := client.SubmitJob(core.JobParameters{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	job, revision, err := client.LoadJob(job.Id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	job.SetRunningStatus()
+	revision, err = client.UpdateJob(job, revision)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// No worker listening, but the job heartbeat is fresh
+	if err := client.CancelJob(job.Id); err == nil {
+		t.Fatalf("Expected error cancelling job without a worker")
+	} else if strings.Contains(err.Error(), "fail-stale") {
+		t.Fatalf("Unexpected suggestion to fail live job: %v", err)
+	}
+
+	// No worker listening, and no heartbeat for a while
+	job.Heartbeat = time.Now().Add(-time.Hour)
+	if _, err := client.UpdateJob(job, revision); err != nil {
+		t.Fatal(err)
+	}
+	if err := client.CancelJob(job.Id); err == nil || !strings.Contains(err.Error(), "fail-stale") {
+		t.Fatalf("Expected error suggesting fail-stale, got: %v", err)
+	}
+
+	requesters := make(chan string, 1)
+	stopListening, err := client.OnCancelRequest(job.Id, func(requester string) {
+		requesters <- requester
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stopListening()
+
+	if err := client.CancelJob(job.Id); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case requester := <-requesters:
+		if requester != "tester" {
+			t.Fatalf("Unexpected requester: %s", requester)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Cancel request not received")
+	}
+}
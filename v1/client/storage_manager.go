@@ -1,23 +1,55 @@
 package client
 
 import (
+	"fmt"
+	"time"
+
+	"github.com/synadia-labs/go-bench-away/v1/core"
+
 	"github.com/nats-io/nats.go"
 )
 
+// How long a worker registration lasts if not refreshed
+const kWorkerRegistrationTTL = 2 * time.Minute
+
 func (c *Client) CreateJobsQueue() error {
 	c.logDebug("Creating jobs queue %s", c.options.jobsQueueName)
 
 	cfg := nats.StreamConfig{
 		Name:        c.options.jobsQueueStreamName,
 		Description: "Jobs queue", //TODO add namespace
-		Subjects:    []string{c.options.jobsSubmitSubject},
+		Subjects: []string{
+			c.options.jobsSubmitSubject,
+			// Non-default priorities are published to sub-subjects
+			c.options.jobsSubmitSubject + ".*",
+		},
 	}
 
 	_, err := c.js.AddStream(&cfg)
+	if err == nats.ErrStreamNameAlreadyInUse {
+		// Stream created by a previous version, upgrade it
+		c.logDebug("Updating jobs queue %s", c.options.jobsQueueName)
+		_, err = c.js.UpdateStream(&cfg)
+	}
 	if err != nil {
 		return err
 	}
-	return nil
+
+	// Replace the consumer of versions without priorities by one consumer per priority, starting where it is
+	legacyConsumerName := fmt.Sprintf(kLegacyConsumerNameTmpl, c.options.namespace)
+	_, err = c.js.ConsumerInfo(c.options.jobsQueueStreamName, legacyConsumerName)
+	if err == nats.ErrConsumerNotFound {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	for _, priority := range core.Priorities {
+		if _, err := c.createJobsConsumer(priority); err != nil {
+			return fmt.Errorf("Consumer error (priority: %s): %v", priority, err)
+		}
+	}
+	c.logDebug("Deleting jobs consumer %s", legacyConsumerName)
+	return c.js.DeleteConsumer(c.options.jobsQueueStreamName, legacyConsumerName)
 }
 
 func (c *Client) CreateJobsRepository() error {
@@ -50,6 +82,46 @@ func (c *Client) CreateArtifactsStore() error {
 	return nil
 }
 
+func (c *Client) CreateWorkersRegistry() error {
+	c.logDebug("Creating workers registry %s", c.options.workersRegistryName)
+
+	cfg := nats.KeyValueConfig{
+		Bucket:      c.options.workersRegistryName,
+		Description: "Live workers registry",
+		TTL:         kWorkerRegistrationTTL,
+	}
+
+	_, err := c.js.CreateKeyValue(&cfg)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+func (c *Client) CreateLogsStream() error {
+	c.logDebug("Creating logs stream %s", c.options.logsStreamName)
+
+	cfg := nats.StreamConfig{
+		Name:        c.options.logsStreamName,
+		Description: "Live logs of running jobs",
+		Subjects:    []string{fmt.Sprintf(kJobLogSubjectTmpl, c.options.namespace, "*")},
+		// Complete logs are uploaded as artifacts, only keep recent output
+		MaxAge:   kLogsStreamMaxAge,
+		MaxBytes: kLogsStreamMaxBytes,
+		Discard:  nats.DiscardOld,
+	}
+
+	_, err := c.js.AddStream(&cfg)
+	if err == nats.ErrStreamNameAlreadyInUse {
+		c.logDebug("Updating logs stream %s", c.options.logsStreamName)
+		_, err = c.js.UpdateStream(&cfg)
+	}
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
 func (c *Client) DeleteJobsQueue() error {
 	c.logDebug("Deleting jobs queue %s", c.options.jobsQueueName)
 
@@ -85,3 +157,27 @@ func (c *Client) DeleteArtifactsStore() error {
 	}
 	return nil
 }
+
+func (c *Client) DeleteWorkersRegistry() error {
+	c.logDebug("Deleting workers registry %s", c.options.workersRegistryName)
+
+	err := c.js.DeleteKeyValue(c.options.workersRegistryName)
+	if err == nats.ErrStreamNotFound {
+		//noop
+	} else if err != nil {
+		return err
+	}
+	return nil
+}
+
+func (c *Client) DeleteLogsStream() error {
+	c.logDebug("Deleting logs stream %s", c.options.logsStreamName)
+
+	err := c.js.DeleteStream(c.options.logsStreamName)
+	if err == nats.ErrStreamNotFound {
+		//noop
+	} else if err != nil {
+		return err
+	}
+	return nil
+}
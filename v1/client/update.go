@@ -1,12 +1,69 @@
 package client
 
 import (
+	"errors"
 	"fmt"
+	"slices"
 
 	"github.com/synadia-labs/go-bench-away/v1/core"
+
+	"github.com/nats-io/nats.go"
 )
 
 func (c *Client) UpdateJob(job *core.JobRecord, revision uint64) (uint64, error) {
+	return c.UpdateJobWithNote(job, revision, "")
+}
+
+// UpdateJobWithNote updates the job record, if the status changed from the stored one, the transition is
+// appended to the job history along with the given note (or the failure reason, if no note is given).
+func (c *Client) UpdateJobWithNote(job *core.JobRecord, revision uint64, note string) (uint64, error) {
 	jobRecordKey := fmt.Sprintf(kJobRecordKeyTmpl, job.Id)
-	return c.jobsRepository.Update(jobRecordKey, job.Bytes(), revision)
+
+	kve, err := c.jobsRepository.Get(jobRecordKey)
+	if err != nil {
+		return 0, err
+	}
+
+	storedJob, err := core.LoadJob(kve.Value())
+	if err != nil {
+		return 0, err
+	}
+
+	return c.UpdateJobFromStatus(job, revision, storedJob.Status, note)
+}
+
+// UpdateJobFromStatus is like UpdateJobWithNote, for callers that know the status of the stored revision (e.g. the
+// heartbeat of a running job), which saves looking it up.
+// The job history is only modified if the update succeeds.
+func (c *Client) UpdateJobFromStatus(
+	job *core.JobRecord,
+	revision uint64,
+	previousStatus core.JobStatus,
+	note string,
+) (uint64, error) {
+	jobRecordKey := fmt.Sprintf(kJobRecordKeyTmpl, job.Id)
+
+	updatedJob := *job
+	if previousStatus != job.Status {
+		if note == "" && job.FailureReason != nil && job.IsCompleted() {
+			note = job.FailureReason.String()
+		}
+		updatedJob.History = slices.Clone(job.History)
+		updatedJob.AppendTransition(previousStatus, c.options.actor, note)
+	}
+
+	newRevision, err := c.jobsRepository.Update(jobRecordKey, updatedJob.Bytes(), revision)
+	if isWrongLastSequence(err) {
+		return 0, fmt.Errorf("%w: %v", core.ErrRevisionConflict, err)
+	} else if err != nil {
+		return 0, err
+	}
+	job.History = updatedJob.History
+	return newRevision, nil
+}
+
+// Whether the error is a KV update rejected because the key was modified since the expected revision
+func isWrongLastSequence(err error) bool {
+	var apiErr *nats.APIError
+	return errors.As(err, &apiErr) && apiErr.ErrorCode == nats.JSErrCodeStreamWrongLastSequence
 }
@@ -0,0 +1,81 @@
+package client
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/synadia-labs/go-bench-away/v1/core"
+
+	"github.com/nats-io/nats.go"
+)
+
+// HasWorkersRegistry reports whether the workers registry is bound (it may be missing, with
+// InitWorkersRegistryIfExists)
+func (c *Client) HasWorkersRegistry() bool {
+	return c.workersRegistry != nil
+}
+
+// RegisterWorker creates or refreshes the registration of a worker.
+// Registrations expire if not refreshed periodically.
+func (c *Client) RegisterWorker(worker *core.WorkerRecord) error {
+	workerRecordKey := fmt.Sprintf(kWorkerRecordKeyTmpl, worker.Id)
+	_, err := c.workersRegistry.Put(workerRecordKey, worker.Bytes())
+	return err
+}
+
+// UnregisterWorker removes the registration of a worker that is shutting down
+func (c *Client) UnregisterWorker(workerId string) error {
+	workerRecordKey := fmt.Sprintf(kWorkerRecordKeyTmpl, workerId)
+	return c.workersRegistry.Delete(workerRecordKey)
+}
+
+// DrainWorker asks a live worker to finish its current job (if any) and exit, without picking up new jobs
+func (c *Client) DrainWorker(workerId string) error {
+	subject := fmt.Sprintf(kWorkerDrainSubjectTmpl, c.options.namespace, workerId)
+	_, err := c.nc.Request(subject, []byte(c.options.actor), kControlRequestTimeout)
+	if err == nats.ErrNoResponders {
+		return fmt.Errorf("worker %s is not running", workerId)
+	} else if err != nil {
+		return fmt.Errorf("failed to request drain of worker %s: %v", workerId, err)
+	}
+	return nil
+}
+
+// OnDrainRequest invokes the callback (with the name of who is draining) when draining of the given worker
+// is requested. Returns a function to stop listening.
+func (c *Client) OnDrainRequest(workerId string, callback func(string)) (func(), error) {
+	return c.onControlRequest(fmt.Sprintf(kWorkerDrainSubjectTmpl, c.options.namespace, workerId), callback)
+}
+
+// LoadWorkers loads the registration of all live workers, sorted by hostname
+func (c *Client) LoadWorkers() ([]*core.WorkerRecord, error) {
+	watcher, err := c.workersRegistry.WatchAll()
+	if err != nil {
+		return nil, fmt.Errorf("failed to watch KV: %v", err)
+	}
+	defer func() { _ = watcher.Stop() }()
+
+	workers := []*core.WorkerRecord{}
+	for entry := range watcher.Updates() {
+		if entry == nil {
+			break
+		}
+		if entry.Operation() != nats.KeyValuePut {
+			continue
+		}
+		worker, err := core.LoadWorker(entry.Value())
+		if err != nil {
+			continue
+		}
+		workers = append(workers, worker)
+	}
+
+	sort.Slice(workers, func(i, j int) bool {
+		if workers[i].WorkerInfo.Hostname != workers[j].WorkerInfo.Hostname {
+			return workers[i].WorkerInfo.Hostname < workers[j].WorkerInfo.Hostname
+		}
+		return workers[i].Started.Before(workers[j].Started)
+	})
+
+	return workers, nil
+}
@@ -0,0 +1,143 @@
+package client
+
+import (
+	"testing"
+	"time"
+
+	server "github.com/nats-io/nats-server/v2/test"
+	"github.com/synadia-labs/go-bench-away/v1/core"
+)
+
+func TestWorkersRegistry(t *testing.T) {
+
+	opts := server.DefaultTestOptions
+	opts.Port = -1
+	opts.JetStream = true
+	opts.StoreDir = t.TempDir()
+
+	s := server.RunServer(&opts)
+	defer s.Shutdown()
+
+	bareClient, err := NewClient(s.ClientURL(), "", "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer bareClient.Close()
+
+	if _, err := NewClient(s.ClientURL(), "", "test", InitWorkersRegistry()); err == nil {
+		t.Fatalf("Expected error binding workers registry before it's initialized")
+	}
+
+	optClient, err := NewClient(s.ClientURL(), "", "test", InitWorkersRegistryIfExists())
+	if err != nil {
+		t.Fatalf("Unexpected error binding optional workers registry before it's initialized: %v", err)
+	} else if optClient.HasWorkersRegistry() {
+		t.Fatalf("Expected no workers registry")
+	}
+	optClient.Close()
+
+	if err := bareClient.CreateWorkersRegistry(); err != nil {
+		t.Fatal(err)
+	}
+
+	client, err := NewClient(s.ClientURL(), "", "test", InitWorkersRegistry())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	if !client.HasWorkersRegistry() {
+		t.Fatalf("Expected workers registry")
+	}
+
+	workers := []*core.WorkerRecord{
+		{Id: "w2", WorkerInfo: core.WorkerInfo{Hostname: "host-b"}, Started: time.Now()},
+		{Id: "w1", WorkerInfo: core.WorkerInfo{Hostname: "host-a"}, Started: time.Now()},
+	}
+	for _, worker := range workers {
+		if err := client.RegisterWorker(worker); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Refresh with a current job
+	workers[0].CurrentJobs = []string{"job-1"}
+	if err := client.RegisterWorker(workers[0]); err != nil {
+		t.Fatal(err)
+	}
+
+	loadedWorkers, err := client.LoadWorkers()
+	if err != nil {
+		t.Fatal(err)
+	} else if len(loadedWorkers) != 2 {
+		t.Fatalf("Unexpected number of workers: %d", len(loadedWorkers))
+	} else if loadedWorkers[0].Id != "w1" || loadedWorkers[1].Id != "w2" {
+		t.Fatalf("Unexpected workers order: %s, %s", loadedWorkers[0].Id, loadedWorkers[1].Id)
+	} else if len(loadedWorkers[1].CurrentJobs) != 1 || loadedWorkers[1].CurrentJobs[0] != "job-1" {
+		t.Fatalf("Unexpected current jobs: %v", loadedWorkers[1].CurrentJobs)
+	}
+
+	if err := client.UnregisterWorker("w1"); err != nil {
+		t.Fatal(err)
+	}
+
+	loadedWorkers, err = client.LoadWorkers()
+	if err != nil {
+		t.Fatal(err)
+	} else if len(loadedWorkers) != 1 || loadedWorkers[0].Id != "w2" {
+		t.Fatalf("Unexpected workers after unregister: %v", loadedWorkers)
+	}
+
+	if err := bareClient.DeleteWorkersRegistry(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestDrainWorker(t *testing.T) {
+
+	opts := server.DefaultTestOptions
+	opts.Port = -1
+	opts.JetStream = true
+	opts.StoreDir = t.TempDir()
+
+	s := server.RunServer(&opts)
+	defer s.Shutdown()
+
+	client, err := NewClient(s.ClientURL(), "", "test", WithActor("tester"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	// No worker listening
+	if err := client.DrainWorker("w1"); err == nil {
+		t.Fatalf("Expected error draining worker that is not running")
+	}
+
+	requesters := make(chan string, 1)
+	stopListening, err := client.OnDrainRequest("w1", func(requester string) {
+		requesters <- requester
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stopListening()
+
+	// Other workers are not affected
+	if err := client.DrainWorker("w2"); err == nil {
+		t.Fatalf("Expected error draining worker that is not running")
+	}
+
+	if err := client.DrainWorker("w1"); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case requester := <-requesters:
+		if requester != "tester" {
+			t.Fatalf("Unexpected requester: %s", requester)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Drain request not received")
+	}
+}
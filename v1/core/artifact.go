@@ -0,0 +1,96 @@
+package core
+
+import (
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Names of the artifacts every job run produces
+const (
+	LogArtifact     = "log.txt"
+	ResultsArtifact = "results.txt"
+	ScriptArtifact  = "run.sh"
+)
+
+// Content types of artifacts
+const (
+	TextContentType   = "text/plain; charset=utf-8"
+	ScriptContentType = "text/x-shellscript; charset=utf-8"
+	BinaryContentType = "application/octet-stream"
+)
+
+// Encoding of compressed artifacts, as in HTTP Content-Encoding
+const GzipEncoding = "gzip"
+
+// ArtifactInfo describes a file attached to a job (log, results, profile, ...)
+type ArtifactInfo struct {
+	Name        string    // Unique within the job, e.g. log.txt, cpu.pprof
+	ContentType string    // MIME type
+	Size        uint64    // Size in bytes
+	Encoding    string    // Compression applied to the stored artifact (empty: stored as is)
+	StoredSize  uint64    // Size in bytes in the object store, once compressed
+	Modified    time.Time // Time of upload
+}
+
+// AttemptLogArtifact returns the name of the log artifact of the given attempt, each attempt of a job retried has
+// its own log
+func AttemptLogArtifact(attempt uint) string {
+	if attempt > 1 {
+		return fmt.Sprintf("log.attempt-%d.txt", attempt)
+	}
+	return LogArtifact
+}
+
+// Whether the artifact is one of those every job run produces (log of any attempt, results, script)
+func isRunArtifact(name string) bool {
+	return name == ResultsArtifact || name == ScriptArtifact || isLogArtifact(name)
+}
+
+// Whether the artifact is the log of an attempt (see AttemptLogArtifact)
+func isLogArtifact(name string) bool {
+	return name == LogArtifact || strings.HasPrefix(name, "log.attempt-")
+}
+
+// AddArtifact records the object store key of an artifact uploaded for the job
+func (jr *JobRecord) AddArtifact(name, key string) {
+	if jr.Artifacts == nil {
+		jr.Artifacts = map[string]string{}
+	}
+	jr.Artifacts[name] = key
+}
+
+// ArtifactKeys returns the object store keys of all the job artifacts, by name.
+// Records of jobs run by older versions have no artifacts index: the keys are taken from the Log, Results and Script
+// fields of the record and its previous attempts, named after the last part of their key.
+func (jr *JobRecord) ArtifactKeys() map[string]string {
+	keys := map[string]string{}
+	for _, key := range []string{jr.Log, jr.Results, jr.Script} {
+		if key != "" {
+			keys[path.Base(key)] = key
+		}
+	}
+	for _, attempt := range jr.PreviousAttempts {
+		if attempt.Log != "" {
+			keys[path.Base(attempt.Log)] = attempt.Log
+		}
+	}
+	for name, key := range jr.Artifacts {
+		keys[name] = key
+	}
+	return keys
+}
+
+// ArtifactNames returns the names of the job other artifacts (e.g. profiles), sorted
+func (jr *JobRecord) ArtifactNames() []string {
+	names := make([]string, 0, len(jr.Artifacts))
+	for name := range jr.Artifacts {
+		if !isRunArtifact(name) {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,45 @@
+package core
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestArtifactKeys(t *testing.T) {
+
+	// Run by an older version, without artifacts index
+	job := &JobRecord{
+		Id:               "job-1",
+		Log:              "jobs/job-1/log.attempt-2.txt",
+		Results:          "jobs/job-1/results.txt",
+		PreviousAttempts: []JobAttempt{{Attempt: 1, Log: "jobs/job-1/log.txt"}},
+	}
+	expected := map[string]string{
+		"log.txt":           "jobs/job-1/log.txt",
+		"log.attempt-2.txt": "jobs/job-1/log.attempt-2.txt",
+		"results.txt":       "jobs/job-1/results.txt",
+	}
+	if keys := job.ArtifactKeys(); !reflect.DeepEqual(keys, expected) {
+		t.Fatalf("Expected artifacts: %v, got: %v", expected, keys)
+	} else if names := job.ArtifactNames(); len(names) != 0 {
+		t.Fatalf("Unexpected other artifacts: %v", names)
+	}
+
+	job.AddArtifact(ScriptArtifact, "jobs/job-1/run.sh")
+	job.AddArtifact("cpu.pprof", "jobs/job-1/cpu.pprof")
+	expected[ScriptArtifact] = "jobs/job-1/run.sh"
+	expected["cpu.pprof"] = "jobs/job-1/cpu.pprof"
+	if keys := job.ArtifactKeys(); !reflect.DeepEqual(keys, expected) {
+		t.Fatalf("Expected artifacts: %v, got: %v", expected, keys)
+	} else if names := job.ArtifactNames(); !reflect.DeepEqual(names, []string{"cpu.pprof"}) {
+		t.Fatalf("Unexpected other artifacts: %v", names)
+	}
+
+	job.RemoveLogs()
+	expected = map[string]string{"results.txt": "jobs/job-1/results.txt"}
+	if keys := job.ArtifactKeys(); !reflect.DeepEqual(keys, expected) {
+		t.Fatalf("Expected artifacts: %v, got: %v", expected, keys)
+	} else if job.HasLogs() {
+		t.Fatalf("Unexpected logs after removing them: %+v", job)
+	}
+}
@@ -0,0 +1,35 @@
+package core
+
+import (
+	"fmt"
+)
+
+// GoCacheInfo describes the Go module and build caches a job used, as measured before building the tests
+type GoCacheInfo struct {
+	ModCacheDir     string // GOMODCACHE
+	ModCacheSize    uint64 // Size of the module cache, in bytes
+	BuildCacheDir   string // GOCACHE
+	BuildCacheSize  uint64 // Size of the build cache, in bytes
+	CleanBuildCache bool   // Build cache was empty (private to the job)
+	PackagesCached  int    // Number of packages (dependencies and tests) already built in the build cache
+	PackagesTotal   int    // Number of packages (dependencies and tests) built
+}
+
+// HitRate returns the fraction of packages found in the build cache, in human-readable form
+func (c *GoCacheInfo) HitRate() string {
+	if c.PackagesTotal == 0 {
+		return "unknown"
+	}
+	return fmt.Sprintf("%d/%d packages (%.0f%%)", c.PackagesCached, c.PackagesTotal,
+		100*float64(c.PackagesCached)/float64(c.PackagesTotal))
+}
+
+// ModCacheSizeString returns the module cache size in human-readable form
+func (c *GoCacheInfo) ModCacheSizeString() string {
+	return fmt.Sprintf("%.1f MiB", float64(c.ModCacheSize)/(1<<20))
+}
+
+// BuildCacheSizeString returns the build cache size in human-readable form
+func (c *GoCacheInfo) BuildCacheSizeString() string {
+	return fmt.Sprintf("%.1f MiB", float64(c.BuildCacheSize)/(1<<20))
+}
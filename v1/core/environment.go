@@ -0,0 +1,25 @@
+package core
+
+import (
+	"fmt"
+)
+
+// HostEnvironment is the state of the benchmark host when a job started, the usual sources of benchmark noise
+type HostEnvironment struct {
+	CPUModel         string
+	CPUCores         int      // Number of online logical CPUs
+	MemoryTotal      uint64   // Total memory, in bytes
+	Kernel           string   // Kernel release
+	Governor         string   // CPU frequency scaling governor(s) of the CPUs used (empty if unknown)
+	TurboBoost       string   // "enabled", "disabled" (empty if unknown)
+	SMT              string   // Simultaneous multithreading control, e.g. "on", "off", "notsupported" (empty if unknown)
+	LoadAverage      float64  // 1-minute load average
+	RunningProcesses int      // Number of processes running or runnable
+	ThrottleCount    uint64   // Number of thermal throttling events of the CPUs used, since boot
+	Warnings         []string // Violations of the worker stability policy
+}
+
+// Memory returns the total memory in human-readable form
+func (e *HostEnvironment) Memory() string {
+	return fmt.Sprintf("%.1f GiB", float64(e.MemoryTotal)/(1<<30))
+}
@@ -2,12 +2,17 @@ package core
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
+	"strings"
 	"time"
 
 	"github.com/google/uuid"
 )
 
+// ErrRevisionConflict is returned when updating a job record that was modified since the given revision
+var ErrRevisionConflict = errors.New("job record modified since it was loaded")
+
 type JobStatus int
 
 const (
@@ -16,8 +21,105 @@ const (
 	Failed
 	Succeeded
 	Cancelled
+	TimedOut
+)
+
+// FailureCategory classifies the cause of a job failure
+type FailureCategory string
+
+const (
+	// Job git remote rejected by the worker filter rules
+	NotAllowedFailure FailureCategory = "not-allowed"
+	// Job parameters rejected by the worker
+	InvalidParametersFailure FailureCategory = "invalid-parameters"
+	// Script failed to validate its arguments and environment
+	SetupFailure FailureCategory = "setup"
+	// Failed to clone or checkout the source
+	CheckoutFailure FailureCategory = "checkout"
+	// Failed to compile the tests
+	BuildFailure FailureCategory = "build"
+	// Benchmarks failed (panic, failed test, ...)
+	BenchmarkFailure FailureCategory = "benchmark"
+	// Failed to upload artifacts
+	ArtifactsFailure FailureCategory = "artifacts"
+	// Worker-side error (e.g. failed to create job directory or launch the script)
+	WorkerFailure FailureCategory = "worker"
+	// Job ran past its timeout
+	TimeoutFailure FailureCategory = "timeout"
+	// Job found running past its timeout, and marked by fail-stale
+	StaleFailure FailureCategory = "stale"
+	// One of the jobs this job depends on did not succeed
+	DependencyFailure FailureCategory = "dependency"
+	// Worker stopped sending heartbeats while running the job (crashed, lost connection, ...)
+	LostWorkerFailure FailureCategory = "lost-worker"
+	// Host environment did not satisfy the worker stability policy (load, CPU governor, ...)
+	EnvironmentFailure FailureCategory = "environment"
+	// Job exceeded one of the worker resource limits (memory, processes, disk)
+	ResourceLimitFailure FailureCategory = "resource-limit"
+)
+
+type FailureReason struct {
+	Category FailureCategory
+	Message  string
+}
+
+func (fr FailureReason) String() string {
+	return fmt.Sprintf("[%s] %s", fr.Category, fr.Message)
+}
+
+// JobPriority determines the order in which pending jobs are dispatched.
+// The zero value is NormalPriority, so records created before priorities existed load as normal.
+type JobPriority int
+
+const (
+	LowPriority JobPriority = iota - 1
+	NormalPriority
+	HighPriority
+	UrgentPriority
+)
+
+// Priorities lists all priority levels, from highest to lowest
+var Priorities = []JobPriority{
+	UrgentPriority,
+	HighPriority,
+	NormalPriority,
+	LowPriority,
+}
+
+// DependencyPolicy determines what happens to a job when one of the jobs it depends on does not succeed.
+type DependencyPolicy int
+
+const (
+	// Cancel the job (default)
+	CancelOnDependencyFailure DependencyPolicy = iota
+	// Mark the job as failed
+	FailOnDependencyFailure
+	// Run the job anyway, once all dependencies completed
+	RunOnDependencyFailure
 )
 
+var DependencyPolicies = []DependencyPolicy{
+	CancelOnDependencyFailure,
+	FailOnDependencyFailure,
+	RunOnDependencyFailure,
+}
+
+// EnvVars is a list of KEY=VALUE environment variables
+type EnvVars []string
+
+func (e EnvVars) String() string {
+	return strings.Join(e, " ")
+}
+
+// Set implements flag.Value, each invocation adds one KEY=VALUE variable
+func (e *EnvVars) Set(value string) error {
+	if !strings.Contains(value, "=") {
+		return fmt.Errorf("invalid environment variable: '%s' (expected: KEY=VALUE)", value)
+	}
+	*e = append(*e, value)
+	return nil
+}
+
 type JobParameters struct {
 	GitRemote       string
 	GitRef          string
@@ -31,12 +133,48 @@ type JobParameters struct {
 	GoPath          string
 	GoExperiment    string
 	CleanupCmd      string
+	Priority        JobPriority
+	Labels          Labels
+
+	// Additional `go test` options
+	TestCPUs  string  // Comma-separated list of GOMAXPROCS values (-cpu)
+	BenchMem  bool    // Report memory allocations (-benchmem)
+	BuildTags string  // Comma-separated list of build tags (-tags)
+	GcFlags   string  // Arguments passed to the compiler (-gcflags)
+	LdFlags   string  // Arguments passed to the linker (-ldflags)
+	Env       EnvVars // Extra environment variables for the benchmarks run (e.g. GOGC, GOMAXPROCS, GODEBUG)
+
+	// Go caches options
+	GoFlags         string // Flags applied to all go commands (GOFLAGS), e.g. '-mod=mod'
+	CleanBuildCache bool   // Build with an empty build cache, rather than the one shared by the worker jobs
+
+	// Profiles collected, by running the benchmarks once more after the measured runs (so results are not affected)
+	Profiles ProfileKinds
+
+	// Automatically requeue the job if it fails
+	Retry RetryPolicy
 }
 
 type WorkerInfo struct {
-	Hostname string
-	Uname    string
-	Version  string
+	Hostname    string
+	Uname       string
+	Version     string
+	CPUSet      string           // CPUs the job was pinned to, in list format (e.g. "0-3"), empty if not pinned
+	NUMANode    string           // NUMA node(s) of the CPUs the job was pinned to
+	Environment *HostEnvironment // Host state collected before running the job (nil if not collected)
+	// Hash of the benchmark script template, identifies the script steps when workers use custom templates
+	ScriptTemplate string
+	// Resource limits the job ran with, e.g. "memory: 4096 MiB, pids: 1000" (empty if none)
+	ResourceLimits string
+}
+
+// StatusTransition is an entry in the history of a job
+type StatusTransition struct {
+	From  JobStatus
+	To    JobStatus
+	Time  time.Time
+	Actor string // Who made the transition (worker hostname, user@host, ...)
+	Note  string
 }
 
 type JobRecord struct {
@@ -48,16 +186,43 @@ type JobRecord struct {
 	Started   time.Time
 	Completed time.Time
 
+	// Last time the worker running the job reported it alive
+	Heartbeat time.Time
+
 	SHA          string
 	GoVersion    string
 	GoExperiment string
 
-	// Artifacts from job execution
+	// Go module and build caches used (nil if not reported by the script)
+	GoCaches *GoCacheInfo
+
+	// Resources used by the job script (nil if the script did not run)
+	RunStats *RunStats
+
+	// Object store keys of the artifacts from job execution (empty if missing).
+	// Clients look up artifacts by name (see client.OpenArtifact), keys are still recorded for older clients.
 	Log     string
 	Results string
 	Script  string
+	// All the job artifacts (logs of each attempt, results, script, profiles, ...), object store key by artifact name.
+	// Missing for jobs run by older versions, see ArtifactKeys.
+	Artifacts map[string]string
 
 	WorkerInfo WorkerInfo
+
+	// Jobs that must complete before this job is dispatched
+	DependsOn        []string
+	DependencyPolicy DependencyPolicy
+
+	// Why the job did not succeed (nil unless Failed, TimedOut, or Cancelled because of a dependency)
+	FailureReason *FailureReason
+
+	// Append-only history of status transitions
+	History []StatusTransition
+
+	// Number of the current attempt at running this job (starting from 1), and previous failed ones
+	Attempt          uint
+	PreviousAttempts []JobAttempt
 }
 
 func (jr JobStatus) String() string {
@@ -72,6 +237,8 @@ func (jr JobStatus) String() string {
 		return "SUCCEEDED"
 	case Cancelled:
 		return "CANCELLED"
+	case TimedOut:
+		return "TIMED_OUT"
 	default:
 		panic(fmt.Sprintf("Unexpected job status: %d", jr))
 	}
@@ -89,15 +256,77 @@ func (jr JobStatus) Icon() string {
 		return "🟢"
 	case Cancelled:
 		return "❌"
+	case TimedOut:
+		return "⏱️"
 	default:
 		return "❓"
 	}
 }
 
+func (p JobPriority) String() string {
+	switch p {
+	case LowPriority:
+		return "low"
+	case NormalPriority:
+		return "normal"
+	case HighPriority:
+		return "high"
+	case UrgentPriority:
+		return "urgent"
+	default:
+		return fmt.Sprintf("priority(%d)", p)
+	}
+}
+
+// Set implements flag.Value
+func (p *JobPriority) Set(value string) error {
+	priority, err := ParsePriority(value)
+	if err != nil {
+		return err
+	}
+	*p = priority
+	return nil
+}
+
+func ParsePriority(value string) (JobPriority, error) {
+	for _, p := range Priorities {
+		if strings.EqualFold(value, p.String()) {
+			return p, nil
+		}
+	}
+	return NormalPriority, fmt.Errorf("invalid priority: '%s' (valid: low, normal, high, urgent)", value)
+}
+
+func (dp DependencyPolicy) String() string {
+	switch dp {
+	case CancelOnDependencyFailure:
+		return "cancel"
+	case FailOnDependencyFailure:
+		return "fail"
+	case RunOnDependencyFailure:
+		return "run"
+	default:
+		return fmt.Sprintf("policy(%d)", dp)
+	}
+}
+
+// Set implements flag.Value
+func (dp *DependencyPolicy) Set(value string) error {
+	for _, p := range DependencyPolicies {
+		if strings.EqualFold(value, p.String()) {
+			*dp = p
+			return nil
+		}
+	}
+	return fmt.Errorf("invalid dependency policy: '%s' (valid: cancel, fail, run)", value)
+}
+
 func (jr *JobRecord) RunTime() string {
 	switch jr.Status {
 	case Failed:
 		fallthrough
+	case TimedOut:
+		fallthrough
 	case Succeeded:
 		return jr.Completed.Sub(jr.Started).Round(time.Second).String()
 	case Running:
@@ -108,7 +337,7 @@ func (jr *JobRecord) RunTime() string {
 }
 
 func (jr *JobRecord) IsCompleted() bool {
-	return jr.Status == Failed || jr.Status == Succeeded || jr.Status == Cancelled
+	return jr.Status == Failed || jr.Status == Succeeded || jr.Status == Cancelled || jr.Status == TimedOut
 }
 
 func (jr *JobRecord) HasResults() bool {
@@ -122,6 +351,7 @@ func NewJob(params JobParameters) *JobRecord {
 		Status:     Submitted,
 		Parameters: params,
 		Created:    time.Now().Round(1 * time.Second).UTC(),
+		Attempt:    1,
 	}
 }
 
@@ -142,14 +372,59 @@ func (jr *JobRecord) Bytes() []byte {
 	return bytes
 }
 
+// Clone returns a deep copy of the record, sharing no maps nor slices with it
+func (jr *JobRecord) Clone() *JobRecord {
+	clone, err := LoadJob(jr.Bytes())
+	if err != nil {
+		panic(fmt.Sprintf("Failed to copy job: %v", err))
+	}
+	return clone
+}
+
 func (jr *JobRecord) SetFinalStatus(s JobStatus) {
 	jr.Status = s
 	jr.Completed = time.Now().Round(1 * time.Second).UTC()
 }
 
+// SetFailedStatus sets the final status to Failed, and records the reason
+func (jr *JobRecord) SetFailedStatus(category FailureCategory, format string, args ...interface{}) {
+	jr.SetFinalStatus(Failed)
+	jr.FailureReason = &FailureReason{
+		Category: category,
+		Message:  fmt.Sprintf(format, args...),
+	}
+}
+
+// SetTimedOutStatus sets the final status to TimedOut, and records the reason
+func (jr *JobRecord) SetTimedOutStatus(category FailureCategory, format string, args ...interface{}) {
+	jr.SetFinalStatus(TimedOut)
+	jr.FailureReason = &FailureReason{
+		Category: category,
+		Message:  fmt.Sprintf(format, args...),
+	}
+}
+
+// AppendTransition records the transition from the given status to the current one
+func (jr *JobRecord) AppendTransition(from JobStatus, actor, note string) {
+	jr.History = append(jr.History, StatusTransition{
+		From:  from,
+		To:    jr.Status,
+		Time:  time.Now().UTC(),
+		Actor: actor,
+		Note:  note,
+	})
+}
+
 func (jr *JobRecord) SetRunningStatus() {
 	jr.Status = Running
 	jr.Started = time.Now().Round(1 * time.Second).UTC()
+	jr.Heartbeat = jr.Started
+}
+
+// IsStale reports whether the job is running, but the worker stopped sending heartbeats for longer than the threshold.
+// Jobs run by workers that do not send heartbeats are never stale.
+func (jr *JobRecord) IsStale(threshold time.Duration) bool {
+	return jr.Status == Running && !jr.Heartbeat.IsZero() && time.Since(jr.Heartbeat) > threshold
 }
 
 type QueueStatus struct {
@@ -21,6 +21,7 @@ func TestJobSerialization(t *testing.T) {
 		Username:        "Alice",
 		GoPath:          "/usr/local/go1.18",
 		CleanupCmd:      "rm /tmp/foo_test",
+		Labels:          Labels{"pr": "1234"},
 	})
 
 	checkSerializeAndLoad := func() {
@@ -126,6 +127,7 @@ func TestJobStatus_IconAndString(t *testing.T) {
 		Failed,
 		Succeeded,
 		Cancelled,
+		TimedOut,
 	}
 
 	expectedStrings := []string{
@@ -134,6 +136,7 @@ func TestJobStatus_IconAndString(t *testing.T) {
 		"🔴 FAILED",
 		"🟢 SUCCEEDED",
 		"❌ CANCELLED",
+		"⏱️ TIMED_OUT",
 	}
 
 	for i, state := range knownStates {
@@ -144,3 +147,116 @@ func TestJobStatus_IconAndString(t *testing.T) {
 		}
 	}
 }
+
+func TestJobPriority_Parse(t *testing.T) {
+	testCases := []struct {
+		value    string
+		expected JobPriority
+		valid    bool
+	}{
+		{"low", LowPriority, true},
+		{"normal", NormalPriority, true},
+		{"HIGH", HighPriority, true},
+		{"Urgent", UrgentPriority, true},
+		{"", NormalPriority, false},
+		{"critical", NormalPriority, false},
+	}
+
+	for _, tc := range testCases {
+		var p JobPriority
+		err := p.Set(tc.value)
+		if tc.valid && err != nil {
+			t.Fatalf("Unexpected error parsing '%s': %v", tc.value, err)
+		} else if !tc.valid && err == nil {
+			t.Fatalf("Expected error parsing '%s'", tc.value)
+		} else if p != tc.expected {
+			t.Fatalf("Expected: %s, actual: %s", tc.expected, p)
+		}
+	}
+
+	// Records without a priority load as normal
+	var params JobParameters
+	if params.Priority != NormalPriority {
+		t.Fatalf("Unexpected default priority: %s", params.Priority)
+	}
+
+	// Unknown priorities (e.g. set by a newer version) are still printable
+	if s := JobPriority(7).String(); s != "priority(7)" {
+		t.Fatalf("Unexpected unknown priority: %s", s)
+	}
+}
+
+func TestDependencyPolicy_Set(t *testing.T) {
+	var dp DependencyPolicy
+	if err := dp.Set("Fail"); err != nil || dp != FailOnDependencyFailure {
+		t.Fatalf("Unexpected policy: %s (%v)", dp, err)
+	} else if err := dp.Set("bogus"); err == nil {
+		t.Fatalf("Expected error for invalid policy")
+	}
+
+	// Unknown policies (e.g. set by a newer version) are still printable
+	if s := DependencyPolicy(7).String(); s != "policy(7)" {
+		t.Fatalf("Unexpected unknown policy: %s", s)
+	}
+}
+
+func TestJobFailureReason(t *testing.T) {
+	j := NewJob(JobParameters{})
+	j.SetRunningStatus()
+
+	if j.FailureReason != nil {
+		t.Fatalf("Unexpected failure reason: %v", j.FailureReason)
+	}
+
+	j.SetFailedStatus(CheckoutFailure, "Failed to fetch ref %s", "v1.0.0")
+
+	if j.Status != Failed || !j.IsCompleted() {
+		t.Fatalf("Unexpected status: %s", j.Status)
+	} else if j.FailureReason.String() != "[checkout] Failed to fetch ref v1.0.0" {
+		t.Fatalf("Unexpected failure reason: %s", j.FailureReason)
+	}
+
+	loadedJob, err := LoadJob(j.Bytes())
+	if err != nil {
+		t.Fatalf("Failed to load job: %v", err)
+	} else if !reflect.DeepEqual(j, loadedJob) {
+		t.Fatalf("Jobs mismatch: \nJ1: %v\nJ2: %v", j, loadedJob)
+	}
+
+	j.SetTimedOutStatus(StaleFailure, "Running past timeout")
+
+	if j.Status != TimedOut || !j.IsCompleted() || j.RunTime() == "" {
+		t.Fatalf("Unexpected status: %s", j.Status)
+	} else if j.FailureReason.Category != StaleFailure {
+		t.Fatalf("Unexpected failure reason: %s", j.FailureReason)
+	}
+}
+
+func TestJobHistory(t *testing.T) {
+	j := NewJob(JobParameters{})
+
+	j.SetRunningStatus()
+	j.AppendTransition(Submitted, "worker-1", "")
+	j.SetFailedStatus(BuildFailure, "Build failed")
+	j.AppendTransition(Running, "worker-1", j.FailureReason.String())
+
+	if len(j.History) != 2 {
+		t.Fatalf("Unexpected history length: %d", len(j.History))
+	}
+
+	first, last := j.History[0], j.History[1]
+	if first.From != Submitted || first.To != Running || first.Actor != "worker-1" {
+		t.Fatalf("Unexpected transition: %+v", first)
+	} else if last.From != Running || last.To != Failed || last.Note != "[build] Build failed" {
+		t.Fatalf("Unexpected transition: %+v", last)
+	} else if last.Time.Before(first.Time) {
+		t.Fatalf("Transitions out of order: %v, %v", first.Time, last.Time)
+	}
+
+	loadedJob, err := LoadJob(j.Bytes())
+	if err != nil {
+		t.Fatalf("Failed to load job: %v", err)
+	} else if !reflect.DeepEqual(j, loadedJob) {
+		t.Fatalf("Jobs mismatch: \nJ1: %v\nJ2: %v", j, loadedJob)
+	}
+}
@@ -0,0 +1,138 @@
+package core
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+var labelKeyRegexp = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_.\-/]*$`)
+
+// Labels are arbitrary key/value pairs attached to a job (e.g. pr=1234, campaign=gc-tuning)
+type Labels map[string]string
+
+func (l Labels) String() string {
+	keys := make([]string, 0, len(l))
+	for k := range l {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	pairs := make([]string, len(keys))
+	for i, k := range keys {
+		pairs[i] = fmt.Sprintf("%s=%s", k, l[k])
+	}
+	return strings.Join(pairs, ",")
+}
+
+// Set implements flag.Value, each invocation adds one key=value label
+func (l *Labels) Set(value string) error {
+	key, labelValue, found := strings.Cut(value, "=")
+	if !found {
+		return fmt.Errorf("invalid label: '%s' (expected: key=value)", value)
+	}
+	key = strings.TrimSpace(key)
+	if !labelKeyRegexp.MatchString(key) {
+		return fmt.Errorf("invalid label key: '%s'", key)
+	}
+	// Values cannot be told apart from the separators in the string form, or in selectors
+	labelValue = strings.TrimSpace(labelValue)
+	if strings.ContainsAny(labelValue, ",=") {
+		return fmt.Errorf("invalid label value: '%s' (cannot contain ',' or '=')", labelValue)
+	}
+	if *l == nil {
+		*l = Labels{}
+	}
+	(*l)[key] = labelValue
+	return nil
+}
+
+type labelOperator int
+
+const (
+	labelEquals labelOperator = iota
+	labelNotEquals
+	labelExists
+	labelNotExists
+)
+
+type labelRequirement struct {
+	key      string
+	operator labelOperator
+	value    string
+}
+
+// LabelSelector selects jobs based on their labels.
+// A selector is a comma-separated list of requirements, all of which must be satisfied:
+// `key=value`, `key!=value`, `key` (label is present), `!key` (label is absent).
+// The empty selector matches every job.
+type LabelSelector struct {
+	expr         string
+	requirements []labelRequirement
+}
+
+func ParseLabelSelector(expr string) (LabelSelector, error) {
+	selector := LabelSelector{
+		expr: strings.TrimSpace(expr),
+	}
+
+	if selector.expr == "" {
+		return selector, nil
+	}
+
+	for _, term := range strings.Split(selector.expr, ",") {
+		term = strings.TrimSpace(term)
+		var req labelRequirement
+
+		if key, value, found := strings.Cut(term, "!="); found {
+			req = labelRequirement{strings.TrimSpace(key), labelNotEquals, strings.TrimSpace(value)}
+		} else if key, value, found := strings.Cut(term, "="); found {
+			req = labelRequirement{strings.TrimSpace(key), labelEquals, strings.TrimSpace(value)}
+		} else if strings.HasPrefix(term, "!") {
+			req = labelRequirement{strings.TrimSpace(term[1:]), labelNotExists, ""}
+		} else {
+			req = labelRequirement{term, labelExists, ""}
+		}
+
+		if !labelKeyRegexp.MatchString(req.key) {
+			return LabelSelector{}, fmt.Errorf("invalid label selector term: '%s'", term)
+		}
+		selector.requirements = append(selector.requirements, req)
+	}
+
+	return selector, nil
+}
+
+func (s LabelSelector) IsEmpty() bool {
+	return len(s.requirements) == 0
+}
+
+func (s LabelSelector) String() string {
+	return s.expr
+}
+
+func (s LabelSelector) Matches(labels Labels) bool {
+	for _, req := range s.requirements {
+		value, present := labels[req.key]
+		switch req.operator {
+		case labelEquals:
+			if !present || value != req.value {
+				return false
+			}
+		case labelNotEquals:
+			if present && value == req.value {
+				return false
+			}
+		case labelExists:
+			if !present {
+				return false
+			}
+		case labelNotExists:
+			if present {
+				return false
+			}
+		}
+	}
+	return true
+}
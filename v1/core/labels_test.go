@@ -0,0 +1,73 @@
+package core
+
+import (
+	"testing"
+)
+
+func TestLabels(t *testing.T) {
+	var labels Labels
+
+	for _, kv := range []string{"pr=1234", "campaign=gc-tuning", "nightly=true", "empty="} {
+		if err := labels.Set(kv); err != nil {
+			t.Fatalf("Failed to set label '%s': %v", kv, err)
+		}
+	}
+
+	for _, kv := range []string{"pr", "=1234", "a b=c", "list=a,b", "expr=a=b"} {
+		if err := labels.Set(kv); err == nil {
+			t.Fatalf("Expected error setting label '%s'", kv)
+		}
+	}
+
+	expected := "campaign=gc-tuning,empty=,nightly=true,pr=1234"
+	if labels.String() != expected {
+		t.Fatalf("Expected: %s, actual: %s", expected, labels.String())
+	}
+}
+
+func TestLabelSelector(t *testing.T) {
+	labels := Labels{
+		"pr":       "1234",
+		"campaign": "gc-tuning",
+		"nightly":  "true",
+	}
+
+	testCases := []struct {
+		expr    string
+		matches bool
+	}{
+		{"", true},
+		{"pr=1234", true},
+		{"pr=1234,campaign=gc-tuning", true},
+		{" pr = 1234 , nightly ", true},
+		{"pr=1235", false},
+		{"pr!=1235", true},
+		{"pr!=1234", false},
+		{"nightly", true},
+		{"baseline", false},
+		{"!baseline", true},
+		{"!nightly", false},
+		{"pr=1234,!nightly", false},
+	}
+
+	for _, tc := range testCases {
+		selector, err := ParseLabelSelector(tc.expr)
+		if err != nil {
+			t.Fatalf("Failed to parse selector '%s': %v", tc.expr, err)
+		}
+		if selector.Matches(labels) != tc.matches {
+			t.Errorf("Selector '%s' expected match: %v", tc.expr, tc.matches)
+		}
+	}
+
+	emptySelector, _ := ParseLabelSelector("")
+	if !emptySelector.IsEmpty() || !emptySelector.Matches(nil) {
+		t.Fatalf("Empty selector should match jobs without labels")
+	}
+
+	for _, expr := range []string{",", "=1234", "!", "pr=1234,,nightly"} {
+		if _, err := ParseLabelSelector(expr); err == nil {
+			t.Errorf("Expected error parsing selector '%s'", expr)
+		}
+	}
+}
@@ -0,0 +1,67 @@
+package core
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ProfileKind is a type of profile collected by running the benchmarks again with profiling enabled
+type ProfileKind string
+
+const (
+	CPUProfile   ProfileKind = "cpu"   // go test -cpuprofile
+	MemProfile   ProfileKind = "mem"   // go test -memprofile
+	MutexProfile ProfileKind = "mutex" // go test -mutexprofile
+	BlockProfile ProfileKind = "block" // go test -blockprofile
+	Trace        ProfileKind = "trace" // go test -trace
+)
+
+var ProfileKindsAll = ProfileKinds{
+	CPUProfile,
+	MemProfile,
+	MutexProfile,
+	BlockProfile,
+	Trace,
+}
+
+// FileName returns the name of the profile file, which is also the name of its job artifact
+func (k ProfileKind) FileName() string {
+	if k == Trace {
+		return "trace.out"
+	}
+	return fmt.Sprintf("%s.pprof", k)
+}
+
+// ProfileKinds is a list of profile kinds
+type ProfileKinds []ProfileKind
+
+func (pk ProfileKinds) String() string {
+	kinds := make([]string, len(pk))
+	for i, k := range pk {
+		kinds[i] = string(k)
+	}
+	return strings.Join(kinds, ",")
+}
+
+// Set implements flag.Value, accepts a comma-separated list of kinds
+func (pk *ProfileKinds) Set(value string) error {
+	for _, k := range strings.Split(value, ",") {
+		kind := ProfileKind(strings.TrimSpace(k))
+		if !ProfileKindsAll.Contains(kind) {
+			return fmt.Errorf("invalid profile: '%s' (valid: %s)", k, ProfileKindsAll)
+		}
+		if !pk.Contains(kind) {
+			*pk = append(*pk, kind)
+		}
+	}
+	return nil
+}
+
+func (pk ProfileKinds) Contains(kind ProfileKind) bool {
+	for _, k := range pk {
+		if k == kind {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,30 @@
+package core
+
+import (
+	"testing"
+)
+
+func TestProfileKinds(t *testing.T) {
+	var profiles ProfileKinds
+
+	for _, value := range []string{"cpu,mem", "trace", "cpu"} {
+		if err := profiles.Set(value); err != nil {
+			t.Fatalf("Failed to set profiles '%s': %v", value, err)
+		}
+	}
+
+	for _, value := range []string{"", "goroutine", "cpu,"} {
+		if err := profiles.Set(value); err == nil {
+			t.Fatalf("Expected error setting profiles '%s'", value)
+		}
+	}
+
+	expected := "cpu,mem,trace"
+	if profiles.String() != expected {
+		t.Fatalf("Expected: %s, actual: %s", expected, profiles.String())
+	}
+
+	if CPUProfile.FileName() != "cpu.pprof" || Trace.FileName() != "trace.out" {
+		t.Fatalf("Unexpected file names: %s, %s", CPUProfile.FileName(), Trace.FileName())
+	}
+}
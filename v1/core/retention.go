@@ -0,0 +1,148 @@
+package core
+
+import (
+	"fmt"
+	"sort"
+	"time"
+)
+
+// RetentionPolicy selects completed jobs to delete, or to keep without their logs.
+// Jobs are deleted once older than MaxAge, unless kept by one of the other rules.
+// The zero value keeps every job in full.
+type RetentionPolicy struct {
+	MaxAge     time.Duration // Age (since completion) past which jobs are deleted (0: no limit)
+	KeepLabels LabelSelector // Jobs matching are always kept in full (empty: none)
+	KeepPerRef int           // Number of most recent jobs always kept for each remote and ref (0: none)
+	LogsMaxAge time.Duration // Age past which artifacts other than results are deleted from kept jobs (0: no limit)
+}
+
+func (p RetentionPolicy) IsEmpty() bool {
+	return p.MaxAge == 0 && p.LogsMaxAge == 0
+}
+
+func (p RetentionPolicy) String() string {
+	policy := fmt.Sprintf("max age: %s, logs max age: %s", formatDays(p.MaxAge), formatDays(p.LogsMaxAge))
+	if !p.KeepLabels.IsEmpty() {
+		policy += fmt.Sprintf(", keep labels: %s", p.KeepLabels)
+	}
+	if p.KeepPerRef > 0 {
+		policy += fmt.Sprintf(", keep per ref: %d", p.KeepPerRef)
+	}
+	return policy
+}
+
+// PruneAction is what a retention policy does to a job
+type PruneAction string
+
+const (
+	PruneLogs PruneAction = "delete-logs" // Delete artifacts other than results, keep the job record
+	PruneJob  PruneAction = "delete"      // Delete the job record, queue message and artifacts
+)
+
+// PruneDecision is the action taken on a job by a retention policy, and why
+type PruneDecision struct {
+	Job    *JobRecord
+	Action PruneAction
+	Reason string
+}
+
+// Plan returns the actions the policy takes on the given jobs, as of the given time, ordered by job creation.
+// Jobs not listed are kept as they are. Jobs not completed are always kept, and so are the jobs they depend on.
+func (p RetentionPolicy) Plan(jobs []*JobRecord, now time.Time) []PruneDecision {
+	// Newest first, to find the most recent jobs of each ref
+	sorted := make([]*JobRecord, len(jobs))
+	copy(sorted, jobs)
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].Created.After(sorted[j].Created)
+	})
+
+	dependencies := map[string]bool{}
+	for _, job := range sorted {
+		if !job.IsCompleted() {
+			for _, dependency := range job.DependsOn {
+				dependencies[dependency] = true
+			}
+		}
+	}
+
+	decisions := []PruneDecision{}
+	refJobs := map[string]int{}
+	for _, job := range sorted {
+		if !job.IsCompleted() || dependencies[job.Id] {
+			continue
+		} else if !p.KeepLabels.IsEmpty() && p.KeepLabels.Matches(job.Parameters.Labels) {
+			continue
+		}
+
+		ref := job.Parameters.GitRemote + " " + job.Parameters.GitRef
+		refJobs[ref]++
+		keptForRef := refJobs[ref] <= p.KeepPerRef
+
+		age := job.Age(now)
+		if p.MaxAge > 0 && age > p.MaxAge && !keptForRef {
+			decisions = append(decisions, PruneDecision{
+				Job:    job,
+				Action: PruneJob,
+				Reason: fmt.Sprintf("completed %s ago", formatDays(age)),
+			})
+		} else if p.LogsMaxAge > 0 && age > p.LogsMaxAge && job.HasLogs() {
+			decisions = append(decisions, PruneDecision{
+				Job:    job,
+				Action: PruneLogs,
+				Reason: fmt.Sprintf("completed %s ago", formatDays(age)),
+			})
+		}
+	}
+
+	sort.Slice(decisions, func(i, j int) bool {
+		return decisions[i].Job.Created.Before(decisions[j].Job.Created)
+	})
+	return decisions
+}
+
+// Age of a completed job, since its completion
+func (jr *JobRecord) Age(now time.Time) time.Duration {
+	if jr.Completed.IsZero() {
+		return now.Sub(jr.Created)
+	}
+	return now.Sub(jr.Completed)
+}
+
+// HasLogs reports whether the record references artifacts other than results (logs of each attempt, script, profiles)
+func (jr *JobRecord) HasLogs() bool {
+	if jr.Log != "" || jr.Script != "" {
+		return true
+	}
+	for name := range jr.Artifacts {
+		if name != ResultsArtifact {
+			return true
+		}
+	}
+	for _, attempt := range jr.PreviousAttempts {
+		if attempt.Log != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// RemoveLogs clears the references to artifacts other than results, once deleted
+func (jr *JobRecord) RemoveLogs() {
+	jr.Log = ""
+	jr.Script = ""
+	for name := range jr.Artifacts {
+		if name != ResultsArtifact {
+			delete(jr.Artifacts, name)
+		}
+	}
+	for i := range jr.PreviousAttempts {
+		jr.PreviousAttempts[i].Log = ""
+	}
+}
+
+func formatDays(d time.Duration) string {
+	if d == 0 {
+		return "none"
+	}
+	return fmt.Sprintf("%dd", int(d.Hours()/24))
+}
@@ -0,0 +1,82 @@
+package core
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRetentionPlan(t *testing.T) {
+	now := time.Now()
+	day := 24 * time.Hour
+
+	// Job of the given ref, completed the given number of days ago
+	completedJob := func(id, ref string, daysAgo int) *JobRecord {
+		j := NewJob(JobParameters{GitRemote: "origin", GitRef: ref})
+		j.Id = id
+		j.Status = Succeeded
+		j.Created = now.Add(-time.Duration(daysAgo)*day - time.Hour)
+		j.Completed = now.Add(-time.Duration(daysAgo) * day)
+		j.Log = "jobs/" + id + "/log.txt"
+		j.Results = "jobs/" + id + "/results.txt"
+		return j
+	}
+
+	oldJob := completedJob("old", "main", 40)
+	oldMainJob := completedJob("old-main", "main", 35)
+	oldLabeledJob := completedJob("old-labeled", "feature", 50)
+	oldLabeledJob.Parameters.Labels = Labels{"release": "v1"}
+	oldDependencyJob := completedJob("old-dependency", "feature", 45)
+	oldNoLogsJob := completedJob("old-no-logs", "feature", 12)
+	oldNoLogsJob.Log = ""
+	recentJob := completedJob("recent", "feature", 10)
+	newJob := completedJob("new", "main", 1)
+	runningJob := completedJob("running", "main", 60)
+	runningJob.Status = Running
+	runningJob.Completed = time.Time{}
+	waitingJob := completedJob("waiting", "feature", 0)
+	waitingJob.Status = Submitted
+	waitingJob.DependsOn = []string{oldDependencyJob.Id}
+
+	jobs := []*JobRecord{newJob, oldJob, recentJob, oldLabeledJob, oldNoLogsJob, oldMainJob, runningJob, waitingJob,
+		oldDependencyJob}
+
+	if decisions := (RetentionPolicy{}).Plan(jobs, now); len(decisions) != 0 {
+		t.Fatalf("Unexpected decisions of empty policy: %+v", decisions)
+	}
+
+	keepLabels, err := ParseLabelSelector("release")
+	if err != nil {
+		t.Fatal(err)
+	}
+	policy := RetentionPolicy{
+		MaxAge:     30 * day,
+		KeepLabels: keepLabels,
+		KeepPerRef: 2,
+		LogsMaxAge: 7 * day,
+	}
+
+	// The two most recent jobs of main (new, old-main) are kept for their ref
+	expected := []struct {
+		jobId  string
+		action PruneAction
+	}{
+		{oldJob.Id, PruneJob},
+		{oldMainJob.Id, PruneLogs},
+		{recentJob.Id, PruneLogs},
+	}
+
+	decisions := policy.Plan(jobs, now)
+	if len(decisions) != len(expected) {
+		t.Fatalf("Expected %d decisions, got: %+v", len(expected), decisions)
+	}
+	for i, decision := range decisions {
+		if decision.Job.Id != expected[i].jobId || decision.Action != expected[i].action || decision.Reason == "" {
+			t.Fatalf("Expected %s %s, got: %s %s", expected[i].action, expected[i].jobId, decision.Action, decision.Job.Id)
+		}
+	}
+
+	recentJob.RemoveLogs()
+	if recentJob.HasLogs() || recentJob.Results == "" {
+		t.Fatalf("Unexpected job after removing logs: %+v", recentJob)
+	}
+}
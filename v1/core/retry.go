@@ -0,0 +1,193 @@
+package core
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Failure categories retried by default, caused by the infrastructure rather than the code under test
+var InfrastructureFailures = FailureCategories{
+	CheckoutFailure,
+	ArtifactsFailure,
+	WorkerFailure,
+	LostWorkerFailure,
+	EnvironmentFailure,
+}
+
+// FailureCategories is a list of failure categories
+type FailureCategories []FailureCategory
+
+func (fc FailureCategories) String() string {
+	categories := make([]string, len(fc))
+	for i, c := range fc {
+		categories[i] = string(c)
+	}
+	return strings.Join(categories, ",")
+}
+
+// Set implements flag.Value, takes a comma-separated list of categories
+func (fc *FailureCategories) Set(value string) error {
+	categories := FailureCategories{}
+	for _, c := range strings.Split(value, ",") {
+		category := FailureCategory(strings.TrimSpace(c))
+		if !category.IsValid() {
+			return fmt.Errorf("invalid failure category: '%s'", c)
+		}
+		categories = append(categories, category)
+	}
+	*fc = categories
+	return nil
+}
+
+func (fc FailureCategories) Contains(category FailureCategory) bool {
+	for _, c := range fc {
+		if c == category {
+			return true
+		}
+	}
+	return false
+}
+
+func (c FailureCategory) IsValid() bool {
+	switch c {
+	case NotAllowedFailure,
+		InvalidParametersFailure,
+		SetupFailure,
+		CheckoutFailure,
+		BuildFailure,
+		BenchmarkFailure,
+		ArtifactsFailure,
+		WorkerFailure,
+		TimeoutFailure,
+		StaleFailure,
+		DependencyFailure,
+		LostWorkerFailure,
+		EnvironmentFailure,
+		ResourceLimitFailure:
+		return true
+	default:
+		return false
+	}
+}
+
+// RetryPolicy determines whether a failed job is automatically requeued
+type RetryPolicy struct {
+	MaxAttempts uint              // Total number of attempts, including the first one (0 or 1: no retry)
+	Categories  FailureCategories // Failures that are retried (default: InfrastructureFailures)
+}
+
+// Retries reports whether a job that failed for the given reason after the given attempt should run again
+func (rp RetryPolicy) Retries(attempt uint, reason *FailureReason) bool {
+	if reason == nil || attempt >= rp.MaxAttempts {
+		return false
+	}
+	categories := rp.Categories
+	if len(categories) == 0 {
+		categories = InfrastructureFailures
+	}
+	return categories.Contains(reason.Category)
+}
+
+// JobAttempt is a past, failed attempt at running a job
+type JobAttempt struct {
+	Attempt       uint
+	Started       time.Time
+	Completed     time.Time
+	WorkerInfo    WorkerInfo
+	Log           string
+	FailureReason FailureReason
+	RunStats      *RunStats // Resources used by the job script (nil if the script did not run)
+}
+
+// CurrentAttempt is the number of the current (or last) attempt at running the job, starting from 1
+func (jr *JobRecord) CurrentAttempt() uint {
+	// Records created before retries existed have no attempt counter
+	if jr.Attempt == 0 {
+		return 1
+	}
+	return jr.Attempt
+}
+
+// ShouldRetry reports whether the job failed in a way its retry policy allows to run it again
+func (jr *JobRecord) ShouldRetry() bool {
+	return jr.Status == Failed && jr.Parameters.Retry.Retries(jr.CurrentAttempt(), jr.FailureReason)
+}
+
+// Requeue moves the current failed attempt into the list of previous attempts,
+// and resets the job to Submitted so it can be dispatched again.
+// What the attempt produced, other than its log, is cleared (results, script, profiles, versions, run stats, ...),
+// so it is not taken for the output of the next attempt.
+// Returns a note describing the retry, for the job history.
+func (jr *JobRecord) Requeue() string {
+	note := fmt.Sprintf(
+		"Retrying after attempt %d of %d failed: %s",
+		jr.CurrentAttempt(),
+		jr.Parameters.Retry.MaxAttempts,
+		jr.FailureReason,
+	)
+
+	attempt := JobAttempt{
+		Attempt:    jr.CurrentAttempt(),
+		Started:    jr.Started,
+		Completed:  jr.Completed,
+		WorkerInfo: jr.WorkerInfo,
+		Log:        jr.Log,
+		RunStats:   jr.RunStats,
+	}
+	if jr.FailureReason != nil {
+		attempt.FailureReason = *jr.FailureReason
+	}
+	jr.PreviousAttempts = append(jr.PreviousAttempts, attempt)
+
+	jr.Attempt = attempt.Attempt + 1
+	jr.resetAttempt()
+
+	return note
+}
+
+// RestartAttempt resets the job to Submitted to run its current attempt again from the start, e.g. after its worker
+// was interrupted by a shutdown. Unlike Requeue, this is not a failed attempt, and does not count towards the
+// retry policy.
+func (jr *JobRecord) RestartAttempt() {
+	// The log of the attempt is uploaded again when it runs
+	delete(jr.Artifacts, AttemptLogArtifact(jr.CurrentAttempt()))
+	jr.Attempt = jr.CurrentAttempt()
+	jr.resetAttempt()
+}
+
+// Reset the job to Submitted, clearing what the current attempt produced, other than the logs of previous attempts
+func (jr *JobRecord) resetAttempt() {
+	jr.Status = Submitted
+	jr.Started = time.Time{}
+	jr.Completed = time.Time{}
+	jr.Heartbeat = time.Time{}
+	jr.WorkerInfo = WorkerInfo{}
+	jr.SHA = ""
+	jr.GoVersion = ""
+	jr.GoExperiment = ""
+	jr.GoCaches = nil
+	jr.RunStats = nil
+	jr.Log = ""
+	jr.Results = ""
+	jr.Script = ""
+	for name := range jr.Artifacts {
+		if !isLogArtifact(name) {
+			delete(jr.Artifacts, name)
+		}
+	}
+	jr.FailureReason = nil
+}
+
+// AttemptLog returns the log artifact key of the given attempt
+func (jr *JobRecord) AttemptLog(attempt uint) (string, error) {
+	if attempt == jr.CurrentAttempt() {
+		return jr.Log, nil
+	}
+	for _, a := range jr.PreviousAttempts {
+		if a.Attempt == attempt {
+			return a.Log, nil
+		}
+	}
+	return "", fmt.Errorf("Job %s has no attempt %d", jr.Id, attempt)
+}
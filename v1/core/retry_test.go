@@ -0,0 +1,102 @@
+package core
+
+import (
+	"testing"
+)
+
+func TestJobRetry(t *testing.T) {
+	j := NewJob(JobParameters{
+		Retry: RetryPolicy{MaxAttempts: 3, Categories: FailureCategories{CheckoutFailure}},
+	})
+
+	j.SetRunningStatus()
+	j.Log = "log-1"
+	j.AddArtifact(LogArtifact, "log-1")
+	j.Results = "results-1"
+	j.AddArtifact(ResultsArtifact, "results-1")
+	j.AddArtifact("cpu.pprof", "cpu-1")
+	j.SHA = "abc"
+	j.RunStats = &RunStats{PeakMemory: 1024}
+	j.SetFailedStatus(CheckoutFailure, "Failed to fetch")
+
+	if !j.ShouldRetry() {
+		t.Fatalf("Expected retry of attempt %d", j.CurrentAttempt())
+	}
+
+	j.Requeue()
+
+	if j.Status != Submitted || j.Attempt != 2 || j.Log != "" || j.FailureReason != nil {
+		t.Fatalf("Unexpected requeued job: %+v", j)
+	} else if log, err := j.AttemptLog(1); err != nil || log != "log-1" {
+		t.Fatalf("Unexpected first attempt log: %s (%v)", log, err)
+	} else if _, err := j.AttemptLog(5); err == nil {
+		t.Fatalf("Expected error for unknown attempt")
+	}
+
+	// Only the log of the failed attempt is kept, its run stats move to the attempt
+	if j.Results != "" || j.SHA != "" || j.RunStats != nil || j.PreviousAttempts[0].RunStats.PeakMemory != 1024 {
+		t.Fatalf("Unexpected requeued job: %+v", j)
+	} else if len(j.Artifacts) != 1 || j.Artifacts[LogArtifact] != "log-1" {
+		t.Fatalf("Unexpected artifacts of requeued job: %v", j.Artifacts)
+	}
+
+	j.SetRunningStatus()
+	j.SetFailedStatus(BuildFailure, "Compilation error")
+
+	if j.ShouldRetry() {
+		t.Fatalf("Unexpected retry of failure category %s", j.FailureReason.Category)
+	}
+
+	j.SetFailedStatus(CheckoutFailure, "Failed to fetch")
+	j.Requeue()
+	j.SetFailedStatus(CheckoutFailure, "Failed to fetch")
+
+	if j.ShouldRetry() {
+		t.Fatalf("Unexpected retry past max attempts")
+	}
+
+	// Records without attempt counter are on their first attempt
+	j.Attempt = 0
+	if j.CurrentAttempt() != 1 {
+		t.Fatalf("Unexpected attempt: %d", j.CurrentAttempt())
+	}
+
+	var categories FailureCategories
+	if err := categories.Set("checkout, worker"); err != nil {
+		t.Fatal(err)
+	} else if categories.String() != "checkout,worker" {
+		t.Fatalf("Unexpected categories: %s", categories)
+	} else if err := categories.Set("checkout,bogus"); err == nil {
+		t.Fatalf("Expected error for invalid category")
+	}
+}
+
+func TestJobRestartAttempt(t *testing.T) {
+	j := NewJob(JobParameters{
+		Retry: RetryPolicy{MaxAttempts: 2, Categories: FailureCategories{CheckoutFailure}},
+	})
+
+	j.SetRunningStatus()
+	j.AddArtifact(LogArtifact, "log-1")
+	j.SetFailedStatus(CheckoutFailure, "Failed to fetch")
+	j.Requeue()
+
+	j.SetRunningStatus()
+	j.Log = "log-2"
+	j.AddArtifact(AttemptLogArtifact(2), "log-2")
+	j.AddArtifact("cpu.pprof", "cpu-2")
+	j.RestartAttempt()
+
+	// The interrupted attempt runs again, only the logs of previous attempts are kept
+	if j.Status != Submitted || j.CurrentAttempt() != 2 || len(j.PreviousAttempts) != 1 || j.Log != "" {
+		t.Fatalf("Unexpected restarted job: %+v", j)
+	} else if len(j.Artifacts) != 1 || j.Artifacts[LogArtifact] != "log-1" {
+		t.Fatalf("Unexpected artifacts of restarted job: %v", j.Artifacts)
+	}
+
+	j.SetRunningStatus()
+	j.SetFailedStatus(CheckoutFailure, "Failed to fetch")
+	if j.ShouldRetry() {
+		t.Fatalf("Unexpected retry past max attempts")
+	}
+}
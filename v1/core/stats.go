@@ -0,0 +1,23 @@
+package core
+
+import (
+	"fmt"
+	"time"
+)
+
+// RunStats are the resources used by a job script and all the processes it started
+type RunStats struct {
+	PeakMemory uint64        // Peak memory usage, in bytes
+	CPUTime    time.Duration // User and system CPU time
+	DiskUsage  uint64        // Size of the job directory after the run, in bytes
+}
+
+// String returns the statistics in human-readable form
+func (s *RunStats) String() string {
+	return fmt.Sprintf(
+		"peak memory: %.1f MiB, CPU time: %s, disk: %.1f MiB",
+		float64(s.PeakMemory)/(1<<20),
+		s.CPUTime.Round(time.Millisecond),
+		float64(s.DiskUsage)/(1<<20),
+	)
+}
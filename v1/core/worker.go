@@ -0,0 +1,40 @@
+package core
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// WorkerRecord is the registration of a live worker
+type WorkerRecord struct {
+	Id          string
+	WorkerInfo  WorkerInfo
+	Queue       string    // Name of the queue the worker consumes jobs from
+	Slots       int       // Number of jobs the worker runs concurrently
+	CurrentJobs []string  // IDs of the jobs currently running (empty if idle)
+	Started     time.Time // When the worker started
+	Heartbeat   time.Time // Last time the worker refreshed its registration
+	Draining    bool      // Worker is finishing its current jobs and not picking up new ones
+}
+
+func LoadWorker(data []byte) (*WorkerRecord, error) {
+	worker := WorkerRecord{}
+	err := json.Unmarshal(data, &worker)
+	if err != nil {
+		return nil, err
+	}
+	return &worker, nil
+}
+
+func (wr *WorkerRecord) Bytes() []byte {
+	bytes, err := json.Marshal(wr)
+	if err != nil {
+		panic(fmt.Sprintf("Failed to serialize worker: %v", err))
+	}
+	return bytes
+}
+
+func (wr *WorkerRecord) Uptime() string {
+	return time.Since(wr.Started).Round(time.Second).String()
+}